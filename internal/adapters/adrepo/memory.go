@@ -0,0 +1,1462 @@
+package adrepo
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type rwLocker interface {
+	sync.Locker
+	RLock()
+	RUnlock()
+}
+
+// nopLock is used inside RunInTx, where the parent repository
+// already holds the write lock for the whole transaction.
+type nopLock struct{}
+
+func (nopLock) Lock()    {}
+func (nopLock) Unlock()  {}
+func (nopLock) RLock()   {}
+func (nopLock) RUnlock() {}
+
+type refreshToken struct {
+	UserID    int64
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+type memState struct {
+	ads        map[int64]*ads.Ad
+	users      map[int64]*ads.User
+	revisions  map[int64][]*ads.Revision // by ad id, oldest first
+	categories map[int64]*ads.Category
+	favorites  map[int64]map[int64]bool // ad ids by user id
+	threads    map[int64]*ads.Thread
+	messages   map[int64][]*ads.Message // by thread id, oldest first
+	reports    map[int64]*ads.Report
+	notices    map[int64][]*ads.Notification // by user id, oldest first
+	passwords  map[int64][]byte              // password hashes by user id
+	refresh    map[string]*refreshToken
+	apiKeys    map[int64]*ads.APIKey
+	keyHashes  map[int64][]byte // API key hashes by key id
+	nextAdID   int64
+	nextUserID int64
+	nextRevID  int64
+	nextCatID  int64
+	nextImgID  int64
+	nextThrID  int64
+	nextMsgID  int64
+	nextRepID  int64
+	nextNtfID  int64
+	nextKeyID  int64
+}
+
+func (st *memState) clone() *memState {
+	c := &memState{
+		ads:        make(map[int64]*ads.Ad, len(st.ads)),
+		users:      make(map[int64]*ads.User, len(st.users)),
+		revisions:  make(map[int64][]*ads.Revision, len(st.revisions)),
+		categories: make(map[int64]*ads.Category, len(st.categories)),
+		favorites:  make(map[int64]map[int64]bool, len(st.favorites)),
+		threads:    make(map[int64]*ads.Thread, len(st.threads)),
+		messages:   make(map[int64][]*ads.Message, len(st.messages)),
+		reports:    make(map[int64]*ads.Report, len(st.reports)),
+		notices:    make(map[int64][]*ads.Notification, len(st.notices)),
+		passwords:  maps.Clone(st.passwords),
+		refresh:    make(map[string]*refreshToken, len(st.refresh)),
+		apiKeys:    make(map[int64]*ads.APIKey, len(st.apiKeys)),
+		keyHashes:  maps.Clone(st.keyHashes),
+		nextAdID:   st.nextAdID,
+		nextUserID: st.nextUserID,
+		nextRevID:  st.nextRevID,
+		nextCatID:  st.nextCatID,
+		nextImgID:  st.nextImgID,
+		nextThrID:  st.nextThrID,
+		nextMsgID:  st.nextMsgID,
+		nextRepID:  st.nextRepID,
+		nextNtfID:  st.nextNtfID,
+		nextKeyID:  st.nextKeyID,
+	}
+	for id, ad := range st.ads {
+		c.ads[id] = copyAd(ad)
+	}
+	for id, user := range st.users {
+		c.users[id] = copyUser(user)
+	}
+	for id, cat := range st.categories {
+		c.categories[id] = copyCategory(cat)
+	}
+	for id, favs := range st.favorites {
+		c.favorites[id] = maps.Clone(favs)
+	}
+	for id, thread := range st.threads {
+		t := *thread
+		c.threads[id] = &t
+	}
+	for id, msgs := range st.messages {
+		list := make([]*ads.Message, len(msgs))
+		for i, msg := range msgs {
+			list[i] = copyMessage(msg)
+		}
+		c.messages[id] = list
+	}
+	for id, rep := range st.reports {
+		c.reports[id] = copyReport(rep)
+	}
+	for id, tok := range st.refresh {
+		t := *tok
+		c.refresh[id] = &t
+	}
+	for id, key := range st.apiKeys {
+		c.apiKeys[id] = copyAPIKey(key)
+	}
+	// Revisions and notifications are never modified after they are added,
+	// so sharing them is safe.
+	for id, revs := range st.revisions {
+		c.revisions[id] = append([]*ads.Revision(nil), revs...)
+	}
+	for id, notices := range st.notices {
+		c.notices[id] = append([]*ads.Notification(nil), notices...)
+	}
+	return c
+}
+
+// MemRepo never blocks on I/O, so instead of interrupting queries it
+// checks at the start of every method that the context is not done yet.
+type MemRepo struct {
+	mu rwLocker
+	*memState
+}
+
+// RunInTx holds the write lock for the duration of fn and applies
+// its changes to a copy of the state, which replaces the current state
+// only if fn succeeds.
+func (r *MemRepo) RunInTx(ctx context.Context, fn func(tx app.Repository) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.memState.clone()
+	if err := fn(&MemRepo{mu: nopLock{}, memState: st}); err != nil {
+		return err
+	}
+	// Like a Postgres commit, a transaction whose context is done is rolled back.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	*r.memState = *st
+	return nil
+}
+
+func (r *MemRepo) Create(ctx context.Context, in ads.AdInput, UserID int64) (*ads.Ad, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user, ok := r.users[UserID]; !ok || user.Deleted {
+		return nil, ErrUnknownAuthor
+	}
+	if !r.categoryExists(in.CategoryID) {
+		return nil, ErrUnknownCategory
+	}
+	now := time.Now().UTC()
+	ad := &ads.Ad{
+		ID:          r.nextAdID,
+		Title:       in.Title,
+		Text:        in.Text,
+		AuthorID:    UserID,
+		CategoryID:  copyPtr(in.CategoryID),
+		Tags:        append([]string{}, in.Tags...),
+		Price:       copyPtr(in.Price),
+		Currency:    in.Currency,
+		Status:      ads.StatusDraft,
+		Version:     1,
+		DateCreated: now,
+		DateUpdated: now,
+	}
+	r.ads[ad.ID] = ad
+	r.nextAdID++
+	return copyAd(ad), nil
+}
+
+// authorAd returns a stored ad that UserID is allowed to modify.
+// The caller must hold the lock.
+func (r *MemRepo) authorAd(ID int64, UserID int64) (*ads.Ad, error) {
+	ad, ok := r.ads[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	if ad.AuthorID != UserID {
+		return nil, ErrNotAuthor
+	}
+	if ad.Deleted {
+		return nil, ErrWasDeleted
+	}
+	return ad, nil
+}
+
+func (r *MemRepo) UpdateStatus(ctx context.Context, ID int64, From ads.AdStatus, To ads.AdStatus, Reason string, Version int64) (*ads.Ad, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ad, ok := r.ads[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	if ad.Deleted {
+		return nil, ErrWasDeleted
+	}
+	if ad.Status != From || Version != 0 && ad.Version != Version {
+		return nil, ErrConflict
+	}
+	ad.Status = To
+	ad.Published = To == ads.StatusPublished
+	ad.RejectionReason = Reason
+	touch(ad)
+	return copyAd(ad), nil
+}
+
+func (r *MemRepo) UpdateContent(ctx context.Context, ID int64, UserID int64, in ads.AdInput, Version int64) (*ads.Ad, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ad, err := r.authorAd(ID, UserID)
+	if err != nil {
+		return nil, err
+	}
+	if Version != 0 && ad.Version != Version {
+		return nil, ErrConflict
+	}
+	if !r.categoryExists(in.CategoryID) {
+		return nil, ErrUnknownCategory
+	}
+	ad.Title = in.Title
+	ad.Text = in.Text
+	ad.CategoryID = copyPtr(in.CategoryID)
+	ad.Tags = append([]string{}, in.Tags...)
+	ad.Price = copyPtr(in.Price)
+	ad.Currency = in.Currency
+	touch(ad)
+	return copyAd(ad), nil
+}
+
+func (r *MemRepo) UpdateSchedule(ctx context.Context, ID int64, UserID int64, PublishAt *time.Time, ExpiresAt *time.Time, Version int64) (*ads.Ad, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ad, err := r.authorAd(ID, UserID)
+	if err != nil {
+		return nil, err
+	}
+	if Version != 0 && ad.Version != Version {
+		return nil, ErrConflict
+	}
+	ad.PublishAt = copyPtr(PublishAt)
+	ad.ExpiresAt = copyPtr(ExpiresAt)
+	touch(ad)
+	return copyAd(ad), nil
+}
+
+func (r *MemRepo) ListDueAds(ctx context.Context, now time.Time, publishable []ads.AdStatus, limit int) ([]*ads.Ad, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var res = make([]*ads.Ad, 0)
+	for _, ad := range r.ads {
+		author, ok := r.users[ad.AuthorID]
+		publish := due(ad.PublishAt, now) && slices.Contains(publishable, ad.Status) && ok && !author.Deleted
+		if ad.Deleted || !publish && !due(ad.ExpiresAt, now) {
+			continue
+		}
+		res = append(res, copyAd(ad))
+	}
+	slices.SortFunc(res, func(a, b *ads.Ad) int { return cmp.Compare(a.ID, b.ID) })
+	return paginate(res, limit, 0), nil
+}
+
+func due(at *time.Time, now time.Time) bool {
+	return at != nil && !at.After(now)
+}
+
+func (r *MemRepo) GetList(ctx context.Context, filter ads.AdFilter) ([]*ads.Ad, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var res = make([]*ads.Ad, 0)
+	terms := tokenize(filter.Query)
+	var categories map[int64]bool
+	if filter.Category != nil {
+		categories = r.subtree(*filter.Category)
+	}
+	for _, ad := range r.ads {
+		if ad.Deleted {
+			continue
+		}
+		if filter.Pub && !ad.Published {
+			continue
+		}
+		if filter.Status != "" && ad.Status != filter.Status {
+			continue
+		}
+		if filter.Auth != -1 && ad.AuthorID != filter.Auth {
+			continue
+		}
+		if filter.Title != "" && ad.Title != filter.Title {
+			continue
+		}
+		if categories != nil && (ad.CategoryID == nil || !categories[*ad.CategoryID]) {
+			continue
+		}
+		if filter.FavoritesOf != nil && !r.favorites[*filter.FavoritesOf][ad.ID] {
+			continue
+		}
+		if !hasTags(ad.Tags, filter.Tags) {
+			continue
+		}
+		if !priceMatches(ad, filter) {
+			continue
+		}
+		ad = copyAd(ad)
+		if len(terms) > 0 && !searchAd(ad, terms) {
+			continue
+		}
+		res = append(res, ad)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if filter.Sort != ads.SortDefault {
+			if c := comparePrices(res[i].Price, res[j].Price, filter.Sort == ads.SortPriceDesc); c != 0 {
+				return c < 0
+			}
+		} else if res[i].Rank != res[j].Rank {
+			return res[i].Rank > res[j].Rank
+		}
+		return res[i].ID < res[j].ID
+	})
+	return paginate(res, filter.Limit, filter.Offset), int64(len(res)), nil
+}
+
+func (r *MemRepo) GetByID(ctx context.Context, ID int64) (*ads.Ad, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ad, ok := r.ads[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	if ad.Deleted {
+		return nil, ErrWasDeleted
+	}
+	return copyAd(ad), nil
+}
+
+func (r *MemRepo) DeleteAd(ctx context.Context, ID int64, UserID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ad, err := r.authorAd(ID, UserID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	ad.Deleted = true
+	ad.DeletedAt = &now
+	ad.DeletedBy = &UserID
+	touch(ad)
+	return nil
+}
+
+func (r *MemRepo) ForceDeleteAd(ctx context.Context, ID int64, ActorID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ad, ok := r.ads[ID]
+	if !ok {
+		return ErrNotCreated
+	}
+	if ad.Deleted {
+		return ErrWasDeleted
+	}
+	now := time.Now().UTC()
+	ad.Deleted = true
+	ad.DeletedAt = &now
+	ad.DeletedBy = &ActorID
+	touch(ad)
+	return nil
+}
+
+func (r *MemRepo) RestoreAd(ctx context.Context, ID int64, UserID int64) (*ads.Ad, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ad, ok := r.ads[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	if ad.AuthorID != UserID {
+		return nil, ErrNotAuthor
+	}
+	if !ad.Deleted {
+		return nil, ErrNotDeleted
+	}
+	ad.Deleted = false
+	ad.DeletedAt = nil
+	ad.DeletedBy = nil
+	touch(ad)
+	return copyAd(ad), nil
+}
+
+// LockAd needs no extra locking in memory: inside RunInTx the whole
+// repository is already locked.
+func (r *MemRepo) LockAd(ctx context.Context, ID int64) (*ads.Ad, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ad, ok := r.ads[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	return copyAd(ad), nil
+}
+
+func (r *MemRepo) AddRevision(ctx context.Context, rev *ads.Revision) (*ads.Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := *rev
+	c.ID = r.nextRevID
+	c.DateCreated = time.Now().UTC()
+	r.revisions[c.AdID] = append(r.revisions[c.AdID], &c)
+	r.nextRevID++
+	res := c
+	return &res, nil
+}
+
+func (r *MemRepo) ListRevisions(ctx context.Context, AdID int64, UserID int64) ([]*ads.Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ad, ok := r.ads[AdID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	if ad.Deleted {
+		return nil, ErrWasDeleted
+	}
+	if ad.AuthorID != UserID {
+		return nil, ErrNotAuthor
+	}
+	res := make([]*ads.Revision, 0, len(r.revisions[AdID]))
+	for _, rev := range r.revisions[AdID] {
+		c := *rev
+		res = append(res, &c)
+	}
+	return res, nil
+}
+
+func (r *MemRepo) GetRevision(ctx context.Context, AdID int64, ID int64) (*ads.Revision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rev := range r.revisions[AdID] {
+		if rev.ID == ID {
+			c := *rev
+			return &c, nil
+		}
+	}
+	return nil, ErrNotCreated
+}
+
+func (r *MemRepo) ListImages(ctx context.Context, AdID int64, UserID int64) ([]*ads.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ad, err := r.authorAd(AdID, UserID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*ads.Image, 0, len(ad.Images))
+	for _, img := range ad.Images {
+		res = append(res, &img)
+	}
+	return res, nil
+}
+
+func (r *MemRepo) AddImage(ctx context.Context, img *ads.Image) (*ads.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ad, ok := r.ads[img.AdID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	c := *img
+	c.ID = r.nextImgID
+	c.Position = 0
+	if n := len(ad.Images); n > 0 {
+		c.Position = ad.Images[n-1].Position + 1
+	}
+	ad.Images = append(ad.Images, c)
+	r.nextImgID++
+	return &c, nil
+}
+
+func (r *MemRepo) DeleteImage(ctx context.Context, AdID int64, ID int64) (*ads.Image, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ad, ok := r.ads[AdID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	i := slices.IndexFunc(ad.Images, func(img ads.Image) bool { return img.ID == ID })
+	if i < 0 {
+		return nil, ErrNotCreated
+	}
+	img := ad.Images[i]
+	ad.Images = slices.Delete(ad.Images, i, i+1)
+	return &img, nil
+}
+
+func (r *MemRepo) ReorderImages(ctx context.Context, AdID int64, IDs []int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ad, ok := r.ads[AdID]
+	if !ok {
+		return ErrNotCreated
+	}
+	for i := range ad.Images {
+		if pos := slices.Index(IDs, ad.Images[i].ID); pos >= 0 {
+			ad.Images[i].Position = pos
+		}
+	}
+	slices.SortStableFunc(ad.Images, func(a, b ads.Image) int { return cmp.Compare(a.Position, b.Position) })
+	return nil
+}
+
+func (r *MemRepo) CreateUser(ctx context.Context, Name string) (*ads.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user := &ads.User{ID: r.nextUserID, Name: Name, Role: ads.RoleUser, DateCreated: time.Now().UTC()}
+	r.users[user.ID] = user
+	r.nextUserID++
+	return copyUser(user), nil
+}
+
+func (r *MemRepo) CreateAccount(ctx context.Context, Name string, Email string, PasswordHash []byte) (*ads.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Email == Email {
+			return nil, ErrEmailExists
+		}
+	}
+	user := &ads.User{ID: r.nextUserID, Name: Name, Email: Email, Role: ads.RoleUser, DateCreated: time.Now().UTC()}
+	r.users[user.ID] = user
+	r.passwords[user.ID] = PasswordHash
+	r.nextUserID++
+	return copyUser(user), nil
+}
+
+func (r *MemRepo) GetCredentials(ctx context.Context, Email string) (int64, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, user := range r.users {
+		if user.Email == Email && !user.Deleted {
+			return user.ID, r.passwords[user.ID], nil
+		}
+	}
+	return 0, nil, nil
+}
+
+func (r *MemRepo) AddRefreshToken(ctx context.Context, ID string, UserID int64, ExpiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refresh[ID] = &refreshToken{UserID: UserID, ExpiresAt: ExpiresAt}
+	return nil
+}
+
+func (r *MemRepo) RevokeRefreshToken(ctx context.Context, ID string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tok, ok := r.refresh[ID]
+	if !ok || tok.Revoked {
+		return false, nil
+	}
+	tok.Revoked = true
+	return tok.ExpiresAt.After(time.Now()), nil
+}
+
+func (r *MemRepo) RevokeRefreshTokens(ctx context.Context, UserID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tok := range r.refresh {
+		if tok.UserID == UserID {
+			tok.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (r *MemRepo) AddAPIKey(ctx context.Context, Key *ads.APIKey, Hash []byte) (*ads.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[Key.UserID]; !ok {
+		return nil, ErrNotCreated
+	}
+	c := copyAPIKey(Key)
+	c.ID = r.nextKeyID
+	c.DateCreated = time.Now().UTC()
+	r.apiKeys[c.ID] = c
+	r.keyHashes[c.ID] = Hash
+	r.nextKeyID++
+	return copyAPIKey(c), nil
+}
+
+func (r *MemRepo) ListAPIKeys(ctx context.Context, UserID int64) ([]*ads.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*ads.APIKey, 0)
+	for _, key := range r.apiKeys {
+		if key.UserID == UserID {
+			res = append(res, copyAPIKey(key))
+		}
+	}
+	slices.SortFunc(res, func(a, b *ads.APIKey) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return res, nil
+}
+
+func (r *MemRepo) RevokeAPIKey(ctx context.Context, UserID int64, ID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, ok := r.apiKeys[ID]
+	if !ok || key.UserID != UserID {
+		return ErrNotCreated
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+	}
+	return nil
+}
+
+func (r *MemRepo) RevokeAPIKeys(ctx context.Context, UserID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	for _, key := range r.apiKeys {
+		if key.UserID == UserID && key.RevokedAt == nil {
+			key.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *MemRepo) UseAPIKey(ctx context.Context, Hash []byte) (*ads.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, hash := range r.keyHashes {
+		key := r.apiKeys[id]
+		if key.RevokedAt != nil || !bytes.Equal(hash, Hash) {
+			continue
+		}
+		now := time.Now().UTC()
+		key.LastUsedAt = &now
+		return copyAPIKey(key), nil
+	}
+	return nil, nil
+}
+
+func (r *MemRepo) GetUser(ctx context.Context, ID int64) (*ads.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	user, ok := r.users[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	if user.Deleted {
+		return nil, ErrWasDeleted
+	}
+	return copyUser(user), nil
+}
+
+func (r *MemRepo) DeleteUser(ctx context.Context, ID int64, ActorID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[ID]
+	if !ok {
+		return ErrNotCreated
+	}
+	if user.Deleted {
+		return ErrWasDeleted
+	}
+	now := time.Now().UTC()
+	user.Deleted = true
+	user.DeletedAt = &now
+	user.DeletedBy = &ActorID
+	r.countFavorites(ID, -1)
+	return nil
+}
+
+func (r *MemRepo) RestoreUser(ctx context.Context, ID int64) (*ads.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	if !user.Deleted {
+		return nil, ErrNotDeleted
+	}
+	r.countFavorites(ID, 1)
+	user.Deleted = false
+	user.DeletedAt = nil
+	user.DeletedBy = nil
+	return copyUser(user), nil
+}
+
+func (r *MemRepo) UpdateUser(ctx context.Context, in *ads.User) (*ads.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[in.ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	if user.Deleted {
+		return nil, ErrWasDeleted
+	}
+	if in.Email != "" {
+		for _, other := range r.users {
+			if other.ID != in.ID && other.Email == in.Email {
+				return nil, ErrEmailExists
+			}
+		}
+	}
+	user.Name = in.Name
+	user.Email = in.Email
+	user.Phone = in.Phone
+	user.DisplayName = in.DisplayName
+	user.AvatarURL = in.AvatarURL
+	user.About = in.About
+	return copyUser(user), nil
+}
+
+func (r *MemRepo) ListUsers(ctx context.Context, filter ads.UserFilter) ([]*ads.User, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	query := strings.ToLower(filter.Query)
+	var res = make([]*ads.User, 0)
+	for _, user := range r.users {
+		if filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+		if filter.Deleted != nil && user.Deleted != *filter.Deleted {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(user.Name), query) && !strings.Contains(user.Email, query) {
+			continue
+		}
+		res = append(res, copyUser(user))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		switch filter.Sort {
+		case ads.UserSortDateCreated:
+			if !res[i].DateCreated.Equal(res[j].DateCreated) {
+				return res[i].DateCreated.Before(res[j].DateCreated)
+			}
+		case ads.UserSortDateCreatedDesc:
+			if !res[i].DateCreated.Equal(res[j].DateCreated) {
+				return res[i].DateCreated.After(res[j].DateCreated)
+			}
+			return res[i].ID > res[j].ID
+		}
+		return res[i].ID < res[j].ID
+	})
+	page := paginate(res, filter.Limit, filter.Offset)
+	for _, user := range page {
+		for _, ad := range r.ads {
+			if ad.AuthorID == user.ID && ad.Published && !ad.Deleted {
+				user.ActiveAds++
+			}
+		}
+	}
+	return page, int64(len(res)), nil
+}
+
+func (r *MemRepo) SetUserRole(ctx context.Context, ID int64, Role ads.Role) (*ads.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	if user.Deleted {
+		return nil, ErrWasDeleted
+	}
+	user.Role = Role
+	return copyUser(user), nil
+}
+
+// countFavorites adds delta to the favorites counters of the ads the user has
+// in favorites, as only favorites of users who are not deleted are counted.
+// The caller must hold the lock.
+func (r *MemRepo) countFavorites(UserID int64, delta int64) {
+	for adID := range r.favorites[UserID] {
+		r.ads[adID].Favorites += delta
+	}
+}
+
+func (r *MemRepo) AddFavorite(ctx context.Context, UserID int64, AdID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ad, ok := r.ads[AdID]
+	if !ok {
+		return ErrNotCreated
+	}
+	if _, ok := r.users[UserID]; !ok {
+		return ErrNotCreated
+	}
+	if r.favorites[UserID][AdID] {
+		return nil
+	}
+	if r.favorites[UserID] == nil {
+		r.favorites[UserID] = make(map[int64]bool)
+	}
+	r.favorites[UserID][AdID] = true
+	if !r.users[UserID].Deleted {
+		ad.Favorites++
+	}
+	return nil
+}
+
+func (r *MemRepo) RemoveFavorite(ctx context.Context, UserID int64, AdID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.favorites[UserID][AdID] {
+		return nil
+	}
+	delete(r.favorites[UserID], AdID)
+	if !r.users[UserID].Deleted {
+		r.ads[AdID].Favorites--
+	}
+	return nil
+}
+
+func (r *MemRepo) GetOrCreateThread(ctx context.Context, AdID int64, BuyerID int64, SellerID int64) (*ads.Thread, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, thread := range r.threads {
+		if thread.AdID == AdID && thread.BuyerID == BuyerID {
+			return r.userThread(thread, BuyerID), nil
+		}
+	}
+	if _, ok := r.ads[AdID]; !ok {
+		return nil, ErrNotCreated
+	}
+	now := time.Now().UTC()
+	thread := &ads.Thread{ID: r.nextThrID, AdID: AdID, BuyerID: BuyerID, SellerID: SellerID, DateCreated: now, DateUpdated: now}
+	r.threads[thread.ID] = thread
+	r.nextThrID++
+	return r.userThread(thread, BuyerID), nil
+}
+
+func (r *MemRepo) GetThread(ctx context.Context, ID int64, UserID int64) (*ads.Thread, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	thread, ok := r.threads[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	return r.userThread(thread, UserID), nil
+}
+
+func (r *MemRepo) ListThreads(ctx context.Context, UserID int64, Limit int, Offset int) ([]*ads.Thread, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*ads.Thread, 0)
+	for _, thread := range r.threads {
+		if thread.BuyerID == UserID || thread.SellerID == UserID {
+			res = append(res, r.userThread(thread, UserID))
+		}
+	}
+	slices.SortFunc(res, func(a, b *ads.Thread) int {
+		if c := b.DateUpdated.Compare(a.DateUpdated); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return paginate(res, Limit, Offset), int64(len(res)), nil
+}
+
+// userThread copies the thread with the unread count of UserID.
+// The caller must hold the lock.
+func (r *MemRepo) userThread(thread *ads.Thread, UserID int64) *ads.Thread {
+	c := *thread
+	c.Unread = 0
+	for _, msg := range r.messages[thread.ID] {
+		if msg.SenderID != UserID && msg.ReadAt == nil {
+			c.Unread++
+		}
+	}
+	return &c
+}
+
+func (r *MemRepo) AddMessage(ctx context.Context, msg *ads.Message) (*ads.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	thread, ok := r.threads[msg.ThreadID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	c := copyMessage(msg)
+	c.ID = r.nextMsgID
+	c.DateCreated = time.Now().UTC()
+	r.messages[c.ThreadID] = append(r.messages[c.ThreadID], c)
+	r.nextMsgID++
+	thread.DateUpdated = c.DateCreated
+	return copyMessage(c), nil
+}
+
+func (r *MemRepo) ListMessages(ctx context.Context, ThreadID int64, Limit int, Offset int) ([]*ads.Message, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	msgs := r.messages[ThreadID]
+	res := make([]*ads.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		res = append(res, copyMessage(msg))
+	}
+	return paginate(res, Limit, Offset), int64(len(res)), nil
+}
+
+func (r *MemRepo) MarkRead(ctx context.Context, ThreadID int64, UserID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	for _, msg := range r.messages[ThreadID] {
+		if msg.SenderID != UserID && msg.ReadAt == nil {
+			msg.ReadAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *MemRepo) CountUnread(ctx context.Context, UserID int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var n int64
+	for _, thread := range r.threads {
+		if thread.BuyerID == UserID || thread.SellerID == UserID {
+			n += r.userThread(thread, UserID).Unread
+		}
+	}
+	return n, nil
+}
+
+func (r *MemRepo) AddReport(ctx context.Context, rep *ads.Report) (*ads.Report, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.ads[rep.AdID]; !ok {
+		return nil, ErrNotCreated
+	}
+	for _, other := range r.reports {
+		if other.AdID == rep.AdID && other.ReporterID == rep.ReporterID && other.Status == ads.ReportOpen {
+			return nil, ErrAlreadyReported
+		}
+	}
+	c := copyReport(rep)
+	c.ID = r.nextRepID
+	c.Status = ads.ReportOpen
+	c.DateCreated = time.Now().UTC()
+	r.reports[c.ID] = c
+	r.nextRepID++
+	return copyReport(c), nil
+}
+
+func (r *MemRepo) ListReportGroups(ctx context.Context, Limit int, Offset int) ([]*ads.ReportGroup, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	byAd := make(map[int64]*ads.ReportGroup)
+	for _, rep := range r.reports {
+		if rep.Status != ads.ReportOpen {
+			continue
+		}
+		group, ok := byAd[rep.AdID]
+		if !ok {
+			group = &ads.ReportGroup{AdID: rep.AdID}
+			byAd[rep.AdID] = group
+		}
+		group.Reports = append(group.Reports, *copyReport(rep))
+	}
+	res := slices.Collect(maps.Values(byAd))
+	for _, group := range res {
+		slices.SortFunc(group.Reports, func(a, b ads.Report) int {
+			return cmp.Compare(a.ID, b.ID)
+		})
+	}
+	// The most reported ads come first, then the ones reported earlier.
+	slices.SortFunc(res, func(a, b *ads.ReportGroup) int {
+		if c := cmp.Compare(len(b.Reports), len(a.Reports)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Reports[0].ID, b.Reports[0].ID)
+	})
+	return paginate(res, Limit, Offset), int64(len(res)), nil
+}
+
+func (r *MemRepo) ResolveReports(ctx context.Context, AdID int64, ModeratorID int64, Resolution ads.ReportResolution) ([]*ads.Report, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	res := make([]*ads.Report, 0)
+	for _, rep := range r.reports {
+		if rep.AdID != AdID || rep.Status != ads.ReportOpen {
+			continue
+		}
+		rep.Status = ads.ReportResolved
+		rep.Resolution = Resolution
+		rep.ResolvedBy = &ModeratorID
+		rep.ResolvedAt = &now
+		res = append(res, copyReport(rep))
+	}
+	slices.SortFunc(res, func(a, b *ads.Report) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return res, nil
+}
+
+func (r *MemRepo) AddNotification(ctx context.Context, n *ads.Notification) (*ads.Notification, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[n.UserID]; !ok {
+		return nil, ErrNotCreated
+	}
+	c := *n
+	c.ID = r.nextNtfID
+	c.DateCreated = time.Now().UTC()
+	r.notices[c.UserID] = append(r.notices[c.UserID], &c)
+	r.nextNtfID++
+	res := c
+	return &res, nil
+}
+
+func (r *MemRepo) ListNotifications(ctx context.Context, UserID int64, Limit int, Offset int) ([]*ads.Notification, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	notices := r.notices[UserID]
+	res := make([]*ads.Notification, 0, len(notices))
+	for i := len(notices) - 1; i >= 0; i-- {
+		c := *notices[i]
+		res = append(res, &c)
+	}
+	return paginate(res, Limit, Offset), int64(len(res)), nil
+}
+
+// categoryExists reports whether ID is nil or a stored category.
+// The caller must hold the lock.
+func (r *MemRepo) categoryExists(ID *int64) bool {
+	if ID == nil {
+		return true
+	}
+	_, ok := r.categories[*ID]
+	return ok
+}
+
+// subtree returns the ids of the category and all its descendants.
+// The caller must hold the lock.
+func (r *MemRepo) subtree(ID int64) map[int64]bool {
+	res := map[int64]bool{ID: true}
+	for grown := true; grown; {
+		grown = false
+		for _, cat := range r.categories {
+			if cat.ParentID != nil && res[*cat.ParentID] && !res[cat.ID] {
+				res[cat.ID] = true
+				grown = true
+			}
+		}
+	}
+	return res
+}
+
+// siblingNamed reports whether another child of ParentID already has the name.
+// The caller must hold the lock.
+func (r *MemRepo) siblingNamed(ID int64, Name string, ParentID *int64) bool {
+	for _, cat := range r.categories {
+		if cat.ID != ID && equalPtr(cat.ParentID, ParentID) && strings.EqualFold(cat.Name, Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemRepo) CreateCategory(ctx context.Context, Name string, ParentID *int64) (*ads.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.categoryExists(ParentID) {
+		return nil, ErrUnknownCategory
+	}
+	if r.siblingNamed(-1, Name, ParentID) {
+		return nil, ErrCategoryExists
+	}
+	cat := &ads.Category{ID: r.nextCatID, ParentID: copyPtr(ParentID), Name: Name, DateCreated: time.Now().UTC()}
+	r.categories[cat.ID] = cat
+	r.nextCatID++
+	return copyCategory(cat), nil
+}
+
+func (r *MemRepo) GetCategory(ctx context.Context, ID int64) (*ads.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cat, ok := r.categories[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	return copyCategory(cat), nil
+}
+
+func (r *MemRepo) ListCategories(ctx context.Context) ([]*ads.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*ads.Category, 0, len(r.categories))
+	for _, cat := range r.categories {
+		res = append(res, copyCategory(cat))
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+func (r *MemRepo) UpdateCategory(ctx context.Context, ID int64, Name string, ParentID *int64) (*ads.Category, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cat, ok := r.categories[ID]
+	if !ok {
+		return nil, ErrNotCreated
+	}
+	if !r.categoryExists(ParentID) {
+		return nil, ErrUnknownCategory
+	}
+	if r.siblingNamed(ID, Name, ParentID) {
+		return nil, ErrCategoryExists
+	}
+	cat.Name = Name
+	cat.ParentID = copyPtr(ParentID)
+	return copyCategory(cat), nil
+}
+
+func (r *MemRepo) DeleteCategory(ctx context.Context, ID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.categories[ID]; !ok {
+		return ErrNotCreated
+	}
+	// Like the foreign keys in Postgres, deleted ads also keep the category in use.
+	for _, cat := range r.categories {
+		if cat.ParentID != nil && *cat.ParentID == ID {
+			return ErrCategoryNotEmpty
+		}
+	}
+	for _, ad := range r.ads {
+		if ad.CategoryID != nil && *ad.CategoryID == ID {
+			return ErrCategoryNotEmpty
+		}
+	}
+	delete(r.categories, ID)
+	return nil
+}
+
+func priceMatches(ad *ads.Ad, filter ads.AdFilter) bool {
+	if filter.Currency != "" && ad.Currency != filter.Currency {
+		return false
+	}
+	if filter.MinPrice != nil && (ad.Price == nil || *ad.Price < *filter.MinPrice) {
+		return false
+	}
+	if filter.MaxPrice != nil && (ad.Price == nil || *ad.Price > *filter.MaxPrice) {
+		return false
+	}
+	return true
+}
+
+// comparePrices orders prices like ORDER BY price [DESC] NULLS LAST.
+func comparePrices(a, b *int64, desc bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	case desc:
+		return cmp.Compare(*b, *a)
+	default:
+		return cmp.Compare(*a, *b)
+	}
+}
+
+// hasTags reports whether tags contain all of the wanted ones.
+func hasTags(tags []string, wanted []string) bool {
+	for _, w := range wanted {
+		if !slices.Contains(tags, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// touch mirrors the update trigger on the adds table.
+func touch(ad *ads.Ad) {
+	ad.DateUpdated = time.Now().UTC()
+	ad.Version++
+}
+
+func paginate[T any](items []T, limit int, offset int) []T {
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// copyAd and copyUser detach stored records from callers,
+// so nobody can mutate the repository state without holding the lock.
+func copyAd(ad *ads.Ad) *ads.Ad {
+	c := *ad
+	c.DeletedAt = copyPtr(ad.DeletedAt)
+	c.DeletedBy = copyPtr(ad.DeletedBy)
+	c.CategoryID = copyPtr(ad.CategoryID)
+	c.Price = copyPtr(ad.Price)
+	c.PublishAt = copyPtr(ad.PublishAt)
+	c.ExpiresAt = copyPtr(ad.ExpiresAt)
+	c.Tags = append([]string{}, ad.Tags...)
+	c.Images = append([]ads.Image{}, ad.Images...)
+	return &c
+}
+
+func copyMessage(msg *ads.Message) *ads.Message {
+	c := *msg
+	c.ReadAt = copyPtr(msg.ReadAt)
+	return &c
+}
+
+func copyReport(rep *ads.Report) *ads.Report {
+	c := *rep
+	c.ResolvedBy = copyPtr(rep.ResolvedBy)
+	c.ResolvedAt = copyPtr(rep.ResolvedAt)
+	return &c
+}
+
+func copyUser(user *ads.User) *ads.User {
+	c := *user
+	c.DeletedAt = copyPtr(user.DeletedAt)
+	c.DeletedBy = copyPtr(user.DeletedBy)
+	return &c
+}
+
+func copyCategory(cat *ads.Category) *ads.Category {
+	c := *cat
+	c.ParentID = copyPtr(cat.ParentID)
+	return &c
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func copyAPIKey(key *ads.APIKey) *ads.APIKey {
+	c := *key
+	c.LastUsedAt = copyPtr(key.LastUsedAt)
+	c.RevokedAt = copyPtr(key.RevokedAt)
+	return &c
+}
+
+func copyPtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// New returns an in-memory repository. It is used by tests and
+// for local runs without a database (STORAGE=memory).
+func New() app.Repository {
+	return &MemRepo{
+		mu: new(sync.RWMutex),
+		memState: &memState{
+			ads:        make(map[int64]*ads.Ad),
+			users:      make(map[int64]*ads.User),
+			revisions:  make(map[int64][]*ads.Revision),
+			categories: make(map[int64]*ads.Category),
+			favorites:  make(map[int64]map[int64]bool),
+			threads:    make(map[int64]*ads.Thread),
+			messages:   make(map[int64][]*ads.Message),
+			reports:    make(map[int64]*ads.Report),
+			notices:    make(map[int64][]*ads.Notification),
+			passwords:  make(map[int64][]byte),
+			refresh:    make(map[string]*refreshToken),
+			apiKeys:    make(map[int64]*ads.APIKey),
+			keyHashes:  make(map[int64][]byte),
+		},
+	}
+}
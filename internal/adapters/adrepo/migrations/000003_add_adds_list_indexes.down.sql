@@ -0,0 +1,2 @@
+drop index if exists adds_published_idx;
+drop index if exists adds_author_id_idx;
@@ -0,0 +1,2 @@
+create index if not exists adds_author_id_idx on adds (author_id);
+create index if not exists adds_published_idx on adds (published, id);
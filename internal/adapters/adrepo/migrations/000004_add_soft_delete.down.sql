@@ -0,0 +1,7 @@
+drop index if exists adds_not_deleted_idx;
+
+alter table users drop column if exists deleted_by;
+alter table users drop column if exists deleted_at;
+
+alter table adds drop column if exists deleted_by;
+alter table adds drop column if exists deleted_at;
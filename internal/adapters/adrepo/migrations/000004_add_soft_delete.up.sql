@@ -0,0 +1,7 @@
+alter table adds add column if not exists deleted_at timestamp;
+alter table adds add column if not exists deleted_by int;
+
+alter table users add column if not exists deleted_at timestamp;
+alter table users add column if not exists deleted_by int;
+
+create index if not exists adds_not_deleted_idx on adds (id) where deleted_at is null;
@@ -0,0 +1,9 @@
+create or replace function update_adds_timestamp()
+    returns trigger as $$
+begin
+    new.date_updated = now();
+    return new;
+end;
+$$ language plpgsql;
+
+alter table adds drop column if exists version;
@@ -0,0 +1,10 @@
+alter table adds add column if not exists version bigint not null default 1;
+
+create or replace function update_adds_timestamp()
+    returns trigger as $$
+begin
+    new.date_updated = now();
+    new.version = old.version + 1;
+    return new;
+end;
+$$ language plpgsql;
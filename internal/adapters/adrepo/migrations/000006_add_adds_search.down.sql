@@ -0,0 +1,3 @@
+drop index if exists adds_search_vector_idx;
+
+alter table adds drop column if exists search_vector;
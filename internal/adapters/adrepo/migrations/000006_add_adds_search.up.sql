@@ -0,0 +1,9 @@
+alter table adds add column if not exists search_vector tsvector
+    generated always as (
+        setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('russian', coalesce(text, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(text, '')), 'B')
+    ) stored;
+
+create index if not exists adds_search_vector_idx on adds using gin (search_vector);
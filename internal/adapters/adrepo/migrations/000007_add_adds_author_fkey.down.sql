@@ -0,0 +1 @@
+alter table adds drop constraint if exists adds_author_id_fkey;
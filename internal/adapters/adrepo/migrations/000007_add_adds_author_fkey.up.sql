@@ -0,0 +1,4 @@
+-- not valid: ads created before the constraint may reference missing users,
+-- the constraint is enforced for all new and updated rows.
+alter table adds
+    add constraint adds_author_id_fkey foreign key (author_id) references users (id) not valid;
@@ -0,0 +1,14 @@
+create table if not exists ad_revisions (
+    id serial primary key,
+    ad_id int not null references adds (id) on delete cascade,
+    actor_id int not null,
+    old_title varchar(100) not null,
+    new_title varchar(100) not null,
+    old_text varchar(500) not null,
+    new_text varchar(500) not null,
+    old_published bool not null,
+    new_published bool not null,
+    date_created timestamp default current_timestamp
+);
+
+create index if not exists ad_revisions_ad_id_idx on ad_revisions (ad_id, id);
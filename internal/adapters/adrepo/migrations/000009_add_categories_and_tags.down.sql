@@ -0,0 +1,7 @@
+drop index if exists adds_tags_idx;
+drop index if exists adds_category_id_idx;
+
+alter table adds drop column if exists tags;
+alter table adds drop column if exists category_id;
+
+drop table if exists categories;
@@ -0,0 +1,16 @@
+create table if not exists categories (
+    id serial primary key,
+    parent_id int references categories (id) on delete restrict,
+    name varchar(100) not null,
+    date_created timestamp default current_timestamp
+);
+
+-- names are unique among siblings; root categories have parent 0
+create unique index if not exists categories_parent_name_idx on categories (coalesce(parent_id, 0), lower(name));
+
+alter table adds add column if not exists category_id int
+    constraint adds_category_id_fkey references categories (id) on delete restrict;
+alter table adds add column if not exists tags text[] not null default '{}';
+
+create index if not exists adds_category_id_idx on adds (category_id);
+create index if not exists adds_tags_idx on adds using gin (tags);
@@ -0,0 +1,7 @@
+drop index if exists adds_currency_price_idx;
+
+alter table adds drop constraint if exists adds_price_currency_check;
+alter table adds drop constraint if exists adds_price_check;
+
+alter table adds drop column if exists currency;
+alter table adds drop column if exists price;
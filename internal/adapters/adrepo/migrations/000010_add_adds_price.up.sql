@@ -0,0 +1,7 @@
+alter table adds add column if not exists price bigint;
+alter table adds add column if not exists currency char(3);
+
+alter table adds add constraint adds_price_check check (price >= 0);
+alter table adds add constraint adds_price_currency_check check ((price is null) = (currency is null));
+
+create index if not exists adds_currency_price_idx on adds (currency, price) where deleted_at is null;
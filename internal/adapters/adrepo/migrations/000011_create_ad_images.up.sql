@@ -0,0 +1,11 @@
+create table if not exists ad_images (
+    id serial primary key,
+    ad_id int not null references adds (id) on delete cascade,
+    key varchar(200) not null unique,
+    content_type varchar(50) not null,
+    size bigint not null,
+    position int not null,
+    date_created timestamp default current_timestamp
+);
+
+create index if not exists ad_images_ad_id_idx on ad_images (ad_id, position);
@@ -0,0 +1,5 @@
+drop index if exists adds_expires_at_idx;
+drop index if exists adds_publish_at_idx;
+
+alter table adds drop column if exists expires_at;
+alter table adds drop column if exists publish_at;
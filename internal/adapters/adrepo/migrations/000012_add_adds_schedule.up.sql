@@ -0,0 +1,6 @@
+alter table adds add column if not exists publish_at timestamptz;
+alter table adds add column if not exists expires_at timestamptz;
+
+-- The scheduler looks up ads whose time has come.
+create index if not exists adds_publish_at_idx on adds (publish_at) where publish_at is not null and deleted_at is null;
+create index if not exists adds_expires_at_idx on adds (expires_at) where expires_at is not null and deleted_at is null;
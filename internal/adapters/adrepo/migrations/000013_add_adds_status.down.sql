@@ -0,0 +1,9 @@
+drop index if exists adds_pending_review_idx;
+
+alter table ad_revisions drop column if exists new_status;
+alter table ad_revisions drop column if exists old_status;
+
+alter table adds drop constraint if exists adds_published_status_check;
+alter table adds drop constraint if exists adds_status_check;
+alter table adds drop column if exists rejection_reason;
+alter table adds drop column if exists status;
@@ -0,0 +1,21 @@
+alter table adds add column if not exists status varchar(20) not null default 'draft';
+alter table adds add column if not exists rejection_reason varchar(500);
+
+update adds set status = 'published' where published;
+update adds set published = false where published is null;
+
+alter table adds add constraint adds_status_check
+    check (status in ('draft', 'pending_review', 'approved', 'rejected', 'published', 'archived'));
+-- published is kept for the list indexes and is derived from status.
+alter table adds add constraint adds_published_status_check check (published = (status = 'published'));
+
+alter table ad_revisions add column if not exists old_status varchar(20);
+alter table ad_revisions add column if not exists new_status varchar(20);
+
+update ad_revisions set
+    old_status = case when old_published then 'published' else 'draft' end,
+    new_status = case when new_published then 'published' else 'draft' end
+where old_status is null;
+
+-- Moderators take ads from the queue oldest first.
+create index if not exists adds_pending_review_idx on adds (id) where status = 'pending_review' and deleted_at is null;
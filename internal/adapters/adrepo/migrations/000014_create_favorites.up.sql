@@ -0,0 +1,9 @@
+create table if not exists favorites (
+    user_id int not null references users (id) on delete cascade,
+    ad_id int not null references adds (id) on delete cascade,
+    date_created timestamp default current_timestamp,
+    primary key (user_id, ad_id)
+);
+
+-- The number of favorites is counted for every ad.
+create index if not exists favorites_ad_id_idx on favorites (ad_id);
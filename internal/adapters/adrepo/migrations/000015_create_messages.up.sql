@@ -0,0 +1,25 @@
+create table if not exists threads (
+    id serial primary key,
+    ad_id int not null references adds (id) on delete cascade,
+    buyer_id int not null references users (id) on delete cascade,
+    seller_id int not null references users (id) on delete cascade,
+    date_created timestamp default current_timestamp,
+    date_updated timestamp default current_timestamp,
+    unique (ad_id, buyer_id)
+);
+
+create index if not exists threads_buyer_id_idx on threads (buyer_id, date_updated);
+create index if not exists threads_seller_id_idx on threads (seller_id, date_updated);
+
+create table if not exists messages (
+    id serial primary key,
+    thread_id int not null references threads (id) on delete cascade,
+    sender_id int not null references users (id) on delete cascade,
+    text varchar(2000) not null,
+    read_at timestamp,
+    date_created timestamp default current_timestamp
+);
+
+create index if not exists messages_thread_id_idx on messages (thread_id, id);
+-- Unread messages are counted for every thread.
+create index if not exists messages_unread_idx on messages (thread_id) where read_at is null;
@@ -0,0 +1,27 @@
+-- Times are timestamptz, because open reports are listed as json
+-- and a time without a zone is not valid RFC 3339. Notifications keep
+-- the time with the zone too, so that it does not depend on the server.
+create table if not exists reports (
+    id serial primary key,
+    ad_id int not null references adds (id) on delete cascade,
+    reporter_id int not null references users (id) on delete cascade,
+    reason varchar(20) not null check (reason in ('scam', 'illegal', 'spam', 'offensive', 'other')),
+    comment varchar(1000) not null default '',
+    status varchar(20) not null default 'open' check (status in ('open', 'resolved')),
+    resolution varchar(20) check (resolution in ('dismissed', 'unpublished', 'deleted')),
+    resolved_by int references users (id) on delete set null,
+    resolved_at timestamptz,
+    date_created timestamptz default current_timestamp
+);
+
+-- A user can have one open report per ad; the queue groups open reports by ad.
+create unique index if not exists reports_open_idx on reports (ad_id, reporter_id) where status = 'open';
+
+create table if not exists notifications (
+    id serial primary key,
+    user_id int not null references users (id) on delete cascade,
+    text varchar(500) not null,
+    date_created timestamptz default current_timestamp
+);
+
+create index if not exists notifications_user_id_idx on notifications (user_id, id);
@@ -0,0 +1,4 @@
+drop table if exists refresh_tokens;
+drop index if exists users_email_idx;
+alter table users drop column if exists password_hash;
+alter table users drop column if exists email;
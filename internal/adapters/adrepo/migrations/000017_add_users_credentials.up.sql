@@ -0,0 +1,15 @@
+alter table users add column if not exists email varchar(254);
+alter table users add column if not exists password_hash bytea;
+
+-- Users created before registration existed have no email; the app stores emails in lower case.
+create unique index if not exists users_email_idx on users (email);
+
+create table if not exists refresh_tokens (
+    id varchar(64) primary key,
+    user_id int not null references users (id) on delete cascade,
+    expires_at timestamptz not null,
+    revoked_at timestamptz,
+    date_created timestamptz default current_timestamp
+);
+
+create index if not exists refresh_tokens_user_id_idx on refresh_tokens (user_id) where revoked_at is null;
@@ -0,0 +1,15 @@
+create table if not exists api_keys (
+    id serial primary key,
+    user_id int not null references users (id) on delete cascade,
+    name varchar(100) not null,
+    prefix varchar(20) not null,
+    scope varchar(20) not null check (scope in ('read', 'ads:write')),
+    -- sha256 of the key; keys are random, so a slow hash is not needed.
+    key_hash bytea not null,
+    last_used_at timestamptz,
+    revoked_at timestamptz,
+    date_created timestamptz default current_timestamp
+);
+
+create unique index if not exists api_keys_key_hash_idx on api_keys (key_hash);
+create index if not exists api_keys_user_id_idx on api_keys (user_id);
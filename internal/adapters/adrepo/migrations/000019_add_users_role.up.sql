@@ -0,0 +1,2 @@
+alter table users add column if not exists role varchar(20) not null default 'user'
+    check (role in ('user', 'moderator', 'admin'));
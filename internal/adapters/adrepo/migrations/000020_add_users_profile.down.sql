@@ -0,0 +1,4 @@
+alter table users drop column if exists about;
+alter table users drop column if exists avatar_url;
+alter table users drop column if exists display_name;
+alter table users drop column if exists phone;
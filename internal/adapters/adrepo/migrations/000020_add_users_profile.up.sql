@@ -0,0 +1,4 @@
+alter table users add column if not exists phone varchar(16) not null default '';
+alter table users add column if not exists display_name varchar(100) not null default '';
+alter table users add column if not exists avatar_url varchar(500) not null default '';
+alter table users add column if not exists about varchar(1000) not null default '';
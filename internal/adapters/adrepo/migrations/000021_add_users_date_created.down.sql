@@ -0,0 +1,2 @@
+drop index if exists users_date_created_idx;
+alter table users drop column if exists date_created;
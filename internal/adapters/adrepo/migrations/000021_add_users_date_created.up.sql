@@ -0,0 +1,4 @@
+-- Users registered before the column existed get the time of the migration.
+alter table users add column if not exists date_created timestamptz not null default current_timestamp;
+
+create index if not exists users_date_created_idx on users (date_created);
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres" // Добавьте этот импорт
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/jackc/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"homework9/internal/adapters/adrepo/migrations"
+	"time"
 )
 
 type PgConfig struct {
@@ -16,22 +18,117 @@ type PgConfig struct {
 	Database string `env:"DATABASE" envDefault:"postgres"`
 	Username string `env:"USERNAME" envDefault:"mac"`
 	Password string `env:"PASSWORD" envDefault:"1234"`
+
+	AutoMigrate bool `env:"AUTO_MIGRATE" envDefault:"true"` // run "migrate up" on server startup
+
+	MaxConns          int32         `env:"POOL_MAX_CONNS" envDefault:"10"`
+	MinConns          int32         `env:"POOL_MIN_CONNS" envDefault:"2"`
+	MaxConnLifetime   time.Duration `env:"POOL_MAX_CONN_LIFETIME" envDefault:"1h"`
+	MaxConnIdleTime   time.Duration `env:"POOL_MAX_CONN_IDLE_TIME" envDefault:"30m"`
+	HealthCheckPeriod time.Duration `env:"POOL_HEALTH_CHECK_PERIOD" envDefault:"30s"`
+	ConnectAttempts   int           `env:"CONNECT_ATTEMPTS" envDefault:"5"`
+	ConnectRetryDelay time.Duration `env:"CONNECT_RETRY_DELAY" envDefault:"2s"`
 }
 
-func New(ctx context.Context, cfg PgConfig) (*pgx.Conn, error) {
-	dbUrl := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
+func (cfg PgConfig) URL() string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
 		cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
-	conn, err := pgx.Connect(ctx, dbUrl)
+}
+
+// New creates a connection pool and, if cfg.AutoMigrate is set, applies all
+// pending migrations. Broken connections are dropped by the pool health check
+// and replaced on demand, so a restart of the database does not take the service down.
+func New(ctx context.Context, cfg PgConfig) (*pgxpool.Pool, error) {
+	poolCfg, err := pgxpool.ParseConfig(cfg.URL())
 	if err != nil {
+		return nil, fmt.Errorf("unable to parse database config: %w", err)
+	}
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 && cfg.MinConns <= poolCfg.MaxConns {
+		poolCfg.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+	if err := ping(ctx, pool, cfg.ConnectAttempts, cfg.ConnectRetryDelay); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
-	migrationPath := "file://internal/adapters/adrepo/migrations"
-	m, err := migrate.New(migrationPath, dbUrl)
+
+	if cfg.AutoMigrate {
+		if err := MigrateUp(cfg); err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
+	return pool, nil
+}
+
+// NewMigrate returns a migrator over the migrations embedded into the binary.
+// The caller must Close it.
+func NewMigrate(cfg PgConfig) (*migrate.Migrate, error) {
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read migrations: %w", err)
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", src, cfg.URL())
 	if err != nil {
 		return nil, fmt.Errorf("unable to create migrations: %w", err)
 	}
+	return m, nil
+}
+
+func MigrateUp(cfg PgConfig) error {
+	m, err := NewMigrate(cfg)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
 	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return nil, fmt.Errorf("unable to run migrations: %w", err)
+		return fmt.Errorf("unable to run migrations: %w", err)
+	}
+	return nil
+}
+
+// MigrateTo migrates up or down to the version. Version 0 means
+// no migrations applied, which Migrate does not accept, so it rolls
+// back all migrations instead.
+func MigrateTo(m *migrate.Migrate, version uint) error {
+	if version == 0 {
+		return m.Down()
+	}
+	return m.Migrate(version)
+}
+
+// ping waits for the database to become available, e.g. while the
+// postgres container is still starting.
+func ping(ctx context.Context, pool *pgxpool.Pool, attempts int, delay time.Duration) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = pool.Ping(ctx); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
 	}
-	return conn, nil
+	return err
 }
@@ -0,0 +1,162 @@
+package adrepo
+
+import (
+	"fmt"
+	"homework9/internal/ads"
+	"strings"
+)
+
+// adQuery collects WHERE conditions and positional arguments for ad and user listings.
+type adQuery struct {
+	where   []string
+	args    []any
+	tsQuery string // full-text query expression, empty if there is no search
+}
+
+func (q *adQuery) arg(v any) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *adQuery) cond(format string, v ...any) {
+	q.where = append(q.where, fmt.Sprintf(format, v...))
+}
+
+func (q *adQuery) whereClause() string {
+	if len(q.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.where, " AND ")
+}
+
+func buildAdQuery(filter ads.AdFilter) *adQuery {
+	q := &adQuery{}
+	q.cond("deleted_at IS NULL")
+	if filter.Pub {
+		q.cond("published")
+	}
+	if filter.Auth != -1 {
+		q.cond("author_id = %s", q.arg(filter.Auth))
+	}
+	if filter.Status != "" {
+		q.cond("status = %s", q.arg(string(filter.Status)))
+	}
+	if filter.Title != "" {
+		q.cond("title = %s", q.arg(filter.Title))
+	}
+	if filter.Category != nil {
+		q.cond("category_id IN (WITH RECURSIVE sub AS (SELECT id FROM categories WHERE id = %s "+
+			"UNION ALL SELECT c.id FROM categories c JOIN sub ON c.parent_id = sub.id) SELECT id FROM sub)", q.arg(*filter.Category))
+	}
+	if filter.FavoritesOf != nil {
+		q.cond("id IN (SELECT ad_id FROM favorites WHERE user_id = %s)", q.arg(*filter.FavoritesOf))
+	}
+	if len(filter.Tags) > 0 {
+		q.cond("tags @> %s::text[]", q.arg(filter.Tags))
+	}
+	if filter.Currency != "" {
+		q.cond("currency = %s", q.arg(filter.Currency))
+	}
+	if filter.MinPrice != nil {
+		q.cond("price >= %s", q.arg(*filter.MinPrice))
+	}
+	if filter.MaxPrice != nil {
+		q.cond("price <= %s", q.arg(*filter.MaxPrice))
+	}
+	if filter.Query != "" {
+		p := q.arg(filter.Query)
+		q.tsQuery = fmt.Sprintf("(websearch_to_tsquery('russian', %s) || websearch_to_tsquery('english', %s))", p, p)
+		q.cond("search_vector @@ %s", q.tsQuery)
+	}
+	return q
+}
+
+// searchColumns selects the rank and the highlighted snippet of a search match.
+func (q *adQuery) searchColumns() string {
+	if q.tsQuery == "" {
+		return "0::real AS rank, '' AS snippet"
+	}
+	return fmt.Sprintf("ts_rank(search_vector, %s) AS rank, ts_headline('russian', %s, %s, '%s') AS snippet",
+		q.tsQuery, escapedDocument, q.tsQuery, headlineOptions)
+}
+
+const headlineOptions = "StartSel=<b>, StopSel=</b>, MaxWords=25, MinWords=10, MaxFragments=2"
+
+// escapedDocument is the searched text escaped as html.EscapeString does,
+// so that the <b></b> of the snippet is its only markup.
+const escapedDocument = "replace(replace(replace(replace(replace(title || ' ' || text, " +
+	`'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+
+// listAdsSQL returns the page query and the count query for the filter
+// together with their arguments. The page query counts the matching ads
+// in the same snapshot; the count query is needed only for an empty page.
+func listAdsSQL(filter ads.AdFilter) (string, []any, string, []any) {
+	q := buildAdQuery(filter)
+	count := "SELECT count(*) FROM adds" + q.whereClause()
+	countArgs := append([]any(nil), q.args...)
+
+	list := "SELECT " + adColumns + ", " + q.searchColumns() + ", count(*) OVER() AS total FROM adds" + q.whereClause()
+	switch {
+	case filter.Sort == ads.SortPriceAsc:
+		list += " ORDER BY price NULLS LAST, id"
+	case filter.Sort == ads.SortPriceDesc:
+		list += " ORDER BY price DESC NULLS LAST, id"
+	case q.tsQuery != "":
+		list += " ORDER BY rank DESC, id"
+	default:
+		list += " ORDER BY id"
+	}
+	if filter.Limit > 0 {
+		list += " LIMIT " + q.arg(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		list += " OFFSET " + q.arg(filter.Offset)
+	}
+	return list, q.args, count, countArgs
+}
+
+// activeAdsColumn counts the published ads of the user in a users row.
+const activeAdsColumn = "(SELECT count(*) FROM adds WHERE adds.author_id = users.id AND adds.published AND adds.deleted_at IS NULL)"
+
+// likeEscaper makes a search string match itself in a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// listUsersSQL returns the page query and the count query for the filter
+// together with their arguments. As in listAdsSQL, the page query counts
+// the matching users itself.
+func listUsersSQL(filter ads.UserFilter) (string, []any, string, []any) {
+	q := &adQuery{}
+	if filter.Query != "" {
+		p := q.arg("%" + likeEscaper.Replace(filter.Query) + "%")
+		q.cond("(name ILIKE %s OR email ILIKE %s)", p, p)
+	}
+	if filter.Role != "" {
+		q.cond("role = %s", q.arg(string(filter.Role)))
+	}
+	if filter.Deleted != nil {
+		if *filter.Deleted {
+			q.cond("deleted_at IS NOT NULL")
+		} else {
+			q.cond("deleted_at IS NULL")
+		}
+	}
+	count := "SELECT count(*) FROM users" + q.whereClause()
+	countArgs := append([]any(nil), q.args...)
+
+	list := "SELECT " + userColumns + ", " + activeAdsColumn + ", count(*) OVER() AS total FROM users" + q.whereClause()
+	switch filter.Sort {
+	case ads.UserSortDateCreated:
+		list += " ORDER BY date_created, id"
+	case ads.UserSortDateCreatedDesc:
+		list += " ORDER BY date_created DESC, id DESC"
+	default:
+		list += " ORDER BY id"
+	}
+	if filter.Limit > 0 {
+		list += " LIMIT " + q.arg(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		list += " OFFSET " + q.arg(filter.Offset)
+	}
+	return list, q.args, count, countArgs
+}
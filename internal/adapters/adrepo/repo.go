@@ -5,186 +5,1145 @@ import (
 	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"homework9/internal/ads"
 	"homework9/internal/app"
-	"sync"
+	"time"
 )
 
-var ErrNotAuthor = errors.New("not author")
-var ErrValidate = errors.New("validation error")
+// ErrNotAuthor is app.ErrNotAuthor: the author is checked both by the app and by the repository.
+var ErrNotAuthor = app.ErrNotAuthor
 var ErrNotCreated = errors.New("not created")
 var ErrWasDeleted = errors.New("has been already deleted")
+var ErrNotDeleted = errors.New("has not been deleted")
+var ErrConflict = errors.New("ad has been modified concurrently")
+var ErrUnknownAuthor = errors.New("author does not exist or was deleted")
+var ErrUnknownCategory = errors.New("category does not exist")
+var ErrCategoryExists = errors.New("category with this name already exists")
+var ErrCategoryNotEmpty = errors.New("category has subcategories or ads")
+var ErrAlreadyReported = errors.New("user has already reported this ad")
+var ErrEmailExists = errors.New("user with this email already exists")
 
-const insertAdd = "INSERT INTO adds(title, text, author_id) VALUES($1, $2, $3) RETURNING *"
-const selectAuthorId = "SELECT author_id FROM adds WHERE id = $1"
-const selectAdd = "SELECT * FROM adds WHERE id = $1"
-const updateAddPublished = "UPDATE adds SET published = $2 WHERE id = $1 RETURNING *"
-const updateTextAndTitle = "UPDATE adds SET title = $2, text = $3 WHERE id = $1 RETURNING *"
-const deleteAdd = "DELETE FROM adds WHERE id = $1"
+const adColumns = "id, title, text, author_id, category_id, tags, price, coalesce(currency, ''), status, published, coalesce(rejection_reason, ''), publish_at, expires_at, version, deleted_at, deleted_by, date_created, date_updated, " +
+	"(SELECT coalesce(json_agg(json_build_object(" + imageJSONFields + ") ORDER BY i.position), '[]') FROM ad_images i WHERE i.ad_id = adds.id), " +
+	"(SELECT count(*) FROM favorites f JOIN users u ON u.id = f.user_id WHERE f.ad_id = adds.id AND u.deleted_at IS NULL)"
 
-const insertUser = "INSERT INTO users(name) VALUES($1) RETURNING *"
-const selectUser = "SELECT * FROM users WHERE id = $1"
-const deleteUser = "DELETE FROM users WHERE id = $1"
+// imageJSONFields builds an image object matching the json tags of ads.Image.
+const imageJSONFields = "'id', i.id, 'ad_id', i.ad_id, 'key', i.key, 'content_type', i.content_type, 'size', i.size, 'position', i.position"
 
+const insertAdd = "INSERT INTO adds(title, text, author_id, category_id, tags, price, currency) " +
+	"SELECT $1, $2, $3::int, $4, coalesce($5::text[], '{}'), $6, nullif($7, '') " +
+	"WHERE EXISTS (SELECT 1 FROM users WHERE id = $3::int AND deleted_at IS NULL) RETURNING " + adColumns
+const selectAuthorId = "SELECT author_id, deleted_at IS NOT NULL FROM adds WHERE id = $1"
+const selectDeleted = "SELECT deleted_at IS NOT NULL FROM adds WHERE id = $1"
+const selectAdd = "SELECT " + adColumns + " FROM adds WHERE id = $1"
+const updateStatus = "UPDATE adds SET status = $3, published = ($3 = 'published'), rejection_reason = nullif($4, '') " +
+	"WHERE id = $1 AND status = $2 AND deleted_at IS NULL AND ($5::bigint = 0 OR version = $5) RETURNING " + adColumns
+const updateContent = "UPDATE adds SET title = $2, text = $3, category_id = $4, tags = coalesce($5::text[], '{}'), " +
+	"price = $8, currency = nullif($9, '') " +
+	"WHERE id = $1 AND author_id = $6 AND deleted_at IS NULL AND ($7::bigint = 0 OR version = $7) RETURNING " + adColumns
+const updateSchedule = "UPDATE adds SET publish_at = $2, expires_at = $3 " +
+	"WHERE id = $1 AND author_id = $4 AND deleted_at IS NULL AND ($5::bigint = 0 OR version = $5) RETURNING " + adColumns
+const selectDueAdds = "SELECT " + adColumns + " FROM adds WHERE deleted_at IS NULL AND (expires_at <= $1 OR publish_at <= $1 " +
+	"AND status = ANY($3::text[]) AND EXISTS (SELECT 1 FROM users u WHERE u.id = adds.author_id AND u.deleted_at IS NULL)) ORDER BY id LIMIT $2"
+const deleteAdd = "UPDATE adds SET deleted_at = now(), deleted_by = $2 WHERE id = $1 AND author_id = $2 AND deleted_at IS NULL"
+const forceDeleteAdd = "UPDATE adds SET deleted_at = now(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL"
+const restoreAdd = "UPDATE adds SET deleted_at = NULL, deleted_by = NULL WHERE id = $1 AND author_id = $2 AND deleted_at IS NOT NULL RETURNING " + adColumns
+
+const lockAdd = "SELECT " + adColumns + " FROM adds WHERE id = $1 FOR UPDATE"
+
+const revisionColumns = "id, ad_id, actor_id, old_title, new_title, old_text, new_text, old_published, new_published, " +
+	"coalesce(old_status, ''), coalesce(new_status, ''), date_created"
+
+const insertRevision = "INSERT INTO ad_revisions(ad_id, actor_id, old_title, new_title, old_text, new_text, old_published, new_published, " +
+	"old_status, new_status) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING " + revisionColumns
+const selectRevisions = "SELECT " + revisionColumns + " FROM ad_revisions WHERE ad_id = $1 ORDER BY id"
+const selectRevision = "SELECT " + revisionColumns + " FROM ad_revisions WHERE ad_id = $1 AND id = $2"
+
+const imageColumns = "id, ad_id, key, content_type, size, position"
+
+const insertImage = "INSERT INTO ad_images(ad_id, key, content_type, size, position) " +
+	"SELECT $1, $2, $3, $4, coalesce(max(position) + 1, 0) FROM ad_images WHERE ad_id = $1 RETURNING " + imageColumns
+const selectImages = "SELECT " + imageColumns + " FROM ad_images WHERE ad_id = $1 ORDER BY position, id"
+const deleteImage = "DELETE FROM ad_images WHERE ad_id = $1 AND id = $2 RETURNING " + imageColumns
+const reorderImages = "UPDATE ad_images i SET position = o.ord - 1 FROM unnest($2::int[]) WITH ORDINALITY AS o(id, ord) " +
+	"WHERE i.ad_id = $1 AND i.id = o.id"
+
+const insertFavorite = "INSERT INTO favorites(user_id, ad_id) VALUES($1, $2) ON CONFLICT DO NOTHING"
+const deleteFavorite = "DELETE FROM favorites WHERE user_id = $1 AND ad_id = $2"
+
+// threadColumns counts the messages not read by the user passed as $1.
+const threadColumns = "id, ad_id, buyer_id, seller_id, " +
+	"(SELECT count(*) FROM messages m WHERE m.thread_id = threads.id AND m.sender_id <> $1 AND m.read_at IS NULL), date_created, date_updated"
+
+const upsertThread = "INSERT INTO threads(ad_id, buyer_id, seller_id) VALUES($2, $1, $3) " +
+	"ON CONFLICT (ad_id, buyer_id) DO UPDATE SET ad_id = EXCLUDED.ad_id RETURNING " + threadColumns
+const selectThread = "SELECT " + threadColumns + " FROM threads WHERE id = $2"
+const selectThreads = "SELECT " + threadColumns + " FROM threads WHERE buyer_id = $1 OR seller_id = $1 " +
+	"ORDER BY date_updated DESC, id DESC LIMIT $2 OFFSET $3"
+const countThreads = "SELECT count(*) FROM threads WHERE buyer_id = $1 OR seller_id = $1"
+
+const messageColumns = "id, thread_id, sender_id, text, read_at, date_created"
+
+const insertMessage = "WITH t AS (UPDATE threads SET date_updated = now() WHERE id = $1) " +
+	"INSERT INTO messages(thread_id, sender_id, text) VALUES($1, $2, $3) RETURNING " + messageColumns
+const selectMessages = "SELECT " + messageColumns + " FROM messages WHERE thread_id = $1 ORDER BY id LIMIT $2 OFFSET $3"
+const countMessages = "SELECT count(*) FROM messages WHERE thread_id = $1"
+const markRead = "UPDATE messages SET read_at = now() WHERE thread_id = $1 AND sender_id <> $2 AND read_at IS NULL"
+const countUnread = "SELECT count(*) FROM messages m JOIN threads t ON t.id = m.thread_id " +
+	"WHERE (t.buyer_id = $1 OR t.seller_id = $1) AND m.sender_id <> $1 AND m.read_at IS NULL"
+
+const reportColumns = "id, ad_id, reporter_id, reason, comment, status, coalesce(resolution, ''), resolved_by, resolved_at, date_created"
+
+const insertReport = "INSERT INTO reports(ad_id, reporter_id, reason, comment) VALUES($1, $2, $3, $4) RETURNING " + reportColumns
+
+// selectReportGroups relies on the json names of ads.Report matching the column names.
+const selectReportGroups = "SELECT ad_id, json_agg(reports ORDER BY id) FROM reports WHERE status = 'open' " +
+	"GROUP BY ad_id ORDER BY count(*) DESC, min(id) LIMIT $1 OFFSET $2"
+const countReportGroups = "SELECT count(DISTINCT ad_id) FROM reports WHERE status = 'open'"
+const resolveReports = "WITH r AS (UPDATE reports SET status = 'resolved', resolution = $3, resolved_by = $2, resolved_at = now() " +
+	"WHERE ad_id = $1 AND status = 'open' RETURNING " + reportColumns + ") SELECT * FROM r ORDER BY id"
+
+const notificationColumns = "id, user_id, text, date_created"
+
+const insertNotification = "INSERT INTO notifications(user_id, text) VALUES($1, $2) RETURNING " + notificationColumns
+const selectNotifications = "SELECT " + notificationColumns + " FROM notifications WHERE user_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3"
+const countNotifications = "SELECT count(*) FROM notifications WHERE user_id = $1"
+
+const categoryColumns = "id, parent_id, name, date_created"
+
+const insertCategory = "INSERT INTO categories(parent_id, name) VALUES($1, $2) RETURNING " + categoryColumns
+const selectCategory = "SELECT " + categoryColumns + " FROM categories WHERE id = $1"
+const selectCategories = "SELECT " + categoryColumns + " FROM categories ORDER BY id"
+const updateCategory = "UPDATE categories SET name = $2, parent_id = $3 WHERE id = $1 RETURNING " + categoryColumns
+const deleteCategory = "DELETE FROM categories WHERE id = $1"
+
+const userColumns = "id, name, coalesce(email, ''), phone, display_name, avatar_url, about, role, deleted_at, deleted_by, date_created"
+
+const insertUser = "INSERT INTO users(name) VALUES($1) RETURNING " + userColumns
+const insertAccount = "INSERT INTO users(name, email, password_hash) VALUES($1, $2, $3) RETURNING " + userColumns
+const selectCredentials = "SELECT id, password_hash FROM users WHERE email = $1 AND deleted_at IS NULL"
+const insertRefreshToken = "INSERT INTO refresh_tokens(id, user_id, expires_at) VALUES($1, $2, $3)"
+const revokeRefreshToken = "UPDATE refresh_tokens SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL RETURNING expires_at > now()"
+const revokeRefreshTokens = "UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+const apiKeyColumns = "id, user_id, name, prefix, scope, last_used_at, revoked_at, date_created"
+
+const insertAPIKey = "INSERT INTO api_keys(user_id, name, prefix, scope, key_hash) VALUES($1, $2, $3, $4, $5) RETURNING " + apiKeyColumns
+const selectAPIKeys = "SELECT " + apiKeyColumns + " FROM api_keys WHERE user_id = $1 ORDER BY id"
+const revokeAPIKey = "UPDATE api_keys SET revoked_at = coalesce(revoked_at, now()) WHERE id = $1 AND user_id = $2"
+const revokeAPIKeys = "UPDATE api_keys SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL"
+const useAPIKey = "UPDATE api_keys SET last_used_at = now() WHERE key_hash = $1 AND revoked_at IS NULL RETURNING " + apiKeyColumns
+const selectUser = "SELECT " + userColumns + " FROM users WHERE id = $1"
+const deleteUser = "UPDATE users SET deleted_at = now(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL"
+const restoreUser = "UPDATE users SET deleted_at = NULL, deleted_by = NULL WHERE id = $1 AND deleted_at IS NOT NULL RETURNING " + userColumns
+const updateUser = "UPDATE users SET name = $2, email = nullif($3, ''), phone = $4, display_name = $5, avatar_url = $6, about = $7 " +
+	"WHERE id = $1 AND deleted_at IS NULL RETURNING " + userColumns
+const setUserRole = "UPDATE users SET role = $2 WHERE id = $1 AND deleted_at IS NULL RETURNING " + userColumns
+
+// dbtx is implemented by both *pgxpool.Pool and pgx.Tx,
+// so the same Repo methods work inside and outside of a transaction.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Repo is safe for concurrent use: every call takes its own connection
+// from the pool, and the author checks are part of the modifying statements.
 type Repo struct {
-	mu   *sync.Mutex
-	conn *pgx.Conn
-	ctx  context.Context
+	db dbtx
 }
 
-func validate(Title string, Text string) bool {
-	return Title != "" && len(Title) < 100 && Text != "" && len(Text) < 500
+// RunInTx runs fn in a transaction. Calling RunInTx on a repository that
+// is already bound to a transaction creates a savepoint.
+func (r *Repo) RunInTx(ctx context.Context, fn func(tx app.Repository) error) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if err := fn(&Repo{db: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return nil
 }
 
-func (r *Repo) Create(Title string, Text string, UserID int64) (*ads.Ad, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	if !validate(Title, Text) {
-		return nil, ErrValidate
+func scanAd(row pgx.Row) (*ads.Ad, error) {
+	ad := &ads.Ad{}
+	if err := row.Scan(adDest(ad)...); err != nil {
+		return nil, err
 	}
+	ad.Deleted = ad.DeletedAt != nil
+	return ad, nil
+}
+
+// adDest lists scan destinations in the order of adColumns.
+func adDest(ad *ads.Ad) []any {
+	return []any{
+		&ad.ID, &ad.Title, &ad.Text, &ad.AuthorID, &ad.CategoryID, &ad.Tags, &ad.Price, &ad.Currency, &ad.Status, &ad.Published, &ad.RejectionReason, &ad.PublishAt, &ad.ExpiresAt,
+		&ad.Version, &ad.DeletedAt, &ad.DeletedBy, &ad.DateCreated, &ad.DateUpdated, &ad.Images, &ad.Favorites,
+	}
+}
+
+// scanListedAd scans a row of listAdsSQL: adColumns followed by the search rank,
+// the snippet and the number of all matching ads.
+func scanListedAd(row pgx.Row, total *int64) (*ads.Ad, error) {
 	ad := &ads.Ad{}
-	err := r.conn.QueryRow(r.ctx, insertAdd, Title, Text, UserID).Scan(
-		&ad.ID, &ad.Title, &ad.Text, &ad.AuthorID,
-		&ad.Published, &ad.DateCreated, &ad.DateUpdated,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create ad: %w", err)
+	if err := row.Scan(append(adDest(ad), &ad.Rank, &ad.Snippet, total)...); err != nil {
+		return nil, err
 	}
+	ad.Deleted = ad.DeletedAt != nil
 	return ad, nil
 }
 
-func (r *Repo) UpdatePublished(ID int64, UserID int64, Published bool) (*ads.Ad, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// SQLSTATE codes of the integrity constraint violations handled by the repository.
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+)
+
+// violatedConstraint returns the name of the constraint of the given kind
+// that err reports, or "" if err is not such a violation.
+func violatedConstraint(err error, code string) (string, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == code {
+		return pgErr.ConstraintName, true
+	}
+	return "", false
+}
+
+// adForeignKeyError maps a failed reference of a new or updated ad.
+func adForeignKeyError(err error) error {
+	constraint, ok := violatedConstraint(err, foreignKeyViolation)
+	switch {
+	case !ok:
+		return nil
+	case constraint == "adds_category_id_fkey":
+		return ErrUnknownCategory
+	default:
+		return ErrUnknownAuthor
+	}
+}
+
+func scanRevision(row pgx.Row) (*ads.Revision, error) {
+	rev := &ads.Revision{}
+	err := row.Scan(&rev.ID, &rev.AdID, &rev.ActorID, &rev.OldTitle, &rev.NewTitle,
+		&rev.OldText, &rev.NewText, &rev.OldPublished, &rev.NewPublished, &rev.OldStatus, &rev.NewStatus, &rev.DateCreated)
+	if err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+func scanImage(row pgx.Row) (*ads.Image, error) {
+	img := &ads.Image{}
+	if err := row.Scan(&img.ID, &img.AdID, &img.Key, &img.ContentType, &img.Size, &img.Position); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func scanImages(rows pgx.Rows) ([]*ads.Image, error) {
+	defer rows.Close()
+	var res = make([]*ads.Image, 0)
+	for rows.Next() {
+		img, err := scanImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, img)
+	}
+	return res, rows.Err()
+}
+
+func scanThread(row pgx.Row) (*ads.Thread, error) {
+	t := &ads.Thread{}
+	if err := row.Scan(&t.ID, &t.AdID, &t.BuyerID, &t.SellerID, &t.Unread, &t.DateCreated, &t.DateUpdated); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func scanMessage(row pgx.Row) (*ads.Message, error) {
+	msg := &ads.Message{}
+	if err := row.Scan(&msg.ID, &msg.ThreadID, &msg.SenderID, &msg.Text, &msg.ReadAt, &msg.DateCreated); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func scanReport(row pgx.Row) (*ads.Report, error) {
+	rep := &ads.Report{}
+	err := row.Scan(&rep.ID, &rep.AdID, &rep.ReporterID, &rep.Reason, &rep.Comment, &rep.Status,
+		&rep.Resolution, &rep.ResolvedBy, &rep.ResolvedAt, &rep.DateCreated)
+	if err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+func scanNotification(row pgx.Row) (*ads.Notification, error) {
+	n := &ads.Notification{}
+	if err := row.Scan(&n.ID, &n.UserID, &n.Text, &n.DateCreated); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func scanAPIKey(row pgx.Row) (*ads.APIKey, error) {
+	key := &ads.APIKey{}
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Scope, &key.LastUsedAt, &key.RevokedAt, &key.DateCreated)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func scanCategory(row pgx.Row) (*ads.Category, error) {
+	cat := &ads.Category{}
+	if err := row.Scan(&cat.ID, &cat.ParentID, &cat.Name, &cat.DateCreated); err != nil {
+		return nil, err
+	}
+	return cat, nil
+}
+
+// categoryError maps constraint violations of category changes.
+func categoryError(err error) error {
+	if _, ok := violatedConstraint(err, uniqueViolation); ok {
+		return ErrCategoryExists
+	}
+	if _, ok := violatedConstraint(err, foreignKeyViolation); ok {
+		return ErrUnknownCategory
+	}
+	return nil
+}
+
+func scanUser(row pgx.Row) (*ads.User, error) {
+	user := &ads.User{}
+	if err := row.Scan(userDest(user)...); err != nil {
+		return nil, err
+	}
+	user.Deleted = user.DeletedAt != nil
+	return user, nil
+}
+
+// userDest lists scan destinations in the order of userColumns.
+func userDest(user *ads.User) []any {
+	return []any{
+		&user.ID, &user.Name, &user.Email, &user.Phone, &user.DisplayName, &user.AvatarURL, &user.About,
+		&user.Role, &user.DeletedAt, &user.DeletedBy, &user.DateCreated,
+	}
+}
+
+// scanListedUser scans a row of listUsersSQL: userColumns followed by the number of active ads
+// and the number of all matching users.
+func scanListedUser(row pgx.Row, total *int64) (*ads.User, error) {
+	user := &ads.User{}
+	if err := row.Scan(append(userDest(user), &user.ActiveAds, total)...); err != nil {
+		return nil, err
+	}
+	user.Deleted = user.DeletedAt != nil
+	return user, nil
+}
+
+// authorError explains why a statement guarded by author_id, deleted_at
+// and version touched no rows.
+func (r *Repo) authorError(ctx context.Context, ID int64, UserID int64) error {
 	var auId int64
-	err := r.conn.QueryRow(r.ctx, selectAuthorId, ID).Scan(&auId)
+	var deleted bool
+	err := r.db.QueryRow(ctx, selectAuthorId, ID).Scan(&auId, &deleted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotCreated
+	}
 	if err != nil {
-		return nil, fmt.Errorf("unable to select with such id: %w", err)
+		return fmt.Errorf("unable to select with such id: %w", err)
 	}
 	if auId != UserID {
-		return nil, ErrNotAuthor
+		return ErrNotAuthor
+	}
+	if deleted {
+		return ErrWasDeleted
+	}
+	return ErrConflict
+}
+
+// stateError explains why a statement guarded by deleted_at, status
+// and version touched no rows.
+func (r *Repo) stateError(ctx context.Context, ID int64) error {
+	var deleted bool
+	err := r.db.QueryRow(ctx, selectDeleted, ID).Scan(&deleted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotCreated
+	}
+	if err != nil {
+		return fmt.Errorf("unable to select with such id: %w", err)
+	}
+	if deleted {
+		return ErrWasDeleted
+	}
+	return ErrConflict
+}
+
+func (r *Repo) Create(ctx context.Context, in ads.AdInput, UserID int64) (*ads.Ad, error) {
+	ad, err := scanAd(r.db.QueryRow(ctx, insertAdd, in.Title, in.Text, UserID, in.CategoryID, in.Tags, in.Price, in.Currency))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUnknownAuthor
+	}
+	if fkErr := adForeignKeyError(err); fkErr != nil {
+		return nil, fkErr
 	}
-	ad := &ads.Ad{}
-	err = r.conn.QueryRow(r.ctx, updateAddPublished, ID, Published).Scan(
-		&ad.ID, &ad.Title, &ad.Text, &ad.AuthorID,
-		&ad.Published, &ad.DateCreated, &ad.DateUpdated,
-	)
 	if err != nil {
-		return nil, fmt.Errorf("unable to update published ad: %w", err)
+		return nil, fmt.Errorf("unable to create ad: %w", err)
 	}
 	return ad, nil
 }
 
-func (r *Repo) UpdateTextAndTitle(ID int64, UserID int64, Title string, Text string) (*ads.Ad, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	if !validate(Title, Text) {
-		return nil, ErrValidate
+func (r *Repo) UpdateStatus(ctx context.Context, ID int64, From ads.AdStatus, To ads.AdStatus, Reason string, Version int64) (*ads.Ad, error) {
+	ad, err := scanAd(r.db.QueryRow(ctx, updateStatus, ID, From, To, Reason, Version))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, r.stateError(ctx, ID)
 	}
-	var auId int64
-	err := r.conn.QueryRow(r.ctx, selectAuthorId, ID).Scan(&auId)
 	if err != nil {
-		return nil, fmt.Errorf("unable to select with such id: %w", err)
+		return nil, fmt.Errorf("unable to update ad status: %w", err)
 	}
-	if auId != UserID {
-		return nil, ErrNotAuthor
+	return ad, nil
+}
+
+func (r *Repo) UpdateContent(ctx context.Context, ID int64, UserID int64, in ads.AdInput, Version int64) (*ads.Ad, error) {
+	ad, err := scanAd(r.db.QueryRow(ctx, updateContent, ID, in.Title, in.Text, in.CategoryID, in.Tags, UserID, Version,
+		in.Price, in.Currency))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, r.authorError(ctx, ID, UserID)
+	}
+	if fkErr := adForeignKeyError(err); fkErr != nil {
+		return nil, fkErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to update ad: %w", err)
+	}
+	return ad, nil
+}
+
+func (r *Repo) UpdateSchedule(ctx context.Context, ID int64, UserID int64, PublishAt *time.Time, ExpiresAt *time.Time, Version int64) (*ads.Ad, error) {
+	ad, err := scanAd(r.db.QueryRow(ctx, updateSchedule, ID, PublishAt, ExpiresAt, UserID, Version))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, r.authorError(ctx, ID, UserID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to update ad schedule: %w", err)
 	}
-	ad := &ads.Ad{}
-	err = r.conn.QueryRow(r.ctx, updateTextAndTitle, ID, Title, Text).Scan(
-		&ad.ID, &ad.Title, &ad.Text, &ad.AuthorID,
-		&ad.Published, &ad.DateCreated, &ad.DateUpdated,
-	)
 	return ad, nil
 }
 
-func (r *Repo) GetList(filter ads.AdFilter) ([]*ads.Ad, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *Repo) ListDueAds(ctx context.Context, now time.Time, publishable []ads.AdStatus, limit int) ([]*ads.Ad, error) {
+	statuses := make([]string, len(publishable))
+	for i, st := range publishable {
+		statuses[i] = string(st)
+	}
+	rows, err := r.db.Query(ctx, selectDueAdds, now, limit, statuses)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list due ads: %w", err)
+	}
+	defer rows.Close()
 	var res = make([]*ads.Ad, 0)
-	var i = 1
-	for {
-		ad := &ads.Ad{}
-		err := r.conn.QueryRow(r.ctx, selectAdd, i).Scan(
-			&ad.ID, &ad.Title, &ad.Text, &ad.AuthorID,
-			&ad.Published, &ad.DateCreated, &ad.DateUpdated,
-		)
-		i += 1
+	for rows.Next() {
+		ad, err := scanAd(rows)
 		if err != nil {
-			break
+			return nil, fmt.Errorf("unable to scan ad: %w", err)
 		}
-		if filter.Pub && !ad.Published {
-			continue
+		res = append(res, ad)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list due ads: %w", err)
+	}
+	return res, nil
+}
+
+func (r *Repo) GetList(ctx context.Context, filter ads.AdFilter) ([]*ads.Ad, int64, error) {
+	list, listArgs, count, countArgs := listAdsSQL(filter)
+	rows, err := r.db.Query(ctx, list, listArgs...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to list ads: %w", err)
+	}
+	defer rows.Close()
+	var total int64
+	var res = make([]*ads.Ad, 0)
+	for rows.Next() {
+		ad, err := scanListedAd(rows, &total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("unable to scan ad: %w", err)
 		}
-		if filter.Auth != -1 && ad.AuthorID != filter.Auth {
-			continue
+		res = append(res, ad)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("unable to list ads: %w", err)
+	}
+	// A page past the end has no rows to carry the total.
+	if len(res) == 0 && filter.Offset > 0 {
+		if err := r.db.QueryRow(ctx, count, countArgs...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("unable to count ads: %w", err)
 		}
-		if filter.Title != "" && ad.Title != filter.Title {
-			continue
+	}
+	return res, total, nil
+}
+
+func (r *Repo) GetByID(ctx context.Context, ID int64) (*ads.Ad, error) {
+	ad, err := scanAd(r.db.QueryRow(ctx, selectAdd, ID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get ad: %w", err)
+	}
+	if ad.Deleted {
+		return nil, ErrWasDeleted
+	}
+	return ad, nil
+}
+
+func (r *Repo) DeleteAd(ctx context.Context, ID int64, UserID int64) error {
+	tag, err := r.db.Exec(ctx, deleteAdd, ID, UserID)
+	if err != nil {
+		return fmt.Errorf("unable to delete ad: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return r.authorError(ctx, ID, UserID)
+	}
+	return nil
+}
+
+func (r *Repo) ForceDeleteAd(ctx context.Context, ID int64, ActorID int64) error {
+	tag, err := r.db.Exec(ctx, forceDeleteAdd, ID, ActorID)
+	if err != nil {
+		return fmt.Errorf("unable to delete ad: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return r.stateError(ctx, ID)
+	}
+	return nil
+}
+
+func (r *Repo) RestoreAd(ctx context.Context, ID int64, UserID int64) (*ads.Ad, error) {
+	ad, err := scanAd(r.db.QueryRow(ctx, restoreAdd, ID, UserID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = r.authorError(ctx, ID, UserID)
+		if errors.Is(err, ErrConflict) {
+			return nil, ErrNotDeleted
 		}
-		res = append(res, ad)
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to restore ad: %w", err)
+	}
+	return ad, nil
+}
+
+func (r *Repo) LockAd(ctx context.Context, ID int64) (*ads.Ad, error) {
+	ad, err := scanAd(r.db.QueryRow(ctx, lockAdd, ID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to lock ad: %w", err)
+	}
+	return ad, nil
+}
+
+func (r *Repo) AddRevision(ctx context.Context, rev *ads.Revision) (*ads.Revision, error) {
+	res, err := scanRevision(r.db.QueryRow(ctx, insertRevision, rev.AdID, rev.ActorID,
+		rev.OldTitle, rev.NewTitle, rev.OldText, rev.NewText, rev.OldPublished, rev.NewPublished, rev.OldStatus, rev.NewStatus))
+	if err != nil {
+		return nil, fmt.Errorf("unable to add revision: %w", err)
 	}
 	return res, nil
 }
 
-func (r *Repo) GetByID(ID int64) (*ads.Ad, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	ad := &ads.Ad{}
-	err := r.conn.QueryRow(r.ctx, selectAdd, ID).Scan(
-		&ad.ID, &ad.Title, &ad.Text, &ad.AuthorID,
-		&ad.Published, &ad.DateCreated, &ad.DateUpdated,
-	)
+func (r *Repo) ListRevisions(ctx context.Context, AdID int64, UserID int64) ([]*ads.Revision, error) {
+	ad, err := r.GetByID(ctx, AdID)
 	if err != nil {
+		return nil, err
+	}
+	if ad.AuthorID != UserID {
+		return nil, ErrNotAuthor
+	}
+	rows, err := r.db.Query(ctx, selectRevisions, AdID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list revisions: %w", err)
+	}
+	defer rows.Close()
+	var res = make([]*ads.Revision, 0)
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan revision: %w", err)
+		}
+		res = append(res, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list revisions: %w", err)
+	}
+	return res, nil
+}
+
+func (r *Repo) GetRevision(ctx context.Context, AdID int64, ID int64) (*ads.Revision, error) {
+	rev, err := scanRevision(r.db.QueryRow(ctx, selectRevision, AdID, ID))
+	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotCreated
 	}
-	return ad, nil
+	if err != nil {
+		return nil, fmt.Errorf("unable to get revision: %w", err)
+	}
+	return rev, nil
 }
 
-func (r *Repo) DeleteAd(ID int64, UserID int64) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	var auId int64
-	err := r.conn.QueryRow(r.ctx, selectAuthorId, ID).Scan(&auId)
+func (r *Repo) ListImages(ctx context.Context, AdID int64, UserID int64) ([]*ads.Image, error) {
+	ad, err := r.GetByID(ctx, AdID)
+	if err != nil {
+		return nil, err
+	}
+	if ad.AuthorID != UserID {
+		return nil, ErrNotAuthor
+	}
+	rows, err := r.db.Query(ctx, selectImages, AdID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list images: %w", err)
+	}
+	res, err := scanImages(rows)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list images: %w", err)
+	}
+	return res, nil
+}
+
+func (r *Repo) AddImage(ctx context.Context, img *ads.Image) (*ads.Image, error) {
+	res, err := scanImage(r.db.QueryRow(ctx, insertImage, img.AdID, img.Key, img.ContentType, img.Size))
+	if _, ok := violatedConstraint(err, foreignKeyViolation); ok {
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to add image: %w", err)
+	}
+	return res, nil
+}
+
+func (r *Repo) DeleteImage(ctx context.Context, AdID int64, ID int64) (*ads.Image, error) {
+	img, err := scanImage(r.db.QueryRow(ctx, deleteImage, AdID, ID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotCreated
+	}
 	if err != nil {
+		return nil, fmt.Errorf("unable to delete image: %w", err)
+	}
+	return img, nil
+}
+
+func (r *Repo) ReorderImages(ctx context.Context, AdID int64, IDs []int64) error {
+	if _, err := r.db.Exec(ctx, reorderImages, AdID, IDs); err != nil {
+		return fmt.Errorf("unable to reorder images: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) AddFavorite(ctx context.Context, UserID int64, AdID int64) error {
+	_, err := r.db.Exec(ctx, insertFavorite, UserID, AdID)
+	if _, ok := violatedConstraint(err, foreignKeyViolation); ok {
 		return ErrNotCreated
 	}
-	if auId != UserID {
-		return ErrNotAuthor
+	if err != nil {
+		return fmt.Errorf("unable to add favorite: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) RemoveFavorite(ctx context.Context, UserID int64, AdID int64) error {
+	if _, err := r.db.Exec(ctx, deleteFavorite, UserID, AdID); err != nil {
+		return fmt.Errorf("unable to remove favorite: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) GetOrCreateThread(ctx context.Context, AdID int64, BuyerID int64, SellerID int64) (*ads.Thread, error) {
+	thread, err := scanThread(r.db.QueryRow(ctx, upsertThread, BuyerID, AdID, SellerID))
+	if _, ok := violatedConstraint(err, foreignKeyViolation); ok {
+		return nil, ErrNotCreated
 	}
-	_, err = r.conn.Exec(r.ctx, deleteAdd, ID)
 	if err != nil {
-		return fmt.Errorf("unable to delete ad: %w", err)
+		return nil, fmt.Errorf("unable to create thread: %w", err)
+	}
+	return thread, nil
+}
+
+func (r *Repo) GetThread(ctx context.Context, ID int64, UserID int64) (*ads.Thread, error) {
+	thread, err := scanThread(r.db.QueryRow(ctx, selectThread, UserID, ID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get thread: %w", err)
+	}
+	return thread, nil
+}
+
+func (r *Repo) ListThreads(ctx context.Context, UserID int64, Limit int, Offset int) ([]*ads.Thread, int64, error) {
+	var total int64
+	if err := r.db.QueryRow(ctx, countThreads, UserID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("unable to count threads: %w", err)
+	}
+	rows, err := r.db.Query(ctx, selectThreads, UserID, Limit, Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to list threads: %w", err)
+	}
+	defer rows.Close()
+	var res = make([]*ads.Thread, 0)
+	for rows.Next() {
+		thread, err := scanThread(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("unable to scan thread: %w", err)
+		}
+		res = append(res, thread)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("unable to list threads: %w", err)
+	}
+	return res, total, nil
+}
+
+func (r *Repo) AddMessage(ctx context.Context, msg *ads.Message) (*ads.Message, error) {
+	res, err := scanMessage(r.db.QueryRow(ctx, insertMessage, msg.ThreadID, msg.SenderID, msg.Text))
+	if _, ok := violatedConstraint(err, foreignKeyViolation); ok {
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to add message: %w", err)
+	}
+	return res, nil
+}
+
+func (r *Repo) ListMessages(ctx context.Context, ThreadID int64, Limit int, Offset int) ([]*ads.Message, int64, error) {
+	var total int64
+	if err := r.db.QueryRow(ctx, countMessages, ThreadID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("unable to count messages: %w", err)
+	}
+	rows, err := r.db.Query(ctx, selectMessages, ThreadID, Limit, Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to list messages: %w", err)
+	}
+	defer rows.Close()
+	var res = make([]*ads.Message, 0)
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("unable to scan message: %w", err)
+		}
+		res = append(res, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("unable to list messages: %w", err)
+	}
+	return res, total, nil
+}
+
+func (r *Repo) MarkRead(ctx context.Context, ThreadID int64, UserID int64) error {
+	if _, err := r.db.Exec(ctx, markRead, ThreadID, UserID); err != nil {
+		return fmt.Errorf("unable to mark messages read: %w", err)
 	}
 	return nil
 }
 
-func (r *Repo) CreateUser(Name string) (*ads.User, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	user := &ads.User{}
-	r.conn.QueryRow(r.ctx, insertUser, Name).Scan(&user.ID, &user.Name)
+func (r *Repo) CountUnread(ctx context.Context, UserID int64) (int64, error) {
+	var n int64
+	if err := r.db.QueryRow(ctx, countUnread, UserID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("unable to count unread messages: %w", err)
+	}
+	return n, nil
+}
+
+func (r *Repo) AddReport(ctx context.Context, rep *ads.Report) (*ads.Report, error) {
+	res, err := scanReport(r.db.QueryRow(ctx, insertReport, rep.AdID, rep.ReporterID, rep.Reason, rep.Comment))
+	if _, ok := violatedConstraint(err, uniqueViolation); ok {
+		return nil, ErrAlreadyReported
+	}
+	if _, ok := violatedConstraint(err, foreignKeyViolation); ok {
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to add report: %w", err)
+	}
+	return res, nil
+}
+
+func (r *Repo) ListReportGroups(ctx context.Context, Limit int, Offset int) ([]*ads.ReportGroup, int64, error) {
+	var total int64
+	if err := r.db.QueryRow(ctx, countReportGroups).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("unable to count reports: %w", err)
+	}
+	rows, err := r.db.Query(ctx, selectReportGroups, Limit, Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to list reports: %w", err)
+	}
+	defer rows.Close()
+	var res = make([]*ads.ReportGroup, 0)
+	for rows.Next() {
+		group := &ads.ReportGroup{}
+		if err := rows.Scan(&group.AdID, &group.Reports); err != nil {
+			return nil, 0, fmt.Errorf("unable to scan reports: %w", err)
+		}
+		res = append(res, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("unable to list reports: %w", err)
+	}
+	return res, total, nil
+}
+
+func (r *Repo) ResolveReports(ctx context.Context, AdID int64, ModeratorID int64, Resolution ads.ReportResolution) ([]*ads.Report, error) {
+	rows, err := r.db.Query(ctx, resolveReports, AdID, ModeratorID, Resolution)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve reports: %w", err)
+	}
+	defer rows.Close()
+	var res = make([]*ads.Report, 0)
+	for rows.Next() {
+		rep, err := scanReport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan report: %w", err)
+		}
+		res = append(res, rep)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to resolve reports: %w", err)
+	}
+	return res, nil
+}
+
+func (r *Repo) AddNotification(ctx context.Context, n *ads.Notification) (*ads.Notification, error) {
+	res, err := scanNotification(r.db.QueryRow(ctx, insertNotification, n.UserID, n.Text))
+	if _, ok := violatedConstraint(err, foreignKeyViolation); ok {
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to add notification: %w", err)
+	}
+	return res, nil
+}
+
+func (r *Repo) ListNotifications(ctx context.Context, UserID int64, Limit int, Offset int) ([]*ads.Notification, int64, error) {
+	var total int64
+	if err := r.db.QueryRow(ctx, countNotifications, UserID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("unable to count notifications: %w", err)
+	}
+	rows, err := r.db.Query(ctx, selectNotifications, UserID, Limit, Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to list notifications: %w", err)
+	}
+	defer rows.Close()
+	var res = make([]*ads.Notification, 0)
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("unable to scan notification: %w", err)
+		}
+		res = append(res, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("unable to list notifications: %w", err)
+	}
+	return res, total, nil
+}
+
+func (r *Repo) CreateCategory(ctx context.Context, Name string, ParentID *int64) (*ads.Category, error) {
+	cat, err := scanCategory(r.db.QueryRow(ctx, insertCategory, ParentID, Name))
+	if cErr := categoryError(err); cErr != nil {
+		return nil, cErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create category: %w", err)
+	}
+	return cat, nil
+}
+
+func (r *Repo) GetCategory(ctx context.Context, ID int64) (*ads.Category, error) {
+	cat, err := scanCategory(r.db.QueryRow(ctx, selectCategory, ID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get category: %w", err)
+	}
+	return cat, nil
+}
+
+func (r *Repo) ListCategories(ctx context.Context) ([]*ads.Category, error) {
+	rows, err := r.db.Query(ctx, selectCategories)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list categories: %w", err)
+	}
+	defer rows.Close()
+	var res = make([]*ads.Category, 0)
+	for rows.Next() {
+		cat, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan category: %w", err)
+		}
+		res = append(res, cat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list categories: %w", err)
+	}
+	return res, nil
+}
+
+func (r *Repo) UpdateCategory(ctx context.Context, ID int64, Name string, ParentID *int64) (*ads.Category, error) {
+	cat, err := scanCategory(r.db.QueryRow(ctx, updateCategory, ID, Name, ParentID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotCreated
+	}
+	if cErr := categoryError(err); cErr != nil {
+		return nil, cErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to update category: %w", err)
+	}
+	return cat, nil
+}
+
+func (r *Repo) DeleteCategory(ctx context.Context, ID int64) error {
+	tag, err := r.db.Exec(ctx, deleteCategory, ID)
+	if _, ok := violatedConstraint(err, foreignKeyViolation); ok {
+		return ErrCategoryNotEmpty
+	}
+	if err != nil {
+		return fmt.Errorf("unable to delete category: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotCreated
+	}
+	return nil
+}
+
+func (r *Repo) CreateUser(ctx context.Context, Name string) (*ads.User, error) {
+	user, err := scanUser(r.db.QueryRow(ctx, insertUser, Name))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create user: %w", err)
+	}
 	return user, nil
 }
 
-func (r *Repo) GetUser(ID int64) (*ads.User, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	user := &ads.User{}
-	if err := r.conn.QueryRow(r.ctx, selectUser, ID).Scan(&user.ID, &user.Name); err != nil {
+func (r *Repo) CreateAccount(ctx context.Context, Name string, Email string, PasswordHash []byte) (*ads.User, error) {
+	user, err := scanUser(r.db.QueryRow(ctx, insertAccount, Name, Email, PasswordHash))
+	if _, ok := violatedConstraint(err, uniqueViolation); ok {
+		return nil, ErrEmailExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create user: %w", err)
+	}
+	return user, nil
+}
+
+func (r *Repo) GetCredentials(ctx context.Context, Email string) (int64, []byte, error) {
+	var id int64
+	var hash []byte
+	err := r.db.QueryRow(ctx, selectCredentials, Email).Scan(&id, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to get credentials: %w", err)
+	}
+	return id, hash, nil
+}
+
+func (r *Repo) AddRefreshToken(ctx context.Context, ID string, UserID int64, ExpiresAt time.Time) error {
+	if _, err := r.db.Exec(ctx, insertRefreshToken, ID, UserID, ExpiresAt); err != nil {
+		return fmt.Errorf("unable to add refresh token: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) RevokeRefreshToken(ctx context.Context, ID string) (bool, error) {
+	var active bool
+	err := r.db.QueryRow(ctx, revokeRefreshToken, ID).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to revoke refresh token: %w", err)
+	}
+	return active, nil
+}
+
+func (r *Repo) RevokeRefreshTokens(ctx context.Context, UserID int64) error {
+	if _, err := r.db.Exec(ctx, revokeRefreshTokens, UserID); err != nil {
+		return fmt.Errorf("unable to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) AddAPIKey(ctx context.Context, Key *ads.APIKey, Hash []byte) (*ads.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow(ctx, insertAPIKey, Key.UserID, Key.Name, Key.Prefix, Key.Scope, Hash))
+	if _, ok := violatedConstraint(err, foreignKeyViolation); ok {
 		return nil, ErrNotCreated
 	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to add API key: %w", err)
+	}
+	return key, nil
+}
+
+func (r *Repo) ListAPIKeys(ctx context.Context, UserID int64) ([]*ads.APIKey, error) {
+	rows, err := r.db.Query(ctx, selectAPIKeys, UserID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list API keys: %w", err)
+	}
+	defer rows.Close()
+	var res = make([]*ads.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan API key: %w", err)
+		}
+		res = append(res, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unable to list API keys: %w", err)
+	}
+	return res, nil
+}
+
+func (r *Repo) RevokeAPIKey(ctx context.Context, UserID int64, ID int64) error {
+	tag, err := r.db.Exec(ctx, revokeAPIKey, ID, UserID)
+	if err != nil {
+		return fmt.Errorf("unable to revoke API key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotCreated
+	}
+	return nil
+}
+
+func (r *Repo) RevokeAPIKeys(ctx context.Context, UserID int64) error {
+	if _, err := r.db.Exec(ctx, revokeAPIKeys, UserID); err != nil {
+		return fmt.Errorf("unable to revoke API keys: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) UseAPIKey(ctx context.Context, Hash []byte) (*ads.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRow(ctx, useAPIKey, Hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to use API key: %w", err)
+	}
+	return key, nil
+}
+
+func (r *Repo) GetUser(ctx context.Context, ID int64) (*ads.User, error) {
+	user, err := scanUser(r.db.QueryRow(ctx, selectUser, ID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user: %w", err)
+	}
+	if user.Deleted {
+		return nil, ErrWasDeleted
+	}
 	return user, nil
 }
 
-func (r *Repo) DeleteUser(ID int64) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	if _, err := r.conn.Exec(r.ctx, deleteUser, ID); err != nil {
+func (r *Repo) DeleteUser(ctx context.Context, ID int64, ActorID int64) error {
+	tag, err := r.db.Exec(ctx, deleteUser, ID, ActorID)
+	if err != nil {
+		return fmt.Errorf("unable to delete user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := r.GetUser(ctx, ID); err != nil {
+			return err
+		}
 		return ErrNotCreated
 	}
 	return nil
 }
 
-func New(ctx context.Context, conn *pgx.Conn) app.Repository {
-	return &Repo{ctx: ctx, conn: conn, mu: new(sync.Mutex)}
+func (r *Repo) RestoreUser(ctx context.Context, ID int64) (*ads.User, error) {
+	user, err := scanUser(r.db.QueryRow(ctx, restoreUser, ID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := r.GetUser(ctx, ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotDeleted
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to restore user: %w", err)
+	}
+	return user, nil
+}
+
+func (r *Repo) UpdateUser(ctx context.Context, in *ads.User) (*ads.User, error) {
+	user, err := scanUser(r.db.QueryRow(ctx, updateUser, in.ID, in.Name, in.Email, in.Phone, in.DisplayName, in.AvatarURL, in.About))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := r.GetUser(ctx, in.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotCreated
+	}
+	if _, ok := violatedConstraint(err, uniqueViolation); ok {
+		return nil, ErrEmailExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to update user: %w", err)
+	}
+	return user, nil
+}
+
+func (r *Repo) ListUsers(ctx context.Context, filter ads.UserFilter) ([]*ads.User, int64, error) {
+	list, listArgs, count, countArgs := listUsersSQL(filter)
+	rows, err := r.db.Query(ctx, list, listArgs...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to list users: %w", err)
+	}
+	defer rows.Close()
+	var total int64
+	var res = make([]*ads.User, 0)
+	for rows.Next() {
+		user, err := scanListedUser(rows, &total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("unable to scan user: %w", err)
+		}
+		res = append(res, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("unable to list users: %w", err)
+	}
+	if len(res) == 0 && filter.Offset > 0 {
+		if err := r.db.QueryRow(ctx, count, countArgs...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("unable to count users: %w", err)
+		}
+	}
+	return res, total, nil
+}
+
+func (r *Repo) SetUserRole(ctx context.Context, ID int64, Role ads.Role) (*ads.User, error) {
+	user, err := scanUser(r.db.QueryRow(ctx, setUserRole, ID, Role))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := r.GetUser(ctx, ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotCreated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to set user role: %w", err)
+	}
+	return user, nil
+}
+
+func NewPostgres(pool *pgxpool.Pool) app.Repository {
+	return &Repo{db: pool}
 }
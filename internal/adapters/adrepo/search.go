@@ -0,0 +1,83 @@
+package adrepo
+
+import (
+	"homework9/internal/ads"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// The in-memory repository approximates the Postgres full-text search:
+// texts are split into lowercase words, a query word matches any word
+// it is a prefix of (a poor man's stemming), and every query word must match.
+
+const (
+	titleWeight   = 1.0
+	textWeight    = 0.4
+	snippetBefore = 5
+	snippetWords  = 25
+)
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), isPunct)
+}
+
+func matchesWord(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func countMatches(words []string, term string) int {
+	n := 0
+	for _, w := range words {
+		if strings.HasPrefix(w, term) {
+			n++
+		}
+	}
+	return n
+}
+
+// searchAd reports whether the ad matches all query terms, and if so
+// fills in its rank and highlighted snippet.
+func searchAd(ad *ads.Ad, terms []string) bool {
+	title, text := tokenize(ad.Title), tokenize(ad.Text)
+	var rank float32
+	for _, term := range terms {
+		inTitle, inText := countMatches(title, term), countMatches(text, term)
+		if inTitle+inText == 0 {
+			return false
+		}
+		rank += titleWeight*float32(inTitle) + textWeight*float32(inText)
+	}
+	ad.Rank = rank
+	ad.Snippet = snippet(ad.Title+" "+ad.Text, terms)
+	return true
+}
+
+// snippet cuts a window of words around the first match and wraps
+// matching words in <b></b>, like ts_headline does. The words are
+// HTML-escaped first, as the Postgres repository escapes the text.
+func snippet(s string, terms []string) string {
+	words := strings.Fields(s)
+	first := -1
+	for i, w := range words {
+		words[i] = html.EscapeString(w)
+		if matchesWord(strings.ToLower(strings.TrimFunc(w, isPunct)), terms) {
+			if first == -1 {
+				first = i
+			}
+			words[i] = "<b>" + words[i] + "</b>"
+		}
+	}
+	start := max(first-snippetBefore, 0)
+	end := min(start+snippetWords, len(words))
+	return strings.Join(words[start:end], " ")
+}
+
+func isPunct(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -0,0 +1,111 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"homework9/internal/app"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+type Config struct {
+	Dir     string `env:"BLOB_DIR" envDefault:"./data/blobs"`
+	BaseURL string `env:"BLOB_BASE_URL" envDefault:"/api/v1/images/"` // prefix of the image URLs
+}
+
+// Local keeps blobs as files under a directory. Blobs are written to a
+// temporary file first and renamed into place, so readers never see a
+// partially written file.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal creates the directory if needed; empty config fields take the defaults.
+func NewLocal(cfg Config) (app.BlobStore, error) {
+	if cfg.Dir == "" {
+		cfg.Dir = "./data/blobs"
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "/api/v1/images/"
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create blob directory: %w", err)
+	}
+	baseURL := cfg.BaseURL
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &Local{dir: cfg.Dir, baseURL: baseURL}, nil
+}
+
+// path maps a key to a file inside the directory; keys that could
+// point outside of it are rejected.
+func (l *Local) path(key string) (string, error) {
+	if !fs.ValidPath(key) || key == "." || strings.Contains(key, `\`) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, err := l.path(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
+	return os.Open(path)
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.baseURL + (&url.URL{Path: key}).EscapedPath()
+}
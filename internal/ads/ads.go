@@ -3,24 +3,292 @@ package ads
 import "time"
 
 type Ad struct {
+	ID         int64    `json:"id"`
+	Title      string   `json:"title"`
+	Text       string   `json:"text"`
+	AuthorID   int64    `json:"author_id"`
+	CategoryID *int64   `json:"category_id"`
+	Tags       []string `json:"tags"`
+	Price      *int64   `json:"price"`    // in minor units, e.g. kopecks; nil - no price
+	Currency   string   `json:"currency"` // ISO 4217 code, set together with Price
+	Images     []Image  `json:"images"`   // in display order
+	Status     AdStatus `json:"status"`
+	Published  bool     `json:"published"` // Status == StatusPublished
+	// RejectionReason is set by the moderator who rejected the ad.
+	RejectionReason string `json:"rejection_reason"`
+	// PublishAt and ExpiresAt are the scheduled times of publishing and unpublishing the ad.
+	// Each is cleared once the scheduler has acted on it.
+	PublishAt *time.Time `json:"publish_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// Favorites is the number of users, not deleted, who added the ad to their favorites.
+	Favorites   int64      `json:"favorites"`
+	Version     int64      `json:"version"`
+	Deleted     bool       `json:"deleted"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+	DeletedBy   *int64     `json:"deleted_by"`
+	DateCreated time.Time  `json:"date_created"`
+	DateUpdated time.Time  `json:"date_updated"`
+
+	// Rank and Snippet are filled only in search results (AdFilter.Query).
+	Rank    float32 `json:"-"`
+	Snippet string  `json:"-"`
+}
+
+// AdStatus is a state of the ad lifecycle:
+// draft → pending_review → approved or rejected → published ⇄ archived.
+type AdStatus string
+
+const (
+	StatusDraft         AdStatus = "draft"
+	StatusPendingReview AdStatus = "pending_review"
+	StatusApproved      AdStatus = "approved"
+	StatusRejected      AdStatus = "rejected"
+	StatusPublished     AdStatus = "published"
+	StatusArchived      AdStatus = "archived"
+)
+
+// AdInput holds the fields of an ad that its author sets on create and update.
+type AdInput struct {
+	Title      string
+	Text       string
+	CategoryID *int64   // nil - no category
+	Tags       []string // normalized by the app: lowercase, sorted, without duplicates
+	Price      *int64
+	Currency   string
+}
+
+// Image is a photo attached to an ad. The file itself lives in a blob store under Key.
+type Image struct {
+	ID          int64  `json:"id"`
+	AdID        int64  `json:"ad_id"`
+	Key         string `json:"key"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Position    int    `json:"position"`
+	URL         string `json:"-"` // filled by the app from the blob store
+}
+
+// Category is a node of the category tree; root categories have no parent.
+type Category struct {
+	ID          int64     `json:"id"`
+	ParentID    *int64    `json:"parent_id"`
+	Name        string    `json:"name"`
+	DateCreated time.Time `json:"date_created"`
+}
+
+// Revision is a recorded change of an ad's title, text or status.
+type Revision struct {
+	ID           int64     `json:"id"`
+	AdID         int64     `json:"ad_id"`
+	ActorID      int64     `json:"actor_id"`
+	OldTitle     string    `json:"old_title"`
+	NewTitle     string    `json:"new_title"`
+	OldText      string    `json:"old_text"`
+	NewText      string    `json:"new_text"`
+	OldPublished bool      `json:"old_published"`
+	NewPublished bool      `json:"new_published"`
+	OldStatus    AdStatus  `json:"old_status"`
+	NewStatus    AdStatus  `json:"new_status"`
+	DateCreated  time.Time `json:"date_created"`
+}
+
+// Thread is a conversation about an ad between a buyer and the author of the ad.
+// There is at most one thread per ad and buyer.
+type Thread struct {
+	ID       int64 `json:"id"`
+	AdID     int64 `json:"ad_id"`
+	BuyerID  int64 `json:"buyer_id"`
+	SellerID int64 `json:"seller_id"`
+	// Unread is the number of messages the user who requested the thread has not read yet.
+	Unread      int64     `json:"unread"`
+	DateCreated time.Time `json:"date_created"`
+	DateUpdated time.Time `json:"date_updated"` // the time of the last message
+}
+
+type Message struct {
+	ID          int64      `json:"id"`
+	ThreadID    int64      `json:"thread_id"`
+	SenderID    int64      `json:"sender_id"`
+	Text        string     `json:"text"`
+	ReadAt      *time.Time `json:"read_at"` // nil until the other party reads the message
+	DateCreated time.Time  `json:"date_created"`
+}
+
+// Report is a complaint of a user about an ad. A user can have one open report per ad.
+type Report struct {
+	ID          int64            `json:"id"`
+	AdID        int64            `json:"ad_id"`
+	ReporterID  int64            `json:"reporter_id"`
+	Reason      ReportReason     `json:"reason"`
+	Comment     string           `json:"comment"`
+	Status      ReportStatus     `json:"status"`
+	Resolution  ReportResolution `json:"resolution"` // empty while the report is open
+	ResolvedBy  *int64           `json:"resolved_by"`
+	ResolvedAt  *time.Time       `json:"resolved_at"`
+	DateCreated time.Time        `json:"date_created"`
+}
+
+type ReportReason string
+
+const (
+	ReasonScam      ReportReason = "scam"
+	ReasonIllegal   ReportReason = "illegal"
+	ReasonSpam      ReportReason = "spam"
+	ReasonOffensive ReportReason = "offensive"
+	ReasonOther     ReportReason = "other"
+)
+
+type ReportStatus string
+
+const (
+	ReportOpen     ReportStatus = "open"
+	ReportResolved ReportStatus = "resolved"
+)
+
+// ReportResolution is what a moderator did about the reported ad.
+type ReportResolution string
+
+const (
+	ResolutionDismissed   ReportResolution = "dismissed"
+	ResolutionUnpublished ReportResolution = "unpublished"
+	ResolutionDeleted     ReportResolution = "deleted"
+)
+
+// ReportGroup is the open reports about one ad, oldest first.
+type ReportGroup struct {
+	AdID    int64    `json:"ad_id"`
+	Reports []Report `json:"reports"`
+}
+
+// Notification is a message the service sends to a user.
+type Notification struct {
 	ID          int64     `json:"id"`
-	Title       string    `json:"title"`
+	UserID      int64     `json:"user_id"`
 	Text        string    `json:"text"`
-	AuthorID    int64     `json:"author_id"`
-	Published   bool      `json:"published"`
-	Deleted     bool      `json:"deleted"`
 	DateCreated time.Time `json:"date_created"`
-	DateUpdated time.Time `json:"date_updated"`
+}
+
+// APIKey is a long-lived credential of a user for machine clients.
+// Only a hash of the key is stored; Prefix identifies the key in lists.
+type APIKey struct {
+	ID          int64       `json:"id"`
+	UserID      int64       `json:"user_id"`
+	Name        string      `json:"name"`
+	Prefix      string      `json:"prefix"`
+	Scope       APIKeyScope `json:"scope"`
+	LastUsedAt  *time.Time  `json:"last_used_at"`
+	RevokedAt   *time.Time  `json:"revoked_at"`
+	DateCreated time.Time   `json:"date_created"`
+}
+
+type APIKeyScope string
+
+const (
+	ScopeRead     APIKeyScope = "read"      // read-only requests
+	ScopeAdsWrite APIKeyScope = "ads:write" // reads and changes of the user's ads
+)
+
+// Allows reports whether a key with the scope may make requests that need the other scope.
+func (s APIKeyScope) Allows(need APIKeyScope) bool {
+	switch need {
+	case ScopeRead:
+		return s == ScopeRead || s == ScopeAdsWrite
+	case ScopeAdsWrite:
+		return s == ScopeAdsWrite
+	}
+	return false
 }
 
 type User struct {
-	ID      int64  `json:"id"`
-	Name    string `json:"name"`
-	Deleted bool   `json:"deleted"`
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Email       string     `json:"email"` // empty for users created without credentials
+	Phone       string     `json:"phone"` // E.164, e.g. +79991234567
+	DisplayName string     `json:"display_name"`
+	AvatarURL   string     `json:"avatar_url"`
+	About       string     `json:"about"`
+	Role        Role       `json:"role"`
+	Deleted     bool       `json:"deleted"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+	DeletedBy   *int64     `json:"deleted_by"`
+	DateCreated time.Time  `json:"date_created"`
+	// ActiveAds is the number of published ads, filled only in user lists.
+	ActiveAds int64 `json:"-"`
 }
 
+// Public returns the profile as other users see it: without contacts
+// and the details of deletion.
+func (u *User) Public() *User {
+	return &User{ID: u.ID, Name: u.Name, DisplayName: u.DisplayName, AvatarURL: u.AvatarURL, About: u.About,
+		Role: u.Role, Deleted: u.Deleted, DateCreated: u.DateCreated}
+}
+
+// UserUpdate changes the profile fields that are not nil.
+type UserUpdate struct {
+	Name        *string
+	Email       *string
+	Phone       *string
+	DisplayName *string
+	AvatarURL   *string
+	About       *string
+}
+
+// UserFilter selects users in the admin listing.
+type UserFilter struct {
+	Query   string // part of the name or the email, case-insensitive
+	Role    Role   // empty - any role
+	Deleted *bool  // nil - both deleted and active users
+	Sort    UserSort
+	Limit   int
+	Offset  int
+}
+
+// UserSort is the order of users in a list.
+type UserSort string
+
+const (
+	// UserSortDefault orders users by id.
+	UserSortDefault         UserSort = ""
+	UserSortDateCreated     UserSort = "date_created"
+	UserSortDateCreatedDesc UserSort = "-date_created"
+)
+
+// Role grants a user permissions beyond managing their own ads and account.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator" // reviews ads and resolves reports
+	RoleAdmin     Role = "admin"     // everything a moderator does, and manages ads, users and categories
+)
+
 type AdFilter struct {
-	Pub   bool
-	Auth  int64
-	Title string
+	Pub    bool
+	Auth   int64
+	Title  string
+	Query  string   // full-text search over titles and texts
+	Status AdStatus // empty - any status
+	// Category limits the list to ads of this category and all its subcategories.
+	Category *int64
+	// FavoritesOf limits the list to the favorite ads of this user.
+	FavoritesOf *int64
+	Tags        []string // ads having all of these tags
+	// MinPrice and MaxPrice bound the price in minor units, both inclusive.
+	// Amounts in different currencies are not comparable, so they need Currency.
+	MinPrice *int64
+	MaxPrice *int64
+	Currency string
+	Sort     AdSort
+	Limit    int // 0 means no limit
+	Offset   int
 }
+
+// AdSort is the order of ads in a list.
+type AdSort string
+
+const (
+	// SortDefault orders search results by relevance and other lists by id.
+	SortDefault   AdSort = ""
+	SortPriceAsc  AdSort = "price"
+	SortPriceDesc AdSort = "-price"
+)
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"homework9/internal/ads"
+	"strings"
+)
+
+var ErrInvalidAPIKey = errors.New("API key is invalid or revoked")
+var ErrScope = errors.New("API key scope does not allow this request")
+
+const (
+	// apiKeyNameMaxLength is the size of api_keys.name.
+	apiKeyNameMaxLength = 100
+	apiKeyPrefix        = "ak_"
+	// apiKeyShownLength is how much of the key is kept in the clear to tell keys apart.
+	apiKeyShownLength = len(apiKeyPrefix) + 8
+)
+
+type apiKeyCtxKey struct{}
+
+// ContextWithAPIKey marks the context of a request as authenticated with the key.
+func ContextWithAPIKey(ctx context.Context, key *ads.APIKey) context.Context {
+	return context.WithValue(ContextWithUser(ctx, key.UserID), apiKeyCtxKey{}, key)
+}
+
+// APIKeyFromContext returns the API key the request was authenticated with, if any.
+func APIKeyFromContext(ctx context.Context) (*ads.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyCtxKey{}).(*ads.APIKey)
+	return key, ok
+}
+
+// CheckScope returns ErrScope if the request was authenticated with an API key
+// whose scope does not allow the need. An empty need means that the request
+// cannot be made with an API key at all. Requests without a key pass.
+func CheckScope(ctx context.Context, need ads.APIKeyScope) error {
+	key, ok := APIKeyFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if !key.Scope.Allows(need) {
+		return ErrScope
+	}
+	return nil
+}
+
+func hashAPIKey(Key string) []byte {
+	sum := sha256.Sum256([]byte(Key))
+	return sum[:]
+}
+
+func validateAPIKey(Name string, Scope ads.APIKeyScope) error {
+	var v validator
+	v.required("name", Name)
+	v.maxLength("name", Name, apiKeyNameMaxLength)
+	if Scope != ads.ScopeRead && Scope != ads.ScopeAdsWrite {
+		v.violations = append(v.violations, Violation{Field: "scope", Rule: RuleOneOf})
+	}
+	return v.err()
+}
+
+// CreateAPIKey returns the new key together with its secret, which is not stored
+// and cannot be shown again. Keys cannot be created with another API key.
+func (apm *AppMethods) CreateAPIKey(c context.Context, UserID int64, Name string, Scope ads.APIKeyScope) (*ads.APIKey, string, error) {
+	if _, ok := APIKeyFromContext(c); ok {
+		return nil, "", ErrScope
+	}
+	Name = strings.TrimSpace(Name)
+	if err := validateAPIKey(Name, Scope); err != nil {
+		return nil, "", err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	secret := apiKeyPrefix + randomToken(24)
+	var key *ads.APIKey
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		if _, err = tx.GetUser(ctx, UserID); err != nil {
+			return err
+		}
+		in := &ads.APIKey{UserID: UserID, Name: Name, Prefix: secret[:apiKeyShownLength], Scope: Scope}
+		key, err = tx.AddAPIKey(ctx, in, hashAPIKey(secret))
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+func (apm *AppMethods) ListAPIKeys(c context.Context, UserID int64) ([]*ads.APIKey, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.List)
+	defer cancel()
+	if _, err := apm.r.GetUser(ctx, UserID); err != nil {
+		return nil, err
+	}
+	return apm.r.ListAPIKeys(ctx, UserID)
+}
+
+func (apm *AppMethods) RevokeAPIKey(c context.Context, UserID int64, KeyID int64) error {
+	if _, ok := APIKeyFromContext(c); ok {
+		return ErrScope
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	return apm.r.RevokeAPIKey(ctx, UserID, KeyID)
+}
+
+func (apm *AppMethods) AuthenticateAPIKey(c context.Context, Key string) (*ads.APIKey, error) {
+	if !strings.HasPrefix(Key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	key, err := apm.r.UseAPIKey(ctx, hashAPIKey(Key))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return key, nil
+}
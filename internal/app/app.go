@@ -2,85 +2,564 @@ package app
 
 import (
 	"context"
+	"errors"
 	"homework9/internal/ads"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrUserHasActiveAds = errors.New("user has published ads")
+var ErrNotAuthor = errors.New("not author")
+
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
 )
 
 type App interface {
-	CreateAd(c context.Context, Title string, Text string, UserID int64) (*ads.Ad, error)
-	ChangeAdStatus(c context.Context, ID int64, UserID int64, Published bool) (*ads.Ad, error)
-	UpdateAd(c context.Context, ID int64, UserID int64, Title string, Text string) (*ads.Ad, error)
-	GetList(c context.Context, filter ads.AdFilter) ([]*ads.Ad, error)
+	// CreateAd and UpdateAd fail with *ValidationError if the input breaks the limits or
+	// has a price without a known currency, and with adrepo.ErrUnknownCategory if the
+	// category does not exist.
+	// CreateAd fails with adrepo.ErrUnknownAuthor if the user does not exist or was deleted.
+	CreateAd(c context.Context, in ads.AdInput, UserID int64) (*ads.Ad, error)
+	// ChangeAdStatus and UpdateAd fail with adrepo.ErrConflict if Version is not
+	// zero and does not match the current version of the ad.
+	// ChangeAdStatus, UpdateAd and DeleteAd fail with ErrNotAuthor unless UserID is
+	// the author or an admin; admins may unpublish, but not publish, ads of other users.
+	// ChangeAdStatus publishes or archives the ad. When moderation is required,
+	// only approved and archived ads can be published, otherwise it fails with
+	// ErrStatusTransition.
+	ChangeAdStatus(c context.Context, ID int64, UserID int64, Published bool, Version int64) (*ads.Ad, error)
+	// UpdateAd returns a reviewed ad to drafts when moderation is required.
+	UpdateAd(c context.Context, ID int64, UserID int64, in ads.AdInput, Version int64) (*ads.Ad, error)
+	// SubmitAd sends a draft or rejected ad to review.
+	SubmitAd(c context.Context, ID int64, UserID int64, Version int64) (*ads.Ad, error)
+	// ApproveAd and RejectAd decide on an ad pending review. They fail with
+	// ErrStatusTransition for an ad in another status.
+	// ApproveAd, RejectAd, ModerationQueue, ListReports and ResolveReports fail with
+	// ErrNoPermission unless the moderator is a moderator or an admin.
+	ApproveAd(c context.Context, ID int64, ModeratorID int64, Version int64) (*ads.Ad, error)
+	// RejectAd fails with *ValidationError if the reason is empty or too long.
+	RejectAd(c context.Context, ID int64, ModeratorID int64, Reason string, Version int64) (*ads.Ad, error)
+	// ModerationQueue returns a page of ads pending review, oldest first.
+	ModerationQueue(c context.Context, ModeratorID int64, Limit int, Offset int) ([]*ads.Ad, int64, error)
+	// AddFavorite adds the ad to the favorites of the user and returns it with
+	// the updated number of favorites. Adding it again does nothing.
+	// It fails with ErrAdNotPublished unless the ad is published.
+	AddFavorite(c context.Context, UserID int64, AdID int64) (*ads.Ad, error)
+	// RemoveFavorite does nothing if the ad is not in the favorites.
+	RemoveFavorite(c context.Context, UserID int64, AdID int64) error
+	// ListFavorites returns a page of the published favorite ads of the user, ordered by id.
+	ListFavorites(c context.Context, UserID int64, Limit int, Offset int) ([]*ads.Ad, int64, error)
+	// SendAdMessage writes to the author of a published ad, starting a thread
+	// or continuing the one the sender already has about the ad.
+	// It fails with ErrOwnAd if the sender is the author.
+	SendAdMessage(c context.Context, AdID int64, SenderID int64, Text string) (*ads.Message, error)
+	// SendMessage, ListMessages and MarkThreadRead fail with ErrNotParticipant
+	// unless the user is the buyer or the seller of the thread.
+	// Threads stay available after the ad is unpublished or deleted.
+	SendMessage(c context.Context, ThreadID int64, SenderID int64, Text string) (*ads.Message, error)
+	// ListThreads returns a page of the threads of the user, most recently active first.
+	ListThreads(c context.Context, UserID int64, Limit int, Offset int) ([]*ads.Thread, int64, error)
+	// ListMessages returns a page of the messages of the thread, oldest first.
+	ListMessages(c context.Context, ThreadID int64, UserID int64, Limit int, Offset int) ([]*ads.Message, int64, error)
+	// MarkThreadRead marks the messages the user has received in the thread as read.
+	MarkThreadRead(c context.Context, ThreadID int64, UserID int64) (*ads.Thread, error)
+	// UnreadCount returns the number of unread messages the user has received in all threads.
+	UnreadCount(c context.Context, UserID int64) (int64, error)
+	// ReportAd files a complaint about the ad. It fails with *ValidationError for an
+	// unknown reason or a too long comment, with ErrOwnAd if the reporter is the author
+	// and with adrepo.ErrAlreadyReported if the reporter has an open report on the ad.
+	ReportAd(c context.Context, AdID int64, ReporterID int64, Reason ads.ReportReason, Comment string) (*ads.Report, error)
+	// ListReports returns a page of the ads with open reports, grouped by ad,
+	// the most reported ads first, and the number of such ads.
+	ListReports(c context.Context, ModeratorID int64, Limit int, Offset int) ([]*ads.ReportGroup, int64, error)
+	// ResolveReports closes all open reports on the ad, unpublishing or deleting
+	// the ad depending on Resolution, and notifies the reporters.
+	// It fails with ErrNoOpenReports if the ad has no open reports.
+	ResolveReports(c context.Context, AdID int64, ModeratorID int64, Resolution ads.ReportResolution) ([]*ads.Report, error)
+	// ListNotifications returns a page of the notifications of the user, newest first.
+	ListNotifications(c context.Context, UserID int64, Limit int, Offset int) ([]*ads.Notification, int64, error)
+	// GetList fails with *ValidationError if a price bound comes without a currency.
+	GetList(c context.Context, filter ads.AdFilter) ([]*ads.Ad, int64, error)
 	GetByID(c context.Context, ID int64) (*ads.Ad, error)
+	// DeleteAd and RestoreAd are allowed to the author and to admins. An ad deleted
+	// by a moderator or an admin is restored by admins only, e.g. after reports.
 	DeleteAd(c context.Context, ID int64, UserID int64) error
-	CreateUser(c context.Context, Name string) (*ads.User, error)
-	GetUser(c context.Context, ID int64) (*ads.User, error)
-	DeleteUser(c context.Context, ID int64) error
+	RestoreAd(c context.Context, ID int64, UserID int64) (*ads.Ad, error)
+	// ScheduleAd sets the times the ad is published and unpublished at; nil clears a time.
+	// It fails with *ValidationError unless ExpiresAt is in the future and after PublishAt.
+	ScheduleAd(c context.Context, ID int64, UserID int64, PublishAt *time.Time, ExpiresAt *time.Time, Version int64) (*ads.Ad, error)
+	// ApplySchedule publishes and unpublishes the ads whose scheduled time is not after now
+	// and returns the number of ads it has processed.
+	ApplySchedule(c context.Context, now time.Time) (int, error)
+	// ListRevisions returns the change history of an ad, oldest first.
+	// ListRevisions and RollbackAd are allowed to the author and to admins.
+	ListRevisions(c context.Context, ID int64, UserID int64) ([]*ads.Revision, error)
+	// RollbackAd returns the ad to the state it had before the revision, recording a new revision.
+	// A rollback by an admin does not publish the ad.
+	RollbackAd(c context.Context, ID int64, RevisionID int64, UserID int64, Version int64) (*ads.Ad, error)
+	// AddImage stores an image of the ad. It fails with ErrImageType unless the data is
+	// a JPEG, PNG, GIF or WebP image, and with ErrImageTooLarge or ErrTooManyImages
+	// when the limits are exceeded. Images are managed by the author and by admins.
+	AddImage(c context.Context, ID int64, UserID int64, r io.Reader) (*ads.Image, error)
+	DeleteImage(c context.Context, ID int64, ImageID int64, UserID int64) error
+	// ReorderImages fails with ErrImageOrder unless ImageIDs lists every image of the ad once.
+	ReorderImages(c context.Context, ID int64, UserID int64, ImageIDs []int64) ([]*ads.Image, error)
+	// OpenImage returns the content of a stored image by its key.
+	OpenImage(c context.Context, Key string) (io.ReadCloser, error)
+	// CreateCategory, UpdateCategory and DeleteCategory fail with ErrNoPermission unless the user is an admin.
+	CreateCategory(c context.Context, Name string, ParentID *int64, UserID int64) (*ads.Category, error)
+	GetCategory(c context.Context, ID int64) (*ads.Category, error)
+	// ListCategories returns the whole category tree as a flat list ordered by id.
+	ListCategories(c context.Context) ([]*ads.Category, error)
+	// UpdateCategory renames or moves a category. It fails with ErrCategoryCycle
+	// if the new parent is the category itself or one of its subcategories.
+	UpdateCategory(c context.Context, ID int64, UserID int64, Name string, ParentID *int64) (*ads.Category, error)
+	// DeleteCategory fails with adrepo.ErrCategoryNotEmpty while the category
+	// has subcategories or ads.
+	DeleteCategory(c context.Context, ID int64, UserID int64) error
+	// CreateUser creates a user without credentials. It is allowed to admins only;
+	// users sign themselves up with Register.
+	CreateUser(c context.Context, AdminID int64, Name string) (*ads.User, error)
+	// Register creates a user who can log in with the email and password. It fails with
+	// *ValidationError for a malformed email or a password shorter than 8 or longer than
+	// 72 bytes, and with adrepo.ErrEmailExists if the email is taken.
+	Register(c context.Context, Name string, Email string, Password string) (*ads.User, error)
+	// Login fails with ErrInvalidCredentials unless a user, not deleted, has the email and password.
+	Login(c context.Context, Email string, Password string) (*Tokens, error)
+	// RefreshTokens and Logout fail with ErrInvalidToken for a malformed, expired or,
+	// for RefreshTokens, already used or revoked refresh token.
+	RefreshTokens(c context.Context, RefreshToken string) (*Tokens, error)
+	Logout(c context.Context, RefreshToken string) error
+	// Authenticate returns the user of a valid access token and fails with ErrInvalidToken otherwise,
+	// including tokens of missing and deleted users.
+	Authenticate(c context.Context, AccessToken string) (int64, error)
+	// CreateAPIKey returns the key and its secret; the secret is shown only once.
+	// Keys are managed with access tokens: requests made with an API key fail with ErrScope.
+	CreateAPIKey(c context.Context, UserID int64, Name string, Scope ads.APIKeyScope) (*ads.APIKey, string, error)
+	ListAPIKeys(c context.Context, UserID int64) ([]*ads.APIKey, error)
+	RevokeAPIKey(c context.Context, UserID int64, KeyID int64) error
+	// AuthenticateAPIKey returns an active key with the secret, recording its use,
+	// and fails with ErrInvalidAPIKey otherwise.
+	AuthenticateAPIKey(c context.Context, Key string) (*ads.APIKey, error)
+	// GetUser returns the whole profile to the user itself and to admins, and
+	// the public one to others. A negative ViewerID stands for an anonymous request.
+	GetUser(c context.Context, ID int64, ViewerID int64) (*ads.User, error)
+	// UpdateUser fails with *ValidationError for invalid fields, with
+	// adrepo.ErrEmailExists if the email is taken, and with ErrNoPermission
+	// unless ActorID is the user or an admin.
+	UpdateUser(c context.Context, ID int64, ActorID int64, in ads.UserUpdate) (*ads.User, error)
+	// ListUsers returns a page of users with the numbers of their published ads,
+	// and the number of users matching the filter. It is allowed to admins only.
+	ListUsers(c context.Context, AdminID int64, filter ads.UserFilter) ([]*ads.User, int64, error)
+	// DeleteUser fails with ErrNoPermission unless ActorID is the user or an admin,
+	// and with ErrUserHasActiveAds under the DeleteUserRestrict policy.
+	DeleteUser(c context.Context, ID int64, ActorID int64) error
+	// RestoreUser is allowed to admins only: a deleted user cannot authenticate.
+	RestoreUser(c context.Context, ID int64, ActorID int64) (*ads.User, error)
+	// SetUserRole is allowed to admins only.
+	SetUserRole(c context.Context, ID int64, ActorID int64, Role ads.Role) (*ads.User, error)
 }
 
+// Repository methods take the request context. When it is canceled or its
+// deadline passes, the query is interrupted and the error wraps
+// context.Canceled or context.DeadlineExceeded.
 type Repository interface {
-	Create(Title string, Text string, UserID int64) (*ads.Ad, error)
-	UpdatePublished(ID int64, UserID int64, Published bool) (*ads.Ad, error)
-	UpdateTextAndTitle(ID int64, UserID int64, Title string, Text string) (*ads.Ad, error)
-	GetList(filter ads.AdFilter) ([]*ads.Ad, error)
-	GetByID(ID int64) (*ads.Ad, error)
-	DeleteAd(ID int64, UserID int64) error
-	CreateUser(Name string) (*ads.User, error)
-	GetUser(ID int64) (*ads.User, error)
-	DeleteUser(ID int64) error
+	Create(ctx context.Context, in ads.AdInput, UserID int64) (*ads.Ad, error)
+	// UpdateStatus and UpdateContent increment the ad version.
+	// A non-zero Version is the version the caller expects the ad to have.
+	// UpdateStatus fails with adrepo.ErrConflict unless the ad is in the status From;
+	// the app checks who may make the transition.
+	UpdateStatus(ctx context.Context, ID int64, From ads.AdStatus, To ads.AdStatus, Reason string, Version int64) (*ads.Ad, error)
+	UpdateContent(ctx context.Context, ID int64, UserID int64, in ads.AdInput, Version int64) (*ads.Ad, error)
+	UpdateSchedule(ctx context.Context, ID int64, UserID int64, PublishAt *time.Time, ExpiresAt *time.Time, Version int64) (*ads.Ad, error)
+	// ListDueAds returns up to limit ads, ordered by id, with ExpiresAt or PublishAt not after now.
+	// Only ads in the publishable statuses are due to be published, and ads of deleted
+	// users are not until the user is restored.
+	ListDueAds(ctx context.Context, now time.Time, publishable []ads.AdStatus, limit int) ([]*ads.Ad, error)
+	// GetList returns a page of ads matching the filter and the total number of matches.
+	GetList(ctx context.Context, filter ads.AdFilter) ([]*ads.Ad, int64, error)
+	GetByID(ctx context.Context, ID int64) (*ads.Ad, error)
+	// DeleteAd and DeleteUser mark records as deleted; deleted records are
+	// hidden from lists and lookups until restored.
+	DeleteAd(ctx context.Context, ID int64, UserID int64) error
+	// ForceDeleteAd deletes the ad on behalf of ActorID without checking the author;
+	// the app checks that ActorID may delete it.
+	ForceDeleteAd(ctx context.Context, ID int64, ActorID int64) error
+	RestoreAd(ctx context.Context, ID int64, UserID int64) (*ads.Ad, error)
+	// LockAd returns the ad, deleted or not, and inside RunInTx locks it
+	// until the end of the transaction.
+	LockAd(ctx context.Context, ID int64) (*ads.Ad, error)
+	AddRevision(ctx context.Context, rev *ads.Revision) (*ads.Revision, error)
+	// ListRevisions fails with adrepo.ErrNotAuthor unless UserID is the author of the ad.
+	ListRevisions(ctx context.Context, AdID int64, UserID int64) ([]*ads.Revision, error)
+	GetRevision(ctx context.Context, AdID int64, ID int64) (*ads.Revision, error)
+	// ListImages returns the images of an ad in display order.
+	// It fails with adrepo.ErrNotAuthor unless UserID is the author of the ad.
+	ListImages(ctx context.Context, AdID int64, UserID int64) ([]*ads.Image, error)
+	// AddImage appends the image after the existing images of the ad.
+	AddImage(ctx context.Context, img *ads.Image) (*ads.Image, error)
+	// DeleteImage returns the removed image, so its blob can be deleted.
+	DeleteImage(ctx context.Context, AdID int64, ID int64) (*ads.Image, error)
+	// ReorderImages moves the images to the positions of their ids in IDs.
+	ReorderImages(ctx context.Context, AdID int64, IDs []int64) error
+	// AddFavorite and RemoveFavorite are idempotent. Favorites of deleted users and
+	// deleted ads are kept, but not counted and not listed, until they are restored.
+	AddFavorite(ctx context.Context, UserID int64, AdID int64) error
+	RemoveFavorite(ctx context.Context, UserID int64, AdID int64) error
+	// GetOrCreateThread returns the thread of the buyer about the ad, creating it if needed.
+	GetOrCreateThread(ctx context.Context, AdID int64, BuyerID int64, SellerID int64) (*ads.Thread, error)
+	// GetThread and ListThreads fill Thread.Unread for UserID.
+	GetThread(ctx context.Context, ID int64, UserID int64) (*ads.Thread, error)
+	ListThreads(ctx context.Context, UserID int64, Limit int, Offset int) ([]*ads.Thread, int64, error)
+	// AddMessage also moves the DateUpdated of the thread to the time of the message.
+	AddMessage(ctx context.Context, msg *ads.Message) (*ads.Message, error)
+	ListMessages(ctx context.Context, ThreadID int64, Limit int, Offset int) ([]*ads.Message, int64, error)
+	// MarkRead marks the messages of the thread not sent by UserID as read.
+	MarkRead(ctx context.Context, ThreadID int64, UserID int64) error
+	CountUnread(ctx context.Context, UserID int64) (int64, error)
+	// AddReport fails with adrepo.ErrAlreadyReported if the reporter has an open report on the ad.
+	AddReport(ctx context.Context, rep *ads.Report) (*ads.Report, error)
+	// ListReportGroups returns a page of the groups of open reports and the number of groups.
+	ListReportGroups(ctx context.Context, Limit int, Offset int) ([]*ads.ReportGroup, int64, error)
+	// ResolveReports resolves the open reports on the ad and returns them.
+	ResolveReports(ctx context.Context, AdID int64, ModeratorID int64, Resolution ads.ReportResolution) ([]*ads.Report, error)
+	AddNotification(ctx context.Context, n *ads.Notification) (*ads.Notification, error)
+	ListNotifications(ctx context.Context, UserID int64, Limit int, Offset int) ([]*ads.Notification, int64, error)
+	CreateCategory(ctx context.Context, Name string, ParentID *int64) (*ads.Category, error)
+	GetCategory(ctx context.Context, ID int64) (*ads.Category, error)
+	ListCategories(ctx context.Context) ([]*ads.Category, error)
+	UpdateCategory(ctx context.Context, ID int64, Name string, ParentID *int64) (*ads.Category, error)
+	DeleteCategory(ctx context.Context, ID int64) error
+	CreateUser(ctx context.Context, Name string) (*ads.User, error)
+	// CreateAccount fails with adrepo.ErrEmailExists if another user has the email.
+	CreateAccount(ctx context.Context, Name string, Email string, PasswordHash []byte) (*ads.User, error)
+	// GetCredentials returns a nil hash if no user, not deleted, has the email.
+	GetCredentials(ctx context.Context, Email string) (int64, []byte, error)
+	AddRefreshToken(ctx context.Context, ID string, UserID int64, ExpiresAt time.Time) error
+	// RevokeRefreshToken reports whether the token was active, that is neither revoked nor expired.
+	RevokeRefreshToken(ctx context.Context, ID string) (bool, error)
+	RevokeRefreshTokens(ctx context.Context, UserID int64) error
+	AddAPIKey(ctx context.Context, Key *ads.APIKey, Hash []byte) (*ads.APIKey, error)
+	ListAPIKeys(ctx context.Context, UserID int64) ([]*ads.APIKey, error)
+	// RevokeAPIKey fails if the user has no such key; revoking a revoked key succeeds.
+	RevokeAPIKey(ctx context.Context, UserID int64, ID int64) error
+	RevokeAPIKeys(ctx context.Context, UserID int64) error
+	// UseAPIKey sets the last use time of the active key with the hash and returns it,
+	// or returns nil if there is no such key.
+	UseAPIKey(ctx context.Context, Hash []byte) (*ads.APIKey, error)
+	GetUser(ctx context.Context, ID int64) (*ads.User, error)
+	// UpdateUser stores the profile fields of the user. It fails with
+	// adrepo.ErrEmailExists if another user has the email.
+	UpdateUser(ctx context.Context, user *ads.User) (*ads.User, error)
+	// ListUsers fills ActiveAds of the users it returns.
+	ListUsers(ctx context.Context, filter ads.UserFilter) ([]*ads.User, int64, error)
+	DeleteUser(ctx context.Context, ID int64, ActorID int64) error
+	RestoreUser(ctx context.Context, ID int64) (*ads.User, error)
+	SetUserRole(ctx context.Context, ID int64, Role ads.Role) (*ads.User, error)
+
+	// RunInTx calls fn with a repository bound to a single transaction.
+	// The transaction is committed if fn returns nil and rolled back otherwise.
+	RunInTx(ctx context.Context, fn func(tx Repository) error) error
 }
 
 type AppMethods struct {
-	r Repository
+	r                Repository
+	userDeletePolicy UserDeletePolicy
+	timeouts         Timeouts
+	limits           Limits
+	blobs            BlobStore
+	moderation       bool
+	auth             Auth
 }
 
-func (apm *AppMethods) CreateAd(c context.Context, Title string, Text string, UserID int64) (*ads.Ad, error) {
-	ad, err := apm.r.Create(Title, Text, UserID)
+func (apm *AppMethods) CreateAd(c context.Context, in ads.AdInput, UserID int64) (*ads.Ad, error) {
+	in.Tags = normalizeTags(in.Tags)
+	in.Currency = normalizeCurrency(in.Currency)
+	if err := apm.limits.validateAd(in); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	ad, err := apm.r.Create(ctx, in, UserID)
 	if err != nil {
 		return nil, err
 	}
+	apm.withImageURLs(ad)
 	return ad, nil
 }
 
-func (apm *AppMethods) ChangeAdStatus(c context.Context, ID int64, UserID int64, Published bool) (*ads.Ad, error) {
-	ad, err := apm.r.UpdatePublished(ID, UserID, Published)
+func (apm *AppMethods) ChangeAdStatus(c context.Context, ID int64, UserID int64, Published bool, Version int64) (*ads.Ad, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var ad *ads.Ad
+	err := apm.r.RunInTx(ctx, func(tx Repository) error {
+		cur, err := tx.GetByID(ctx, ID)
+		if err != nil {
+			return err
+		}
+		if _, err := actingAuthor(ctx, tx, cur, UserID, PermManageAds); err != nil {
+			return err
+		}
+		// Admins may unpublish ads of other users, but only authors publish them.
+		if Published && cur.AuthorID != UserID {
+			return ErrNotAuthor
+		}
+		// Publishing a published ad or unpublishing an unpublished one keeps the status.
+		to := cur.Status
+		switch {
+		case Published && cur.Status != ads.StatusPublished:
+			to = ads.StatusPublished
+		case !Published && cur.Status == ads.StatusPublished:
+			to = ads.StatusArchived
+		}
+		if to != cur.Status && !apm.canChangeStatus(cur.Status, to, false) {
+			return ErrStatusTransition
+		}
+		ad, err = changeStatus(ctx, tx, cur, UserID, to, cur.RejectionReason, Version)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	apm.withImageURLs(ad)
 	return ad, nil
 }
 
-func (apm *AppMethods) UpdateAd(c context.Context, ID int64, UserID int64, Title string, Text string) (*ads.Ad, error) {
-	ad, err := apm.r.UpdateTextAndTitle(ID, UserID, Title, Text)
+func (apm *AppMethods) UpdateAd(c context.Context, ID int64, UserID int64, in ads.AdInput, Version int64) (*ads.Ad, error) {
+	in.Tags = normalizeTags(in.Tags)
+	in.Currency = normalizeCurrency(in.Currency)
+	if err := apm.limits.validateAd(in); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var ad *ads.Ad
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		cur, err := tx.LockAd(ctx, ID)
+		if err != nil {
+			return err
+		}
+		authorID, err := actingAuthor(ctx, tx, cur, UserID, PermManageAds)
+		if err != nil {
+			return err
+		}
+		ad, err = updateWithRevision(ctx, tx, ID, UserID, func() (*ads.Ad, error) {
+			ad, err := tx.UpdateContent(ctx, ID, authorID, in, Version)
+			if err != nil {
+				return nil, err
+			}
+			return apm.toDraft(ctx, tx, ad)
+		})
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	apm.withImageURLs(ad)
 	return ad, nil
 }
 
-func (apm *AppMethods) GetList(c context.Context, filter ads.AdFilter) ([]*ads.Ad, error) {
-	return apm.r.GetList(filter)
+func (apm *AppMethods) GetList(c context.Context, filter ads.AdFilter) ([]*ads.Ad, int64, error) {
+	filter.Limit, filter.Offset = pageBounds(filter.Limit, filter.Offset)
+	filter.Tags = normalizeTags(filter.Tags)
+	filter.Currency = normalizeCurrency(filter.Currency)
+	if err := validateFilter(filter); err != nil {
+		return nil, 0, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.List)
+	defer cancel()
+	list, total, err := apm.r.GetList(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	apm.withImageURLs(list...)
+	return list, total, nil
 }
 
 func (apm *AppMethods) GetByID(c context.Context, ID int64) (*ads.Ad, error) {
-	return apm.r.GetByID(ID)
+	ctx, cancel := withTimeout(c, apm.timeouts.Read)
+	defer cancel()
+	ad, err := apm.r.GetByID(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	apm.withImageURLs(ad)
+	return ad, nil
 }
 
+// DeleteAd keeps the images of the ad, so that restoring the ad brings them back.
 func (apm *AppMethods) DeleteAd(c context.Context, ID int64, UserID int64) error {
-	return apm.r.DeleteAd(ID, UserID)
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	return apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		ad, err := tx.LockAd(ctx, ID)
+		if err != nil {
+			return err
+		}
+		authorID, err := actingAuthor(ctx, tx, ad, UserID, PermManageAds)
+		if err != nil {
+			return err
+		}
+		if authorID == UserID {
+			return tx.DeleteAd(ctx, ID, UserID)
+		}
+		return tx.ForceDeleteAd(ctx, ID, UserID)
+	})
+}
+
+func (apm *AppMethods) RestoreAd(c context.Context, ID int64, UserID int64) (*ads.Ad, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var ad *ads.Ad
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		ad, err = tx.LockAd(ctx, ID)
+		if err != nil {
+			return err
+		}
+		authorID, err := actingAuthor(ctx, tx, ad, UserID, PermManageAds)
+		if err != nil {
+			return err
+		}
+		if ad.DeletedBy != nil && *ad.DeletedBy != ad.AuthorID && authorID == UserID {
+			if _, err := authorize(ctx, tx, UserID, PermManageAds); err != nil {
+				return err
+			}
+		}
+		ad, err = tx.RestoreAd(ctx, ID, authorID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	apm.withImageURLs(ad)
+	return ad, nil
+}
+
+func (apm *AppMethods) CreateUser(c context.Context, AdminID int64, Name string) (*ads.User, error) {
+	Name = strings.TrimSpace(Name)
+	var v validator
+	v.required("name", Name)
+	v.maxLength("name", Name, userNameMaxLength)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	if _, err := authorize(ctx, apm.r, AdminID, PermManageUsers); err != nil {
+		return nil, err
+	}
+	return apm.r.CreateUser(ctx, Name)
 }
 
-func (apm *AppMethods) CreateUser(c context.Context, Name string) (*ads.User, error) {
-	return apm.r.CreateUser(Name)
+func (apm *AppMethods) GetUser(c context.Context, ID int64, ViewerID int64) (*ads.User, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Read)
+	defer cancel()
+	user, err := apm.r.GetUser(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	if ViewerID == ID {
+		return user, nil
+	}
+	// Anonymous viewers, and viewers who are not admins or cannot be checked, see the public profile.
+	if ViewerID < 0 {
+		return user.Public(), nil
+	}
+	if _, err := authorize(ctx, apm.r, ViewerID, PermManageUsers); err != nil {
+		return user.Public(), nil
+	}
+	return user, nil
 }
 
-func (apm *AppMethods) GetUser(c context.Context, ID int64) (*ads.User, error) {
-	return apm.r.GetUser(ID)
+func (apm *AppMethods) ListUsers(c context.Context, AdminID int64, filter ads.UserFilter) ([]*ads.User, int64, error) {
+	filter.Limit, filter.Offset = pageBounds(filter.Limit, filter.Offset)
+	filter.Query = strings.TrimSpace(filter.Query)
+	if err := validateUserFilter(filter); err != nil {
+		return nil, 0, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.List)
+	defer cancel()
+	if _, err := authorize(ctx, apm.r, AdminID, PermManageUsers); err != nil {
+		return nil, 0, err
+	}
+	return apm.r.ListUsers(ctx, filter)
 }
 
-func (apm *AppMethods) DeleteUser(c context.Context, ID int64) error {
-	return apm.r.DeleteUser(ID)
+// DeleteUser deletes the user and, in the same transaction, applies
+// the user delete policy to their ads. Deleted ads keep their images.
+func (apm *AppMethods) DeleteUser(c context.Context, ID int64, ActorID int64) error {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	return apm.r.RunInTx(ctx, func(tx Repository) error {
+		if ActorID != ID {
+			if _, err := authorize(ctx, tx, ActorID, PermManageUsers); err != nil {
+				return err
+			}
+		}
+		filter := ads.AdFilter{Auth: ID}
+		if apm.userDeletePolicy != DeleteUserCascade {
+			filter.Pub = true
+		}
+		list, _, err := tx.GetList(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, ad := range list {
+			switch apm.userDeletePolicy {
+			case DeleteUserRestrict:
+				return ErrUserHasActiveAds
+			case DeleteUserUnpublish:
+				_, err = changeStatus(ctx, tx, ad, ActorID, ads.StatusArchived, "", 0)
+			default:
+				err = tx.ForceDeleteAd(ctx, ad.ID, ActorID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.RevokeRefreshTokens(ctx, ID); err != nil {
+			return err
+		}
+		if err := tx.RevokeAPIKeys(ctx, ID); err != nil {
+			return err
+		}
+		return tx.DeleteUser(ctx, ID, ActorID)
+	})
 }
 
-func NewApp(repo Repository) App {
-	return &AppMethods{r: repo}
+func (apm *AppMethods) RestoreUser(c context.Context, ID int64, ActorID int64) (*ads.User, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	if _, err := authorize(ctx, apm.r, ActorID, PermManageUsers); err != nil {
+		return nil, err
+	}
+	return apm.r.RestoreUser(ctx, ID)
+}
+
+// pageBounds applies the default and the maximum page size.
+func pageBounds(Limit int, Offset int) (int, int) {
+	if Limit <= 0 {
+		Limit = DefaultListLimit
+	}
+	if Limit > MaxListLimit {
+		Limit = MaxListLimit
+	}
+	if Offset < 0 {
+		Offset = 0
+	}
+	return Limit, Offset
+}
+
+func NewApp(repo Repository, opts ...Option) App {
+	apm := &AppMethods{r: repo, userDeletePolicy: DeleteUserCascade, limits: DefaultLimits, auth: DefaultAuth}
+	for _, opt := range opts {
+		opt(apm)
+	}
+	if apm.auth.Secret == "" {
+		apm.auth.Secret = randomToken(32)
+	}
+	return apm
 }
@@ -0,0 +1,262 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"homework9/internal/ads"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidCredentials = errors.New("wrong email or password")
+var ErrInvalidToken = errors.New("token is invalid or expired")
+var ErrUnauthenticated = errors.New("authentication required")
+var ErrForbidden = errors.New("not allowed to act for this user")
+
+const (
+	userNameMaxLength = 100
+	// emailMaxLength is the size of users.email.
+	emailMaxLength    = 254
+	passwordMinLength = 8
+	// passwordMaxLength is the number of bytes bcrypt hashes; the rest would be ignored.
+	passwordMaxLength = 72
+)
+
+// Auth configures the tokens issued on login. Zero TTLs keep the defaults.
+// Without a secret a random one is generated, so tokens do not survive a restart.
+type Auth struct {
+	Secret     string        `env:"JWT_SECRET"`
+	AccessTTL  time.Duration `env:"JWT_ACCESS_TTL" envDefault:"15m"`
+	RefreshTTL time.Duration `env:"JWT_REFRESH_TTL" envDefault:"720h"`
+}
+
+var DefaultAuth = Auth{AccessTTL: 15 * time.Minute, RefreshTTL: 30 * 24 * time.Hour}
+
+func WithAuth(a Auth) Option {
+	return func(apm *AppMethods) {
+		if a.Secret != "" {
+			apm.auth.Secret = a.Secret
+		}
+		if a.AccessTTL > 0 {
+			apm.auth.AccessTTL = a.AccessTTL
+		}
+		if a.RefreshTTL > 0 {
+			apm.auth.RefreshTTL = a.RefreshTTL
+		}
+	}
+}
+
+// Tokens are issued on login and refresh. The access token authenticates
+// requests; the refresh token, used once, obtains a new pair.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time // of the access token
+}
+
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+)
+
+type tokenClaims struct {
+	Type string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+type userKey struct{}
+
+// ContextWithUser marks the context of a request as authenticated for the user.
+func ContextWithUser(ctx context.Context, UserID int64) context.Context {
+	return context.WithValue(ctx, userKey{}, UserID)
+}
+
+// UserFromContext returns the authenticated user of the request, if any.
+func UserFromContext(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(userKey{}).(int64)
+	return id, ok
+}
+
+// CurrentUser returns the user the request is authenticated as,
+// and ErrUnauthenticated for anonymous requests. Ports take the acting user
+// only from here, never from ids in the request.
+func CurrentUser(ctx context.Context) (int64, error) {
+	if id, ok := UserFromContext(ctx); ok {
+		return id, nil
+	}
+	return 0, ErrUnauthenticated
+}
+
+// ActingAs fails with ErrUnauthenticated for anonymous requests
+// and with ErrForbidden unless the request is authenticated as the user ID.
+func ActingAs(ctx context.Context, ID int64) error {
+	id, err := CurrentUser(ctx)
+	if err != nil {
+		return err
+	}
+	if id != ID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func normalizeEmail(Email string) string {
+	return strings.ToLower(strings.TrimSpace(Email))
+}
+
+func validateRegistration(Name string, Email string, Password string) error {
+	var v validator
+	v.required("name", Name)
+	v.maxLength("name", Name, userNameMaxLength)
+	v.required("email", Email)
+	v.maxLength("email", Email, emailMaxLength)
+	v.email("email", Email)
+	if len(Password) < passwordMinLength {
+		v.violations = append(v.violations, Violation{Field: "password", Rule: RuleMinLength, Limit: passwordMinLength})
+	}
+	if len(Password) > passwordMaxLength {
+		v.violations = append(v.violations, Violation{Field: "password", Rule: RuleMaxLength, Limit: passwordMaxLength})
+	}
+	return v.err()
+}
+
+func (apm *AppMethods) Register(c context.Context, Name string, Email string, Password string) (*ads.User, error) {
+	Name = strings.TrimSpace(Name)
+	Email = normalizeEmail(Email)
+	if err := validateRegistration(Name, Email, Password); err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	return apm.r.CreateAccount(ctx, Name, Email, hash)
+}
+
+func (apm *AppMethods) Login(c context.Context, Email string, Password string) (*Tokens, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	UserID, hash, err := apm.r.GetCredentials(ctx, normalizeEmail(Email))
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil || bcrypt.CompareHashAndPassword(hash, []byte(Password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return apm.issueTokens(ctx, apm.r, UserID)
+}
+
+// RefreshTokens rotates the refresh token: the old one is revoked
+// in the same transaction that stores the new one.
+func (apm *AppMethods) RefreshTokens(c context.Context, RefreshToken string) (*Tokens, error) {
+	claims, err := apm.parseToken(RefreshToken, refreshTokenType)
+	if err != nil {
+		return nil, err
+	}
+	UserID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var tokens *Tokens
+	err = apm.r.RunInTx(ctx, func(tx Repository) error {
+		active, err := tx.RevokeRefreshToken(ctx, claims.ID)
+		if err != nil {
+			return err
+		}
+		if !active {
+			return ErrInvalidToken
+		}
+		if _, err := tx.GetUser(ctx, UserID); err != nil {
+			return ErrInvalidToken
+		}
+		tokens, err = apm.issueTokens(ctx, tx, UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Logout revokes the refresh token. Access tokens issued with it stay valid until they expire.
+func (apm *AppMethods) Logout(c context.Context, RefreshToken string) error {
+	claims, err := apm.parseToken(RefreshToken, refreshTokenType)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	_, err = apm.r.RevokeRefreshToken(ctx, claims.ID)
+	return err
+}
+
+func (apm *AppMethods) Authenticate(c context.Context, AccessToken string) (int64, error) {
+	claims, err := apm.parseToken(AccessToken, accessTokenType)
+	if err != nil {
+		return 0, err
+	}
+	UserID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Read)
+	defer cancel()
+	if _, err := apm.r.GetUser(ctx, UserID); err != nil {
+		return 0, ErrInvalidToken
+	}
+	return UserID, nil
+}
+
+func (apm *AppMethods) issueTokens(ctx context.Context, r Repository, UserID int64) (*Tokens, error) {
+	now := time.Now()
+	jti := randomToken(16)
+	refreshExp := now.Add(apm.auth.RefreshTTL)
+	if err := r.AddRefreshToken(ctx, jti, UserID, refreshExp); err != nil {
+		return nil, err
+	}
+	subject := strconv.FormatInt(UserID, 10)
+	accessExp := now.Add(apm.auth.AccessTTL)
+	access, err := apm.signToken(tokenClaims{Type: accessTokenType, RegisteredClaims: jwt.RegisteredClaims{
+		Subject: subject, IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(accessExp)}})
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := apm.signToken(tokenClaims{Type: refreshTokenType, RegisteredClaims: jwt.RegisteredClaims{
+		ID: jti, Subject: subject, IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(refreshExp)}})
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{AccessToken: access, RefreshToken: refresh, ExpiresAt: accessExp}, nil
+}
+
+func (apm *AppMethods) signToken(claims tokenClaims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(apm.auth.Secret))
+}
+
+func (apm *AppMethods) parseToken(token string, typ string) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return []byte(apm.auth.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Type != typ {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// randomToken returns n random bytes in hex.
+func randomToken(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"homework9/internal/ads"
+	"strings"
+)
+
+var ErrCategoryCycle = errors.New("category cannot be moved into itself or its subcategory")
+
+func (apm *AppMethods) CreateCategory(c context.Context, Name string, ParentID *int64, UserID int64) (*ads.Category, error) {
+	Name = strings.TrimSpace(Name)
+	if err := validateCategory(Name); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	if _, err := authorize(ctx, apm.r, UserID, PermManageCategories); err != nil {
+		return nil, err
+	}
+	return apm.r.CreateCategory(ctx, Name, ParentID)
+}
+
+func (apm *AppMethods) GetCategory(c context.Context, ID int64) (*ads.Category, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Read)
+	defer cancel()
+	return apm.r.GetCategory(ctx, ID)
+}
+
+func (apm *AppMethods) ListCategories(c context.Context) ([]*ads.Category, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.List)
+	defer cancel()
+	return apm.r.ListCategories(ctx)
+}
+
+func (apm *AppMethods) UpdateCategory(c context.Context, ID int64, UserID int64, Name string, ParentID *int64) (*ads.Category, error) {
+	Name = strings.TrimSpace(Name)
+	if err := validateCategory(Name); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var cat *ads.Category
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		if _, err = authorize(ctx, tx, UserID, PermManageCategories); err != nil {
+			return err
+		}
+		// Walk up from the new parent: meeting the category on the way
+		// means the move would cut its subtree off the tree.
+		for parent := ParentID; parent != nil; {
+			if *parent == ID {
+				return ErrCategoryCycle
+			}
+			p, err := tx.GetCategory(ctx, *parent)
+			if err != nil {
+				return err
+			}
+			parent = p.ParentID
+		}
+		cat, err = tx.UpdateCategory(ctx, ID, Name, ParentID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cat, nil
+}
+
+func (apm *AppMethods) DeleteCategory(c context.Context, ID int64, UserID int64) error {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	if _, err := authorize(ctx, apm.r, UserID, PermManageCategories); err != nil {
+		return err
+	}
+	return apm.r.DeleteCategory(ctx, ID)
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"context"
+	"homework9/internal/ads"
+)
+
+func (apm *AppMethods) AddFavorite(c context.Context, UserID int64, AdID int64) (*ads.Ad, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var ad *ads.Ad
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		if _, err = tx.GetUser(ctx, UserID); err != nil {
+			return err
+		}
+		cur, err := tx.GetByID(ctx, AdID)
+		if err != nil {
+			return err
+		}
+		if !cur.Published {
+			return ErrAdNotPublished
+		}
+		if err = tx.AddFavorite(ctx, UserID, AdID); err != nil {
+			return err
+		}
+		ad, err = tx.GetByID(ctx, AdID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	apm.withImageURLs(ad)
+	return ad, nil
+}
+
+func (apm *AppMethods) RemoveFavorite(c context.Context, UserID int64, AdID int64) error {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	return apm.r.RemoveFavorite(ctx, UserID, AdID)
+}
+
+func (apm *AppMethods) ListFavorites(c context.Context, UserID int64, Limit int, Offset int) ([]*ads.Ad, int64, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Read)
+	defer cancel()
+	if _, err := apm.r.GetUser(ctx, UserID); err != nil {
+		return nil, 0, err
+	}
+	// Ads unpublished since they were added stay in the favorites but are not shown.
+	return apm.GetList(c, ads.AdFilter{Pub: true, Auth: -1, FavoritesOf: &UserID, Limit: Limit, Offset: Offset})
+}
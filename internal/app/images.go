@@ -0,0 +1,211 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"homework9/internal/ads"
+	"io"
+	"net/http"
+	"slices"
+)
+
+var (
+	ErrImageTooLarge = errors.New("image is too large")
+	ErrImageType     = errors.New("unsupported image type")
+	ErrTooManyImages = errors.New("ad has too many images")
+	ErrImageOrder    = errors.New("image order should list every image of the ad once")
+	ErrNoBlobStore   = errors.New("image storage is not configured")
+)
+
+// imageTypes maps the accepted content types to file extensions.
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// BlobStore keeps the files of images. Keys are slash-separated relative paths.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open fails with an error wrapping fs.ErrNotExist if there is no blob with the key.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete succeeds if there is no blob with the key.
+	Delete(ctx context.Context, key string) error
+	// URL returns the address clients download the blob from.
+	URL(key string) string
+}
+
+func WithBlobStore(b BlobStore) Option {
+	return func(apm *AppMethods) {
+		apm.blobs = b
+	}
+}
+
+// AddImage checks the content type by the data itself, so the name of
+// the uploaded file and the type declared by the client do not matter.
+// The blob is written before the transaction adding the image row and
+// removed if the row cannot be added.
+func (apm *AppMethods) AddImage(c context.Context, ID int64, UserID int64, r io.Reader) (*ads.Image, error) {
+	if apm.blobs == nil {
+		return nil, ErrNoBlobStore
+	}
+	data, err := io.ReadAll(io.LimitReader(r, apm.limits.MaxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image: %w", err)
+	}
+	if int64(len(data)) > apm.limits.MaxImageSize {
+		return nil, ErrImageTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := imageTypes[contentType]
+	if !ok {
+		return nil, ErrImageType
+	}
+	key, err := newImageKey(ID, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	if err := apm.blobs.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("unable to store image: %w", err)
+	}
+	var img *ads.Image
+	err = apm.r.RunInTx(ctx, func(tx Repository) error {
+		images, _, err := lockImages(ctx, tx, ID, UserID)
+		if err != nil {
+			return err
+		}
+		if len(images) >= apm.limits.MaxImages {
+			return ErrTooManyImages
+		}
+		img, err = tx.AddImage(ctx, &ads.Image{AdID: ID, Key: key, ContentType: contentType, Size: int64(len(data))})
+		return err
+	})
+	if err != nil {
+		apm.deleteBlobs(ctx, []*ads.Image{{Key: key}})
+		return nil, err
+	}
+	apm.setImageURLs(img)
+	return img, nil
+}
+
+func (apm *AppMethods) DeleteImage(c context.Context, ID int64, ImageID int64, UserID int64) error {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var img *ads.Image
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		if _, _, err := lockImages(ctx, tx, ID, UserID); err != nil {
+			return err
+		}
+		img, err = tx.DeleteImage(ctx, ID, ImageID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	apm.deleteBlobs(ctx, []*ads.Image{img})
+	return nil
+}
+
+func (apm *AppMethods) ReorderImages(c context.Context, ID int64, UserID int64, ImageIDs []int64) ([]*ads.Image, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var images []*ads.Image
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		var authorID int64
+		images, authorID, err = lockImages(ctx, tx, ID, UserID)
+		if err != nil {
+			return err
+		}
+		current := make([]int64, 0, len(images))
+		for _, img := range images {
+			current = append(current, img.ID)
+		}
+		wanted := slices.Clone(ImageIDs)
+		slices.Sort(current)
+		slices.Sort(wanted)
+		if !slices.Equal(current, wanted) {
+			return ErrImageOrder
+		}
+		if err := tx.ReorderImages(ctx, ID, ImageIDs); err != nil {
+			return err
+		}
+		images, err = tx.ListImages(ctx, ID, authorID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	apm.setImageURLs(images...)
+	return images, nil
+}
+
+// lockImages locks the ad and returns its images together with the
+// author to list them as, if UserID is the author or may manage ads of other users.
+func lockImages(ctx context.Context, tx Repository, ID int64, UserID int64) ([]*ads.Image, int64, error) {
+	ad, err := tx.LockAd(ctx, ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	authorID, err := actingAuthor(ctx, tx, ad, UserID, PermManageAds)
+	if err != nil {
+		return nil, 0, err
+	}
+	images, err := tx.ListImages(ctx, ID, authorID)
+	return images, authorID, err
+}
+
+func (apm *AppMethods) OpenImage(c context.Context, Key string) (io.ReadCloser, error) {
+	if apm.blobs == nil {
+		return nil, ErrNoBlobStore
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Read)
+	defer cancel()
+	return apm.blobs.Open(ctx, Key)
+}
+
+// deleteBlobs removes the files of deleted images. It is called after the
+// transaction commits, so a failure only leaves an orphaned file behind
+// and is not reported to the client.
+func (apm *AppMethods) deleteBlobs(ctx context.Context, images []*ads.Image) {
+	if apm.blobs == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, img := range images {
+		_ = apm.blobs.Delete(ctx, img.Key)
+	}
+}
+
+func (apm *AppMethods) setImageURLs(images ...*ads.Image) {
+	if apm.blobs == nil {
+		return
+	}
+	for _, img := range images {
+		img.URL = apm.blobs.URL(img.Key)
+	}
+}
+
+func (apm *AppMethods) withImageURLs(list ...*ads.Ad) {
+	for _, ad := range list {
+		for i := range ad.Images {
+			apm.setImageURLs(&ad.Images[i])
+		}
+	}
+}
+
+// newImageKey returns an unguessable key, so uploads never overwrite each other.
+func newImageKey(AdID int64, ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate image key: %w", err)
+	}
+	return fmt.Sprintf("ads/%d/%s%s", AdID, hex.EncodeToString(b), ext), nil
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"homework9/internal/ads"
+	"strings"
+)
+
+var ErrNotParticipant = errors.New("user does not take part in the thread")
+var ErrOwnAd = errors.New("cannot write about own ad")
+var ErrAdNotPublished = errors.New("ad is not published")
+
+// messageTextMaxLength is the size of messages.text.
+const messageTextMaxLength = 2000
+
+func validateMessage(Text string) error {
+	var v validator
+	v.required("text", Text)
+	v.maxLength("text", Text, messageTextMaxLength)
+	return v.err()
+}
+
+func (apm *AppMethods) SendAdMessage(c context.Context, AdID int64, SenderID int64, Text string) (*ads.Message, error) {
+	Text = strings.TrimSpace(Text)
+	if err := validateMessage(Text); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var msg *ads.Message
+	err := apm.r.RunInTx(ctx, func(tx Repository) error {
+		if _, err := tx.GetUser(ctx, SenderID); err != nil {
+			return err
+		}
+		ad, err := tx.GetByID(ctx, AdID)
+		if err != nil {
+			return err
+		}
+		if ad.AuthorID == SenderID {
+			return ErrOwnAd
+		}
+		if !ad.Published {
+			return ErrAdNotPublished
+		}
+		thread, err := tx.GetOrCreateThread(ctx, AdID, SenderID, ad.AuthorID)
+		if err != nil {
+			return err
+		}
+		msg, err = tx.AddMessage(ctx, &ads.Message{ThreadID: thread.ID, SenderID: SenderID, Text: Text})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (apm *AppMethods) SendMessage(c context.Context, ThreadID int64, SenderID int64, Text string) (*ads.Message, error) {
+	Text = strings.TrimSpace(Text)
+	if err := validateMessage(Text); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var msg *ads.Message
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		if _, err = tx.GetUser(ctx, SenderID); err != nil {
+			return err
+		}
+		if _, err = participantThread(ctx, tx, ThreadID, SenderID); err != nil {
+			return err
+		}
+		msg, err = tx.AddMessage(ctx, &ads.Message{ThreadID: ThreadID, SenderID: SenderID, Text: Text})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// participantThread returns the thread if UserID is its buyer or seller.
+func participantThread(ctx context.Context, r Repository, ThreadID int64, UserID int64) (*ads.Thread, error) {
+	thread, err := r.GetThread(ctx, ThreadID, UserID)
+	if err != nil {
+		return nil, err
+	}
+	if thread.BuyerID != UserID && thread.SellerID != UserID {
+		return nil, ErrNotParticipant
+	}
+	return thread, nil
+}
+
+func (apm *AppMethods) ListThreads(c context.Context, UserID int64, Limit int, Offset int) ([]*ads.Thread, int64, error) {
+	Limit, Offset = pageBounds(Limit, Offset)
+	ctx, cancel := withTimeout(c, apm.timeouts.List)
+	defer cancel()
+	return apm.r.ListThreads(ctx, UserID, Limit, Offset)
+}
+
+func (apm *AppMethods) ListMessages(c context.Context, ThreadID int64, UserID int64, Limit int, Offset int) ([]*ads.Message, int64, error) {
+	Limit, Offset = pageBounds(Limit, Offset)
+	ctx, cancel := withTimeout(c, apm.timeouts.List)
+	defer cancel()
+	if _, err := participantThread(ctx, apm.r, ThreadID, UserID); err != nil {
+		return nil, 0, err
+	}
+	return apm.r.ListMessages(ctx, ThreadID, Limit, Offset)
+}
+
+func (apm *AppMethods) MarkThreadRead(c context.Context, ThreadID int64, UserID int64) (*ads.Thread, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var thread *ads.Thread
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		if _, err = participantThread(ctx, tx, ThreadID, UserID); err != nil {
+			return err
+		}
+		if err = tx.MarkRead(ctx, ThreadID, UserID); err != nil {
+			return err
+		}
+		thread, err = tx.GetThread(ctx, ThreadID, UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return thread, nil
+}
+
+func (apm *AppMethods) UnreadCount(c context.Context, UserID int64) (int64, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Read)
+	defer cancel()
+	return apm.r.CountUnread(ctx, UserID)
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"homework9/internal/ads"
+	"slices"
+)
+
+var ErrStatusTransition = errors.New("ad status does not allow this change")
+
+// rejectionReasonMaxLength is the size of adds.rejection_reason.
+const rejectionReasonMaxLength = 500
+
+// authorTransitions and moderatorTransitions list the statuses an author
+// and a moderator may move an ad to from each status.
+var authorTransitions = map[ads.AdStatus][]ads.AdStatus{
+	ads.StatusDraft:     {ads.StatusPendingReview},
+	ads.StatusRejected:  {ads.StatusPendingReview},
+	ads.StatusApproved:  {ads.StatusPublished},
+	ads.StatusPublished: {ads.StatusArchived},
+	ads.StatusArchived:  {ads.StatusPublished},
+}
+
+var moderatorTransitions = map[ads.AdStatus][]ads.AdStatus{
+	ads.StatusPendingReview: {ads.StatusApproved, ads.StatusRejected},
+}
+
+// WithModeration makes new and edited ads pass a review before they can be published.
+// Without it the author may also publish a draft, but still not an ad that
+// is under review or has been rejected.
+func WithModeration(required bool) Option {
+	return func(apm *AppMethods) {
+		apm.moderation = required
+	}
+}
+
+func (apm *AppMethods) canChangeStatus(from ads.AdStatus, to ads.AdStatus, moderator bool) bool {
+	if moderator {
+		return slices.Contains(moderatorTransitions[from], to)
+	}
+	if !apm.moderation && from == ads.StatusDraft && to == ads.StatusPublished {
+		return true
+	}
+	return slices.Contains(authorTransitions[from], to)
+}
+
+// publishableStatuses are the statuses of ads the scheduler may publish.
+func (apm *AppMethods) publishableStatuses() []ads.AdStatus {
+	var res []ads.AdStatus
+	for _, s := range []ads.AdStatus{ads.StatusDraft, ads.StatusPendingReview, ads.StatusApproved, ads.StatusRejected, ads.StatusArchived} {
+		if apm.canChangeStatus(s, ads.StatusPublished, false) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// changeStatus moves the ad, read inside tx, to the status To on behalf of ActorID.
+func changeStatus(ctx context.Context, tx Repository, ad *ads.Ad, ActorID int64, To ads.AdStatus, Reason string, Version int64) (*ads.Ad, error) {
+	return updateWithRevision(ctx, tx, ad.ID, ActorID, func() (*ads.Ad, error) {
+		return tx.UpdateStatus(ctx, ad.ID, ad.Status, To, Reason, Version)
+	})
+}
+
+// toDraft returns an edited ad to drafts when moderation is required,
+// so that the new content is reviewed before it is published again.
+func (apm *AppMethods) toDraft(ctx context.Context, tx Repository, ad *ads.Ad) (*ads.Ad, error) {
+	if !apm.moderation || ad.Status == ads.StatusDraft {
+		return ad, nil
+	}
+	return tx.UpdateStatus(ctx, ad.ID, ad.Status, ads.StatusDraft, "", 0)
+}
+
+func (apm *AppMethods) SubmitAd(c context.Context, ID int64, UserID int64, Version int64) (*ads.Ad, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var ad *ads.Ad
+	err := apm.r.RunInTx(ctx, func(tx Repository) error {
+		cur, err := tx.GetByID(ctx, ID)
+		if err != nil {
+			return err
+		}
+		if cur.AuthorID != UserID {
+			return ErrNotAuthor
+		}
+		if !apm.canChangeStatus(cur.Status, ads.StatusPendingReview, false) {
+			return ErrStatusTransition
+		}
+		ad, err = changeStatus(ctx, tx, cur, UserID, ads.StatusPendingReview, "", Version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	apm.withImageURLs(ad)
+	return ad, nil
+}
+
+func (apm *AppMethods) ApproveAd(c context.Context, ID int64, ModeratorID int64, Version int64) (*ads.Ad, error) {
+	return apm.moderate(c, ID, ModeratorID, ads.StatusApproved, "", Version)
+}
+
+func (apm *AppMethods) RejectAd(c context.Context, ID int64, ModeratorID int64, Reason string, Version int64) (*ads.Ad, error) {
+	var v validator
+	v.required("reason", Reason)
+	v.maxLength("reason", Reason, rejectionReasonMaxLength)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return apm.moderate(c, ID, ModeratorID, ads.StatusRejected, Reason, Version)
+}
+
+func (apm *AppMethods) moderate(c context.Context, ID int64, ModeratorID int64, To ads.AdStatus, Reason string, Version int64) (*ads.Ad, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var ad *ads.Ad
+	err := apm.r.RunInTx(ctx, func(tx Repository) error {
+		if _, err := authorize(ctx, tx, ModeratorID, PermModerate); err != nil {
+			return err
+		}
+		cur, err := tx.GetByID(ctx, ID)
+		if err != nil {
+			return err
+		}
+		if !apm.canChangeStatus(cur.Status, To, true) {
+			return ErrStatusTransition
+		}
+		ad, err = changeStatus(ctx, tx, cur, ModeratorID, To, Reason, Version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	apm.withImageURLs(ad)
+	return ad, nil
+}
+
+func (apm *AppMethods) ModerationQueue(c context.Context, ModeratorID int64, Limit int, Offset int) ([]*ads.Ad, int64, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Read)
+	defer cancel()
+	if _, err := authorize(ctx, apm.r, ModeratorID, PermModerate); err != nil {
+		return nil, 0, err
+	}
+	// Ads are listed by id, so the ones created earlier come first.
+	return apm.GetList(c, ads.AdFilter{Auth: -1, Status: ads.StatusPendingReview, Limit: Limit, Offset: Offset})
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type Option func(*AppMethods)
+
+// UserDeletePolicy decides what happens to the ads of a deleted user.
+type UserDeletePolicy string
+
+const (
+	// DeleteUserCascade deletes all ads of the user.
+	DeleteUserCascade UserDeletePolicy = "cascade"
+	// DeleteUserUnpublish keeps the ads but takes them off publication.
+	DeleteUserUnpublish UserDeletePolicy = "unpublish"
+	// DeleteUserRestrict refuses to delete a user who has published ads.
+	DeleteUserRestrict UserDeletePolicy = "restrict"
+)
+
+func ParseUserDeletePolicy(s string) (UserDeletePolicy, error) {
+	switch p := UserDeletePolicy(s); p {
+	case DeleteUserCascade, DeleteUserUnpublish, DeleteUserRestrict:
+		return p, nil
+	case "":
+		return DeleteUserCascade, nil
+	default:
+		return "", fmt.Errorf("unknown user delete policy %q", s)
+	}
+}
+
+func WithUserDeletePolicy(p UserDeletePolicy) Option {
+	return func(apm *AppMethods) {
+		apm.userDeletePolicy = p
+	}
+}
+
+// Timeouts limit how long a single App call may spend in the repository.
+// A zero timeout means that only the caller's deadline applies.
+type Timeouts struct {
+	Read  time.Duration `env:"QUERY_TIMEOUT_READ" envDefault:"2s"`  // lookups by id
+	List  time.Duration `env:"QUERY_TIMEOUT_LIST" envDefault:"5s"`  // listing and search
+	Write time.Duration `env:"QUERY_TIMEOUT_WRITE" envDefault:"3s"` // changes, including transactions
+}
+
+func WithTimeouts(t Timeouts) Option {
+	return func(apm *AppMethods) {
+		apm.timeouts = t
+	}
+}
+
+func withTimeout(c context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(c)
+	}
+	return context.WithTimeout(c, d)
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"homework9/internal/ads"
+	"slices"
+)
+
+var ErrNoPermission = errors.New("user role does not allow this action")
+
+// Permission is an action beyond managing one's own ads and account.
+type Permission string
+
+const (
+	// PermModerate is reviewing ads and resolving reports.
+	PermModerate Permission = "moderate"
+	// PermManageAds is editing, unpublishing and deleting ads of other users.
+	PermManageAds        Permission = "manage_ads"
+	PermManageUsers      Permission = "manage_users"
+	PermManageCategories Permission = "manage_categories"
+)
+
+var rolePermissions = map[ads.Role][]Permission{
+	ads.RoleModerator: {PermModerate},
+	ads.RoleAdmin:     {PermModerate, PermManageAds, PermManageUsers, PermManageCategories},
+}
+
+// authorize returns the user if the user, not deleted, has the permission,
+// and fails with ErrNoPermission otherwise.
+func authorize(ctx context.Context, r Repository, UserID int64, perm Permission) (*ads.User, error) {
+	user, err := r.GetUser(ctx, UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Deleted || !slices.Contains(rolePermissions[user.Role], perm) {
+		return nil, ErrNoPermission
+	}
+	return user, nil
+}
+
+// actingAuthor returns the user the repository should check as the author when
+// UserID changes the ad: UserID itself or, if UserID is not the author but has
+// the permission, the author of the ad. Other users get ErrNotAuthor.
+func actingAuthor(ctx context.Context, r Repository, ad *ads.Ad, UserID int64, perm Permission) (int64, error) {
+	if ad.AuthorID == UserID {
+		return UserID, nil
+	}
+	if _, err := authorize(ctx, r, UserID, perm); err != nil {
+		if errors.Is(err, ErrNoPermission) {
+			return 0, ErrNotAuthor
+		}
+		return 0, err
+	}
+	return ad.AuthorID, nil
+}
+
+func validateRole(Role ads.Role) error {
+	switch Role {
+	case ads.RoleUser, ads.RoleModerator, ads.RoleAdmin:
+		return nil
+	}
+	return &ValidationError{Violations: []Violation{{Field: "role", Rule: RuleOneOf}}}
+}
+
+// SetUserRole fails with ErrNoPermission when an admin changes their own role,
+// so that the service is not left without admins by mistake.
+func (apm *AppMethods) SetUserRole(c context.Context, ID int64, ActorID int64, Role ads.Role) (*ads.User, error) {
+	if err := validateRole(Role); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var user *ads.User
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		if _, err = authorize(ctx, tx, ActorID, PermManageUsers); err != nil {
+			return err
+		}
+		if ID == ActorID {
+			return ErrNoPermission
+		}
+		user, err = tx.SetUserRole(ctx, ID, Role)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"homework9/internal/ads"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// The limits are the sizes of the users columns.
+	displayNameMaxLength = 100
+	avatarURLMaxLength   = 500
+	aboutMaxLength       = 1000
+)
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// normalizePhone drops the separators people usually type, so that
+// "+7 (999) 123-45-67" is stored as "+79991234567".
+func normalizePhone(Phone string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')':
+			return -1
+		}
+		return r
+	}, Phone)
+}
+
+// applyUserUpdate returns a copy of the user with the fields of the update
+// that are set, normalized the way they are stored.
+func applyUserUpdate(user *ads.User, in ads.UserUpdate) *ads.User {
+	upd := *user
+	if in.Name != nil {
+		upd.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Email != nil {
+		upd.Email = normalizeEmail(*in.Email)
+	}
+	if in.Phone != nil {
+		upd.Phone = normalizePhone(*in.Phone)
+	}
+	if in.DisplayName != nil {
+		upd.DisplayName = strings.TrimSpace(*in.DisplayName)
+	}
+	if in.AvatarURL != nil {
+		upd.AvatarURL = strings.TrimSpace(*in.AvatarURL)
+	}
+	if in.About != nil {
+		upd.About = strings.TrimSpace(*in.About)
+	}
+	return &upd
+}
+
+// validateProfile checks the profile of a user. Users who log in by email
+// cannot remove it.
+func validateProfile(user *ads.User, emailRequired bool) error {
+	var v validator
+	v.required("name", user.Name)
+	v.maxLength("name", user.Name, userNameMaxLength)
+	if emailRequired {
+		v.required("email", user.Email)
+	}
+	v.maxLength("email", user.Email, emailMaxLength)
+	v.email("email", user.Email)
+	if user.Phone != "" && !e164.MatchString(user.Phone) {
+		v.violations = append(v.violations, Violation{Field: "phone", Rule: RulePhone})
+	}
+	v.maxLength("display_name", user.DisplayName, displayNameMaxLength)
+	v.maxLength("avatar_url", user.AvatarURL, avatarURLMaxLength)
+	if u, err := url.Parse(user.AvatarURL); user.AvatarURL != "" &&
+		(err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		v.violations = append(v.violations, Violation{Field: "avatar_url", Rule: RuleURL})
+	}
+	v.maxLength("about", user.About, aboutMaxLength)
+	return v.err()
+}
+
+// UpdateUser changes the profile of the user on behalf of the user itself or an admin.
+func (apm *AppMethods) UpdateUser(c context.Context, ID int64, ActorID int64, in ads.UserUpdate) (*ads.User, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var user *ads.User
+	err := apm.r.RunInTx(ctx, func(tx Repository) (err error) {
+		if ActorID != ID {
+			if _, err = authorize(ctx, tx, ActorID, PermManageUsers); err != nil {
+				return err
+			}
+		}
+		cur, err := tx.GetUser(ctx, ID)
+		if err != nil {
+			return err
+		}
+		upd := applyUserUpdate(cur, in)
+		if err = validateProfile(upd, cur.Email != ""); err != nil {
+			return err
+		}
+		user, err = tx.UpdateUser(ctx, upd)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
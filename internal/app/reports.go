@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"homework9/internal/ads"
+	"strings"
+)
+
+var ErrNoOpenReports = errors.New("ad has no open reports")
+
+// reportCommentMaxLength is the size of reports.comment.
+const reportCommentMaxLength = 1000
+
+// reportNotices are the texts of the notifications sent to reporters.
+var reportNotices = map[ads.ReportResolution]string{
+	ads.ResolutionDismissed:   "No violations were found in the ad %d you reported.",
+	ads.ResolutionUnpublished: "The ad %d you reported has been unpublished.",
+	ads.ResolutionDeleted:     "The ad %d you reported has been deleted.",
+}
+
+// rejectedNotice replaces the "unpublished" notice when the ad was not published.
+const rejectedNotice = "The ad %d you reported cannot be published until it is reviewed again."
+
+// reportRejectionReason is the rejection reason of an ad unpublished after reports.
+// The author has to submit the ad for review again to publish it.
+const reportRejectionReason = "Unpublished by a moderator after reports"
+
+func validateReport(Reason ads.ReportReason, Comment string) error {
+	var v validator
+	switch Reason {
+	case ads.ReasonScam, ads.ReasonIllegal, ads.ReasonSpam, ads.ReasonOffensive, ads.ReasonOther:
+	default:
+		v.violations = append(v.violations, Violation{Field: "reason", Rule: RuleOneOf})
+	}
+	v.maxLength("comment", Comment, reportCommentMaxLength)
+	return v.err()
+}
+
+func (apm *AppMethods) ReportAd(c context.Context, AdID int64, ReporterID int64, Reason ads.ReportReason, Comment string) (*ads.Report, error) {
+	Comment = strings.TrimSpace(Comment)
+	if err := validateReport(Reason, Comment); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var rep *ads.Report
+	err := apm.r.RunInTx(ctx, func(tx Repository) error {
+		if _, err := tx.GetUser(ctx, ReporterID); err != nil {
+			return err
+		}
+		ad, err := tx.GetByID(ctx, AdID)
+		if err != nil {
+			return err
+		}
+		if ad.AuthorID == ReporterID {
+			return ErrOwnAd
+		}
+		rep, err = tx.AddReport(ctx, &ads.Report{AdID: AdID, ReporterID: ReporterID, Reason: Reason, Comment: Comment})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+func (apm *AppMethods) ListReports(c context.Context, ModeratorID int64, Limit int, Offset int) ([]*ads.ReportGroup, int64, error) {
+	Limit, Offset = pageBounds(Limit, Offset)
+	ctx, cancel := withTimeout(c, apm.timeouts.List)
+	defer cancel()
+	if _, err := authorize(ctx, apm.r, ModeratorID, PermModerate); err != nil {
+		return nil, 0, err
+	}
+	return apm.r.ListReportGroups(ctx, Limit, Offset)
+}
+
+// ResolveReports applies the resolution to the ad, if it is still there, in the
+// same transaction that closes the reports.
+func (apm *AppMethods) ResolveReports(c context.Context, AdID int64, ModeratorID int64, Resolution ads.ReportResolution) ([]*ads.Report, error) {
+	notice, ok := reportNotices[Resolution]
+	if !ok {
+		return nil, &ValidationError{Violations: []Violation{{Field: "resolution", Rule: RuleOneOf}}}
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var reports []*ads.Report
+	err := apm.r.RunInTx(ctx, func(tx Repository) error {
+		if _, err := authorize(ctx, tx, ModeratorID, PermModerate); err != nil {
+			return err
+		}
+		ad, err := tx.LockAd(ctx, AdID)
+		if err != nil {
+			return err
+		}
+		reports, err = tx.ResolveReports(ctx, AdID, ModeratorID, Resolution)
+		if err != nil {
+			return err
+		}
+		if len(reports) == 0 {
+			return ErrNoOpenReports
+		}
+		switch {
+		case ad.Deleted:
+			if Resolution != ads.ResolutionDismissed {
+				notice = reportNotices[ads.ResolutionDeleted]
+			}
+		case Resolution == ads.ResolutionUnpublished:
+			if !ad.Published {
+				notice = rejectedNotice
+			}
+			if ad.Status != ads.StatusRejected {
+				_, err = changeStatus(ctx, tx, ad, ModeratorID, ads.StatusRejected, reportRejectionReason, 0)
+			}
+		case Resolution == ads.ResolutionDeleted:
+			err = tx.ForceDeleteAd(ctx, AdID, ModeratorID)
+		}
+		if err != nil {
+			return err
+		}
+		for _, rep := range reports {
+			n := &ads.Notification{UserID: rep.ReporterID, Text: fmt.Sprintf(notice, AdID)}
+			if _, err = tx.AddNotification(ctx, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (apm *AppMethods) ListNotifications(c context.Context, UserID int64, Limit int, Offset int) ([]*ads.Notification, int64, error) {
+	Limit, Offset = pageBounds(Limit, Offset)
+	ctx, cancel := withTimeout(c, apm.timeouts.List)
+	defer cancel()
+	if _, err := apm.r.GetUser(ctx, UserID); err != nil {
+		return nil, 0, err
+	}
+	return apm.r.ListNotifications(ctx, UserID, Limit, Offset)
+}
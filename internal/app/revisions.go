@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"homework9/internal/ads"
+)
+
+// updateWithRevision runs update on a locked ad inside tx and records
+// the change made by UserID as a revision.
+func updateWithRevision(ctx context.Context, tx Repository, ID int64, UserID int64, update func() (*ads.Ad, error)) (*ads.Ad, error) {
+	old, err := tx.LockAd(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := update()
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.AddRevision(ctx, &ads.Revision{
+		AdID:         ID,
+		ActorID:      UserID,
+		OldTitle:     old.Title,
+		NewTitle:     ad.Title,
+		OldText:      old.Text,
+		NewText:      ad.Text,
+		OldPublished: old.Published,
+		NewPublished: ad.Published,
+		OldStatus:    old.Status,
+		NewStatus:    ad.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ad, nil
+}
+
+func (apm *AppMethods) ListRevisions(c context.Context, ID int64, UserID int64) ([]*ads.Revision, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Read)
+	defer cancel()
+	ad, err := apm.r.GetByID(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	authorID, err := actingAuthor(ctx, apm.r, ad, UserID, PermManageAds)
+	if err != nil {
+		return nil, err
+	}
+	return apm.r.ListRevisions(ctx, ID, authorID)
+}
+
+func (apm *AppMethods) RollbackAd(c context.Context, ID int64, RevisionID int64, UserID int64, Version int64) (*ads.Ad, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	var ad *ads.Ad
+	err := apm.r.RunInTx(ctx, func(tx Repository) error {
+		rev, err := tx.GetRevision(ctx, ID, RevisionID)
+		if err != nil {
+			return err
+		}
+		cur, err := tx.LockAd(ctx, ID)
+		if err != nil {
+			return err
+		}
+		authorID, err := actingAuthor(ctx, tx, cur, UserID, PermManageAds)
+		if err != nil {
+			return err
+		}
+		// Revisions do not track the category, tags and price, they are kept as they are.
+		in := ads.AdInput{
+			Title:      rev.OldTitle,
+			Text:       rev.OldText,
+			CategoryID: cur.CategoryID,
+			Tags:       cur.Tags,
+			Price:      cur.Price,
+			Currency:   cur.Currency,
+		}
+		// The limits may have changed since the revision was made.
+		if err := apm.limits.validateAd(in); err != nil {
+			return err
+		}
+		ad, err = updateWithRevision(ctx, tx, ID, UserID, func() (*ads.Ad, error) {
+			ad, err := tx.UpdateContent(ctx, ID, authorID, in, Version)
+			if err != nil {
+				return nil, err
+			}
+			if apm.moderation {
+				return apm.toDraft(ctx, tx, ad)
+			}
+			// Without moderation the publication state is rolled back too,
+			// except that only the author publishes the ad, and only from
+			// a status the author may publish it from.
+			to := ad.Status
+			switch {
+			case rev.OldPublished && authorID == UserID && apm.canChangeStatus(ad.Status, ads.StatusPublished, false):
+				to = ads.StatusPublished
+			case !rev.OldPublished && ad.Status == ads.StatusPublished:
+				to = ads.StatusArchived
+			}
+			return tx.UpdateStatus(ctx, ID, ad.Status, to, "", 0)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	apm.withImageURLs(ad)
+	return ad, nil
+}
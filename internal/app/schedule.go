@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"homework9/internal/ads"
+	"time"
+)
+
+// DefaultSchedulerInterval is used by RunScheduler when the interval is not set.
+const DefaultSchedulerInterval = 30 * time.Second
+
+// scheduleBatchSize limits the number of ads ApplySchedule processes at once.
+const scheduleBatchSize = 100
+
+func (apm *AppMethods) ScheduleAd(c context.Context, ID int64, UserID int64, PublishAt *time.Time, ExpiresAt *time.Time, Version int64) (*ads.Ad, error) {
+	PublishAt, ExpiresAt = utcPtr(PublishAt), utcPtr(ExpiresAt)
+	if err := validateSchedule(PublishAt, ExpiresAt, time.Now()); err != nil {
+		return nil, err
+	}
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	ad, err := apm.r.UpdateSchedule(ctx, ID, UserID, PublishAt, ExpiresAt, Version)
+	if err != nil {
+		return nil, err
+	}
+	apm.withImageURLs(ad)
+	return ad, nil
+}
+
+// ApplySchedule handles every due ad in its own transaction, so one broken
+// ad does not hold back the others. An ad that is both due to be published
+// and expired is left unpublished.
+func (apm *AppMethods) ApplySchedule(c context.Context, now time.Time) (int, error) {
+	ctx, cancel := withTimeout(c, apm.timeouts.List)
+	defer cancel()
+	list, err := apm.r.ListDueAds(ctx, now, apm.publishableStatuses(), scheduleBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	n := 0
+	for _, ad := range list {
+		if err := apm.applyAdSchedule(c, ad.ID, now); err != nil {
+			errs = append(errs, fmt.Errorf("ad %d: %w", ad.ID, err))
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+func (apm *AppMethods) applyAdSchedule(c context.Context, ID int64, now time.Time) error {
+	ctx, cancel := withTimeout(c, apm.timeouts.Write)
+	defer cancel()
+	return apm.r.RunInTx(ctx, func(tx Repository) error {
+		// The ad might have been changed since it was listed.
+		ad, err := tx.LockAd(ctx, ID)
+		if err != nil {
+			return err
+		}
+		publish, expire := due(ad.PublishAt, now), due(ad.ExpiresAt, now)
+		if ad.Deleted || !publish && !expire {
+			return nil
+		}
+		to, publishAt, expiresAt := ad.Status, ad.PublishAt, ad.ExpiresAt
+		switch {
+		case expire:
+			publishAt, expiresAt = nil, nil
+			if ad.Status == ads.StatusPublished {
+				to = ads.StatusArchived
+			}
+		case ad.Status == ads.StatusPublished:
+			publishAt = nil
+		case apm.canChangeStatus(ad.Status, ads.StatusPublished, false):
+			if _, err := tx.GetUser(ctx, ad.AuthorID); err != nil {
+				return err
+			}
+			to, publishAt = ads.StatusPublished, nil
+		default:
+			// The ad is not approved yet and is published once it is.
+			return nil
+		}
+		if to != ad.Status {
+			if _, err := changeStatus(ctx, tx, ad, ad.AuthorID, to, "", 0); err != nil {
+				return err
+			}
+		}
+		_, err = tx.UpdateSchedule(ctx, ID, ad.AuthorID, publishAt, expiresAt, 0)
+		return err
+	})
+}
+
+// RunScheduler calls ApplySchedule right away, to catch up on what was
+// missed while the service was down, and then every interval until ctx
+// is done. Errors are passed to onError and do not stop the scheduler.
+func RunScheduler(ctx context.Context, a App, interval time.Duration, onError func(error)) error {
+	if interval <= 0 {
+		interval = DefaultSchedulerInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := a.ApplySchedule(ctx, time.Now())
+			if err != nil && ctx.Err() == nil {
+				onError(err)
+			}
+			// A full batch means there may be more due ads.
+			if err != nil || n < scheduleBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func due(at *time.Time, now time.Time) bool {
+	return at != nil && !at.After(now)
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
@@ -0,0 +1,241 @@
+package app
+
+import (
+	"fmt"
+	"homework9/internal/ads"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Validation rules reported in Violation.Rule.
+const (
+	RuleRequired  = "required"
+	RuleMaxLength = "max_length"
+	RuleMinLength = "min_length"
+	RuleEmail     = "email"
+	RuleMaxItems  = "max_items"
+	RuleMin       = "min"
+	RuleCurrency  = "iso4217"
+	RuleOneOf     = "oneof"
+	RuleFuture    = "future"
+	RuleAfter     = "after"
+	RulePhone     = "e164"
+	RuleURL       = "url"
+)
+
+// Violation describes a single field that failed validation.
+type Violation struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+func (v Violation) String() string {
+	if v.Limit != 0 {
+		return fmt.Sprintf("%s: %s %d", v.Field, v.Rule, v.Limit)
+	}
+	return fmt.Sprintf("%s: %s", v.Field, v.Rule)
+}
+
+// ValidationError lists all violations found in a request, so that
+// clients can point at every wrong field at once.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return "validation error: " + strings.Join(msgs, "; ")
+}
+
+// Limits are the maximum lengths of ad fields in characters and the maximum
+// number of tags. Lengths cannot exceed the sizes of the table columns.
+type Limits struct {
+	TitleMaxLength int   `env:"AD_TITLE_MAX_LENGTH" envDefault:"100"`
+	TextMaxLength  int   `env:"AD_TEXT_MAX_LENGTH" envDefault:"500"`
+	MaxTags        int   `env:"AD_MAX_TAGS" envDefault:"10"`
+	TagMaxLength   int   `env:"AD_TAG_MAX_LENGTH" envDefault:"30"`
+	MaxImages      int   `env:"AD_MAX_IMAGES" envDefault:"10"`
+	MaxImageSize   int64 `env:"AD_MAX_IMAGE_SIZE" envDefault:"5242880"` // in bytes
+}
+
+var DefaultLimits = Limits{TitleMaxLength: 100, TextMaxLength: 500, MaxTags: 10, TagMaxLength: 30,
+	MaxImages: 10, MaxImageSize: 5 << 20}
+
+// categoryNameMaxLength is the size of categories.name.
+const categoryNameMaxLength = 100
+
+// WithLimits overrides the default limits; zero fields keep the defaults.
+func WithLimits(l Limits) Option {
+	return func(apm *AppMethods) {
+		if l.TitleMaxLength > 0 {
+			apm.limits.TitleMaxLength = l.TitleMaxLength
+		}
+		if l.TextMaxLength > 0 {
+			apm.limits.TextMaxLength = l.TextMaxLength
+		}
+		if l.MaxTags > 0 {
+			apm.limits.MaxTags = l.MaxTags
+		}
+		if l.TagMaxLength > 0 {
+			apm.limits.TagMaxLength = l.TagMaxLength
+		}
+		if l.MaxImages > 0 {
+			apm.limits.MaxImages = l.MaxImages
+		}
+		if l.MaxImageSize > 0 {
+			apm.limits.MaxImageSize = l.MaxImageSize
+		}
+	}
+}
+
+type validator struct {
+	violations []Violation
+}
+
+func (v *validator) required(field string, value string) {
+	if value == "" {
+		v.violations = append(v.violations, Violation{Field: field, Rule: RuleRequired})
+	}
+}
+
+func (v *validator) maxLength(field string, value string, limit int) {
+	if utf8.RuneCountInString(value) > limit {
+		v.violations = append(v.violations, Violation{Field: field, Rule: RuleMaxLength, Limit: limit})
+	}
+}
+
+func (v *validator) email(field string, value string) {
+	if addr, err := mail.ParseAddress(value); value != "" && (err != nil || addr.Address != value) {
+		v.violations = append(v.violations, Violation{Field: field, Rule: RuleEmail})
+	}
+}
+
+func (v *validator) maxItems(field string, n int, limit int) {
+	if n > limit {
+		v.violations = append(v.violations, Violation{Field: field, Rule: RuleMaxItems, Limit: limit})
+	}
+}
+
+func (v *validator) min(field string, value *int64, limit int64) {
+	if value != nil && *value < limit {
+		v.violations = append(v.violations, Violation{Field: field, Rule: RuleMin, Limit: int(limit)})
+	}
+}
+
+func (v *validator) currency(field string, code string) {
+	if code != "" && !currencies[code] {
+		v.violations = append(v.violations, Violation{Field: field, Rule: RuleCurrency})
+	}
+}
+
+// together requires both or neither of two optional fields.
+func (v *validator) together(field string, set bool, otherField string, otherSet bool) {
+	switch {
+	case set && !otherSet:
+		v.violations = append(v.violations, Violation{Field: otherField, Rule: RuleRequired})
+	case !set && otherSet:
+		v.violations = append(v.violations, Violation{Field: field, Rule: RuleRequired})
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: v.violations}
+}
+
+func (l Limits) validateAd(in ads.AdInput) error {
+	var v validator
+	v.required("title", in.Title)
+	v.maxLength("title", in.Title, l.TitleMaxLength)
+	v.required("text", in.Text)
+	v.maxLength("text", in.Text, l.TextMaxLength)
+	v.maxItems("tags", len(in.Tags), l.MaxTags)
+	for i, tag := range in.Tags {
+		v.maxLength(fmt.Sprintf("tags[%d]", i), tag, l.TagMaxLength)
+	}
+	v.min("price", in.Price, 0)
+	v.currency("currency", in.Currency)
+	v.together("price", in.Price != nil, "currency", in.Currency != "")
+	return v.err()
+}
+
+func validateFilter(filter ads.AdFilter) error {
+	var v validator
+	v.min("min_price", filter.MinPrice, 0)
+	v.min("max_price", filter.MaxPrice, 0)
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MaxPrice < *filter.MinPrice {
+		v.violations = append(v.violations, Violation{Field: "max_price", Rule: RuleMin, Limit: int(*filter.MinPrice)})
+	}
+	v.currency("currency", filter.Currency)
+	if filter.Currency == "" && (filter.MinPrice != nil || filter.MaxPrice != nil) {
+		v.violations = append(v.violations, Violation{Field: "currency", Rule: RuleRequired})
+	}
+	switch filter.Status {
+	case "", ads.StatusDraft, ads.StatusPendingReview, ads.StatusApproved, ads.StatusRejected, ads.StatusPublished, ads.StatusArchived:
+	default:
+		v.violations = append(v.violations, Violation{Field: "status", Rule: RuleOneOf})
+	}
+	switch filter.Sort {
+	case ads.SortDefault, ads.SortPriceAsc, ads.SortPriceDesc:
+	default:
+		v.violations = append(v.violations, Violation{Field: "sort", Rule: RuleOneOf})
+	}
+	return v.err()
+}
+
+func validateUserFilter(filter ads.UserFilter) error {
+	var v validator
+	switch filter.Role {
+	case "", ads.RoleUser, ads.RoleModerator, ads.RoleAdmin:
+	default:
+		v.violations = append(v.violations, Violation{Field: "role", Rule: RuleOneOf})
+	}
+	switch filter.Sort {
+	case ads.UserSortDefault, ads.UserSortDateCreated, ads.UserSortDateCreatedDesc:
+	default:
+		v.violations = append(v.violations, Violation{Field: "sort", Rule: RuleOneOf})
+	}
+	return v.err()
+}
+
+// validateSchedule lets PublishAt be in the past: such an ad is published
+// by the next run of the scheduler.
+func validateSchedule(PublishAt *time.Time, ExpiresAt *time.Time, now time.Time) error {
+	var v validator
+	if ExpiresAt != nil && !ExpiresAt.After(now) {
+		v.violations = append(v.violations, Violation{Field: "expires_at", Rule: RuleFuture})
+	}
+	if PublishAt != nil && ExpiresAt != nil && !ExpiresAt.After(*PublishAt) {
+		v.violations = append(v.violations, Violation{Field: "expires_at", Rule: RuleAfter})
+	}
+	return v.err()
+}
+
+func validateCategory(Name string) error {
+	var v validator
+	v.required("name", Name)
+	v.maxLength("name", Name, categoryNameMaxLength)
+	return v.err()
+}
+
+// normalizeTags makes tags case-insensitive and drops empty and repeated ones,
+// so that filtering by tags is a plain set inclusion.
+func normalizeTags(tags []string) []string {
+	res := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			res = append(res, tag)
+		}
+	}
+	slices.Sort(res)
+	return slices.Compact(res)
+}
@@ -9,6 +9,7 @@ import (
 	"google.golang.org/grpc"
 	"homework9/internal/adapters/adrepo"
 	"homework9/internal/adapters/adrepo/postgres"
+	"homework9/internal/adapters/blobstore"
 	"homework9/internal/app"
 	"homework9/internal/config"
 	pb "homework9/internal/ports/grpc"
@@ -32,6 +33,23 @@ func main() {
 		logger.Fatal("config fail", zap.Error(err))
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		out, err := runMigrate(cfg.PgConfig, os.Args[2:])
+		if err != nil {
+			logger.Fatal("migrate failed", zap.Error(err))
+		}
+		logger.Info("migrate: " + out)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "set-role" {
+		out, err := runSetRole(context.Background(), cfg.PgConfig, os.Args[2:])
+		if err != nil {
+			logger.Fatal("set-role failed", zap.Error(err))
+		}
+		logger.Info("set-role: " + out)
+		return
+	}
+
 	root, cancel := context.WithCancel(context.Background())
 	er, ctx := errgroup.WithContext(root)
 	ctx = context.WithValue(ctx, "logger", logger)
@@ -50,12 +68,43 @@ func main() {
 		}
 	})
 
-	conn, err := postgres.New(ctx, cfg.PgConfig)
-	defer conn.Close(ctx)
+	var repo app.Repository
+	switch cfg.Storage {
+	case "memory":
+		logger.Info("using in-memory storage")
+		repo = adrepo.New()
+	case "postgres", "":
+		pool, err := postgres.New(ctx, cfg.PgConfig)
+		if err != nil {
+			logger.Fatal("failed to connect to postgres", zap.Error(err))
+		}
+		defer pool.Close()
+		repo = adrepo.NewPostgres(pool)
+	default:
+		logger.Fatal("unknown storage", zap.String("storage", cfg.Storage))
+	}
+	deletePolicy, err := app.ParseUserDeletePolicy(cfg.UserDeletePolicy)
+	if err != nil {
+		logger.Fatal("config fail", zap.Error(err))
+	}
+	blobs, err := blobstore.NewLocal(cfg.Blobs)
 	if err != nil {
-		logger.Fatal("failed to connect to postgres", zap.Error(err))
+		logger.Fatal("failed to open blob store", zap.Error(err))
 	}
-	ap := app.NewApp(adrepo.New(ctx, conn))
+	ap := app.NewApp(repo,
+		app.WithUserDeletePolicy(deletePolicy),
+		app.WithTimeouts(cfg.Timeouts),
+		app.WithLimits(cfg.Limits),
+		app.WithBlobStore(blobs),
+		app.WithModeration(cfg.ModerationRequired),
+		app.WithAuth(cfg.Auth),
+	)
+
+	er.Go(func() error {
+		return app.RunScheduler(ctx, ap, cfg.SchedulerInterval, func(err error) {
+			logger.Error("scheduler failed", zap.Error(err))
+		})
+	})
 
 	er.Go(func() error {
 		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GrpcPort))
@@ -63,7 +112,7 @@ func main() {
 			return fmt.Errorf("failed to listen: %v", err)
 		}
 
-		grpcServer := grpc.NewServer()
+		grpcServer := grpc.NewServer(grpc.UnaryInterceptor(ser.AuthInterceptor(ap)))
 		pb.RegisterAdServiceServer(grpcServer, ser.NewMyServer(ap))
 
 		errCh := make(chan error, 1)
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"homework9/internal/adapters/adrepo/postgres"
+	"strconv"
+)
+
+const migrateUsage = `usage: main migrate <command>
+  up [N]      apply all (or N) pending migrations
+  down [N]    roll back N migrations (default 1)
+  to V        migrate up or down to version V (0 rolls back all migrations)
+  version     print the current version
+  force V     set version V without running migrations (fixes a dirty state)`
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(cfg postgres.PgConfig, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New(migrateUsage)
+	}
+	m, err := postgres.NewMigrate(cfg)
+	if err != nil {
+		return "", err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		n, err := optionalCount(args, 0)
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			err = m.Up()
+		} else {
+			err = m.Steps(n)
+		}
+		if err := ignoreNoChange(err); err != nil {
+			return "", err
+		}
+	case "down":
+		n, err := optionalCount(args, 1)
+		if err != nil {
+			return "", err
+		}
+		if err := ignoreNoChange(m.Steps(-n)); err != nil {
+			return "", err
+		}
+	case "to":
+		v, err := requiredVersion(args)
+		if err != nil {
+			return "", err
+		}
+		if err := ignoreNoChange(postgres.MigrateTo(m, uint(v))); err != nil {
+			return "", err
+		}
+	case "force":
+		v, err := requiredVersion(args)
+		if err != nil {
+			return "", err
+		}
+		if err := m.Force(v); err != nil {
+			return "", err
+		}
+	case "version":
+	default:
+		return "", fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return "no migrations applied", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("version %d, dirty: %t", version, dirty), nil
+}
+
+func optionalCount(args []string, def int) (int, error) {
+	if len(args) < 2 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s: N should be a positive number", args[0])
+	}
+	return n, nil
+}
+
+func requiredVersion(args []string) (int, error) {
+	if len(args) < 2 {
+		return 0, fmt.Errorf("%s: version is required\n%s", args[0], migrateUsage)
+	}
+	v, err := strconv.Atoi(args[1])
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%s: version should be a non-negative number", args[0])
+	}
+	return v, nil
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
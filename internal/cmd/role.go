@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/adapters/adrepo/postgres"
+	"homework9/internal/ads"
+	"strconv"
+)
+
+const setRoleUsage = `usage: main set-role <user_id> <role>
+  role is user, moderator or admin`
+
+// runSetRole implements the "set-role" subcommand. It writes to the database
+// directly, so that the first admin can be appointed without an admin.
+func runSetRole(ctx context.Context, cfg postgres.PgConfig, args []string) (string, error) {
+	if len(args) != 2 {
+		return "", errors.New(setRoleUsage)
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("user_id should be a number\n%s", setRoleUsage)
+	}
+	role := ads.Role(args[1])
+	switch role {
+	case ads.RoleUser, ads.RoleModerator, ads.RoleAdmin:
+	default:
+		return "", fmt.Errorf("unknown role %q\n%s", args[1], setRoleUsage)
+	}
+
+	pool, err := postgres.New(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer pool.Close()
+	user, err := adrepo.NewPostgres(pool).SetUserRole(ctx, id, role)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("user %d is %s", user.ID, user.Role), nil
+}
@@ -3,17 +3,41 @@ package config
 import (
 	"github.com/ilyakaznacheev/cleanenv"
 	"homework9/internal/adapters/adrepo/postgres"
+	"homework9/internal/adapters/blobstore"
+	"homework9/internal/app"
+	"os"
+	"time"
 )
 
 type Config struct {
 	GrpcPort int               `env:"GRPC_PORT" envDefault:"8080"`
 	RestPort int               `env:"REST_PORT" envDefault:"8081"`
+	Storage  string            `env:"STORAGE" envDefault:"postgres"` // postgres | memory
 	PgConfig postgres.PgConfig `env:"POSTGRES"`
+	Timeouts app.Timeouts      `env:"QUERY_TIMEOUTS"`
+	Limits   app.Limits        `env:"AD_LIMITS"`
+	Blobs    blobstore.Config  `env:"BLOBS"`
+	Auth     app.Auth          `env:"AUTH"`
+
+	UserDeletePolicy string `env:"USER_DELETE_POLICY" envDefault:"cascade"` // cascade | unpublish | restrict
+	// SchedulerInterval is how often scheduled ads are published and expired ones unpublished.
+	SchedulerInterval time.Duration `env:"SCHEDULER_INTERVAL" envDefault:"30s"`
+	// ModerationRequired makes ads pass a review before they are published.
+	ModerationRequired bool `env:"MODERATION_REQUIRED" envDefault:"false"`
 }
 
+// DefaultPath is the config file read when CONFIG_PATH is not set.
+const DefaultPath = "./internal/config/.env"
+
+// NewConfig reads the file at CONFIG_PATH (DefaultPath by default,
+// relative to the working directory); environment variables override it.
 func NewConfig() (*Config, error) {
+	path := os.Getenv("CONFIG_PATH")
+	if path == "" {
+		path = DefaultPath
+	}
 	c := new(Config)
-	if err := cleanenv.ReadConfig("./internal/config/.env", c); err != nil {
+	if err := cleanenv.ReadConfig(path, c); err != nil {
 		return nil, err
 	}
 	return c, nil
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	"homework9/internal/ports/grpc"
+)
+
+// AuthInterceptor marks the call as made by the user of the bearer token or the
+// API key in the "authorization" metadata. Calls without it pass as anonymous.
+func AuthInterceptor(a app.App) grpclib.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpclib.UnaryServerInfo, handler grpclib.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticate(ctx, a, values[0], info.FullMethod)
+		if err != nil {
+			return nil, toStatusError(err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func authenticate(ctx context.Context, a app.App, header string, method string) (context.Context, error) {
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		id, err := a.Authenticate(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		return app.ContextWithUser(ctx, id), nil
+	}
+	if secret, ok := strings.CutPrefix(header, "ApiKey "); ok {
+		key, err := a.AuthenticateAPIKey(ctx, secret)
+		if err != nil {
+			return nil, err
+		}
+		ctx = app.ContextWithAPIKey(ctx, key)
+		if err := app.CheckScope(ctx, methodScope(method)); err != nil {
+			return nil, err
+		}
+		return ctx, nil
+	}
+	return nil, app.ErrInvalidToken
+}
+
+// adWriteMethods are the changes of ads allowed to API keys with the ads:write scope.
+// Other methods that change anything cannot be called with an API key.
+var adWriteMethods = map[string]bool{
+	grpc.AdService_CreateAd_FullMethodName:        true,
+	grpc.AdService_UpdateAd_FullMethodName:        true,
+	grpc.AdService_ChangeAdStatus_FullMethodName:  true,
+	grpc.AdService_ScheduleAd_FullMethodName:      true,
+	grpc.AdService_SubmitAd_FullMethodName:        true,
+	grpc.AdService_DeleteAd_FullMethodName:        true,
+	grpc.AdService_RestoreAd_FullMethodName:       true,
+	grpc.AdService_RollbackAd_FullMethodName:      true,
+	grpc.AdService_AddAdImage_FullMethodName:      true,
+	grpc.AdService_DeleteAdImage_FullMethodName:   true,
+	grpc.AdService_ReorderAdImages_FullMethodName: true,
+}
+
+// methodScope returns the scope an API key needs for the method, or an empty one if no key may call it.
+// Methods that only read are named Get... or List....
+func methodScope(method string) ads.APIKeyScope {
+	name := method[strings.LastIndex(method, "/")+1:]
+	if strings.HasPrefix(name, "Get") || strings.HasPrefix(name, "List") {
+		return ads.ScopeRead
+	}
+	if adWriteMethods[method] {
+		return ads.ScopeAdsWrite
+	}
+	return ""
+}
@@ -1,33 +1,291 @@
 package service
 
 import (
+	"fmt"
 	"homework9/internal/ads"
+	"homework9/internal/app"
 	"homework9/internal/ports/grpc"
+	"time"
 )
 
 func ToAdResponse(a *ads.Ad) *grpc.AdResponse {
 	return &grpc.AdResponse{
-		Id:          a.ID,
-		Title:       a.Title,
-		Text:        a.Text,
-		AuthorId:    a.AuthorID,
-		Published:   a.Published,
-		DateCreated: a.DateCreated.Format("2006-01-02 15:04:05"),
-		DateUpdated: a.DateUpdated.Format("2006-01-02 15:04:05"),
+		Id:              a.ID,
+		Title:           a.Title,
+		Text:            a.Text,
+		AuthorId:        a.AuthorID,
+		Published:       a.Published,
+		Version:         a.Version,
+		DateCreated:     a.DateCreated.Format("2006-01-02 15:04:05"),
+		DateUpdated:     a.DateUpdated.Format("2006-01-02 15:04:05"),
+		Snippet:         a.Snippet,
+		CategoryId:      a.CategoryID,
+		Tags:            a.Tags,
+		Price:           a.Price,
+		Currency:        a.Currency,
+		Images:          toImageResponses(a.Images),
+		PublishAt:       formatSchedule(a.PublishAt),
+		ExpiresAt:       formatSchedule(a.ExpiresAt),
+		Status:          string(a.Status),
+		RejectionReason: a.RejectionReason,
+		Favorites:       a.Favorites,
 	}
 }
 
-func ToListAdResponse(a []*ads.Ad) *grpc.ListAdResponse {
+func formatSchedule(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseSchedule reads an RFC 3339 time; an empty string means no time.
+func parseSchedule(field string, s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("%s should be an RFC 3339 time", field)
+	}
+	return &t, nil
+}
+
+func toImageResponses(images []ads.Image) []*grpc.ImageResponse {
+	list := make([]*grpc.ImageResponse, len(images))
+	for i := range images {
+		list[i] = ToImageResponse(&images[i])
+	}
+	return list
+}
+
+func ToImageResponse(img *ads.Image) *grpc.ImageResponse {
+	return &grpc.ImageResponse{
+		Id:          img.ID,
+		Url:         img.URL,
+		ContentType: img.ContentType,
+		Size:        img.Size,
+		Position:    int32(img.Position),
+	}
+}
+
+func ToListImagesResponse(images []*ads.Image) *grpc.ListImagesResponse {
+	list := make([]*grpc.ImageResponse, len(images))
+	for i, img := range images {
+		list[i] = ToImageResponse(img)
+	}
+	return &grpc.ListImagesResponse{List: list}
+}
+
+func ToListAdResponse(a []*ads.Ad, total int64) *grpc.ListAdResponse {
 	var list = make([]*grpc.AdResponse, len(a))
 	for i := range a {
 		list[i] = ToAdResponse(a[i])
 	}
-	return &grpc.ListAdResponse{List: list}
+	return &grpc.ListAdResponse{List: list, Total: total}
+}
+
+func ToListAdRevisionsResponse(revs []*ads.Revision) *grpc.ListAdRevisionsResponse {
+	list := make([]*grpc.RevisionResponse, len(revs))
+	for i, rev := range revs {
+		list[i] = &grpc.RevisionResponse{
+			Id:           rev.ID,
+			AdId:         rev.AdID,
+			ActorId:      rev.ActorID,
+			OldTitle:     rev.OldTitle,
+			NewTitle:     rev.NewTitle,
+			OldText:      rev.OldText,
+			NewText:      rev.NewText,
+			OldPublished: rev.OldPublished,
+			NewPublished: rev.NewPublished,
+			OldStatus:    string(rev.OldStatus),
+			NewStatus:    string(rev.NewStatus),
+			DateCreated:  rev.DateCreated.Format("2006-01-02 15:04:05"),
+		}
+	}
+	return &grpc.ListAdRevisionsResponse{List: list}
+}
+
+func ToAdFilter(in *grpc.ListAdsRequest) ads.AdFilter {
+	filter := ads.AdFilter{Pub: true, Auth: -1}
+	if in.Published != nil {
+		filter.Pub = *in.Published
+	}
+	if in.AuthorId != nil {
+		filter.Auth = *in.AuthorId
+	}
+	filter.Title = in.Title
+	filter.Query = in.Q
+	filter.Category = in.CategoryId
+	filter.Tags = in.Tags
+	filter.MinPrice = in.MinPrice
+	filter.MaxPrice = in.MaxPrice
+	filter.Currency = in.Currency
+	filter.Sort = ads.AdSort(in.Sort)
+	filter.Status = ads.AdStatus(in.Status)
+	filter.Limit = int(in.Limit)
+	filter.Offset = int(in.Offset)
+	return filter
+}
+
+func ToThreadResponse(t *ads.Thread) *grpc.ThreadResponse {
+	return &grpc.ThreadResponse{
+		Id:          t.ID,
+		AdId:        t.AdID,
+		BuyerId:     t.BuyerID,
+		SellerId:    t.SellerID,
+		Unread:      t.Unread,
+		DateCreated: t.DateCreated.Format("2006-01-02 15:04:05"),
+		DateUpdated: t.DateUpdated.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func ToListThreadsResponse(threads []*ads.Thread, total int64) *grpc.ListThreadsResponse {
+	list := make([]*grpc.ThreadResponse, len(threads))
+	for i, t := range threads {
+		list[i] = ToThreadResponse(t)
+	}
+	return &grpc.ListThreadsResponse{List: list, Total: total}
+}
+
+func ToMessageResponse(msg *ads.Message) *grpc.MessageResponse {
+	resp := &grpc.MessageResponse{
+		Id:          msg.ID,
+		ThreadId:    msg.ThreadID,
+		SenderId:    msg.SenderID,
+		Text:        msg.Text,
+		DateCreated: msg.DateCreated.Format("2006-01-02 15:04:05"),
+	}
+	if msg.ReadAt != nil {
+		resp.ReadAt = msg.ReadAt.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
+
+func ToListMessagesResponse(msgs []*ads.Message, total int64) *grpc.ListMessagesResponse {
+	list := make([]*grpc.MessageResponse, len(msgs))
+	for i, msg := range msgs {
+		list[i] = ToMessageResponse(msg)
+	}
+	return &grpc.ListMessagesResponse{List: list, Total: total}
+}
+
+func ToReportResponse(rep *ads.Report) *grpc.ReportResponse {
+	resp := &grpc.ReportResponse{
+		Id:          rep.ID,
+		AdId:        rep.AdID,
+		ReporterId:  rep.ReporterID,
+		Reason:      string(rep.Reason),
+		Comment:     rep.Comment,
+		Status:      string(rep.Status),
+		Resolution:  string(rep.Resolution),
+		ResolvedBy:  rep.ResolvedBy,
+		DateCreated: rep.DateCreated.Format("2006-01-02 15:04:05"),
+	}
+	if rep.ResolvedAt != nil {
+		resp.ResolvedAt = rep.ResolvedAt.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
+
+func ToListReportsResponse(reports []*ads.Report) *grpc.ListReportsResponse {
+	list := make([]*grpc.ReportResponse, len(reports))
+	for i, rep := range reports {
+		list[i] = ToReportResponse(rep)
+	}
+	return &grpc.ListReportsResponse{List: list}
+}
+
+func ToListReportGroupsResponse(groups []*ads.ReportGroup, total int64) *grpc.ListReportGroupsResponse {
+	list := make([]*grpc.ReportGroupResponse, len(groups))
+	for i, group := range groups {
+		reports := make([]*grpc.ReportResponse, len(group.Reports))
+		for j := range group.Reports {
+			reports[j] = ToReportResponse(&group.Reports[j])
+		}
+		list[i] = &grpc.ReportGroupResponse{AdId: group.AdID, Reports: reports}
+	}
+	return &grpc.ListReportGroupsResponse{List: list, Total: total}
+}
+
+func ToListNotificationsResponse(notices []*ads.Notification, total int64) *grpc.ListNotificationsResponse {
+	list := make([]*grpc.NotificationResponse, len(notices))
+	for i, n := range notices {
+		list[i] = &grpc.NotificationResponse{Id: n.ID, Text: n.Text, DateCreated: n.DateCreated.Format("2006-01-02 15:04:05")}
+	}
+	return &grpc.ListNotificationsResponse{List: list, Total: total}
+}
+
+func ToCategoryResponse(cat *ads.Category) *grpc.CategoryResponse {
+	return &grpc.CategoryResponse{
+		Id:          cat.ID,
+		ParentId:    cat.ParentID,
+		Name:        cat.Name,
+		DateCreated: cat.DateCreated.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func ToListCategoriesResponse(cats []*ads.Category) *grpc.ListCategoriesResponse {
+	list := make([]*grpc.CategoryResponse, len(cats))
+	for i, cat := range cats {
+		list[i] = ToCategoryResponse(cat)
+	}
+	return &grpc.ListCategoriesResponse{List: list}
 }
 
 func ToUserResponse(u *ads.User) *grpc.UserResponse {
 	return &grpc.UserResponse{
-		Id:   u.ID,
-		Name: u.Name,
+		Id:          u.ID,
+		Name:        u.Name,
+		Email:       u.Email,
+		Role:        string(u.Role),
+		Phone:       u.Phone,
+		DisplayName: u.DisplayName,
+		AvatarUrl:   u.AvatarURL,
+		About:       u.About,
+		DateCreated: u.DateCreated.Format("2006-01-02 15:04:05"),
+		Deleted:     u.Deleted,
+		ActiveAds:   u.ActiveAds,
+	}
+}
+
+func ToListUsersResponse(users []*ads.User, total int64) *grpc.ListUsersResponse {
+	list := make([]*grpc.UserResponse, len(users))
+	for i, u := range users {
+		list[i] = ToUserResponse(u)
+	}
+	return &grpc.ListUsersResponse{List: list, Total: total}
+}
+
+func ToAPIKeyResponse(key *ads.APIKey) *grpc.APIKeyResponse {
+	resp := &grpc.APIKeyResponse{
+		Id:          key.ID,
+		Name:        key.Name,
+		Prefix:      key.Prefix,
+		Scope:       string(key.Scope),
+		DateCreated: key.DateCreated.Format("2006-01-02 15:04:05"),
+	}
+	if key.LastUsedAt != nil {
+		resp.LastUsedAt = key.LastUsedAt.Format("2006-01-02 15:04:05")
+	}
+	if key.RevokedAt != nil {
+		resp.RevokedAt = key.RevokedAt.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
+
+func ToListAPIKeysResponse(keys []*ads.APIKey) *grpc.ListAPIKeysResponse {
+	list := make([]*grpc.APIKeyResponse, len(keys))
+	for i, key := range keys {
+		list[i] = ToAPIKeyResponse(key)
+	}
+	return &grpc.ListAPIKeysResponse{List: list}
+}
+
+func ToTokensResponse(t *app.Tokens) *grpc.TokensResponse {
+	return &grpc.TokensResponse{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		ExpiresAt:    t.ExpiresAt.UTC().Format(time.RFC3339),
 	}
 }
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/app"
+	"io/fs"
+)
+
+// toStatusError maps application errors to gRPC status codes,
+// the same way httpgin.HandleError maps them to HTTP statuses.
+func toStatusError(err error) error {
+	var verr *app.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return validationStatus(verr)
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, app.ErrUnauthenticated) || errors.Is(err, app.ErrInvalidToken) || errors.Is(err, app.ErrInvalidCredentials) ||
+		errors.Is(err, app.ErrInvalidAPIKey):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, adrepo.ErrNotAuthor) || errors.Is(err, app.ErrNotParticipant) || errors.Is(err, app.ErrForbidden) ||
+		errors.Is(err, app.ErrScope) || errors.Is(err, app.ErrNoPermission):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, fs.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, app.ErrImageTooLarge) || errors.Is(err, app.ErrImageType) || errors.Is(err, app.ErrImageOrder):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, app.ErrTooManyImages) || errors.Is(err, app.ErrStatusTransition) || errors.Is(err, app.ErrAdNotPublished) ||
+		errors.Is(err, app.ErrNoOpenReports):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, adrepo.ErrConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, adrepo.ErrCategoryExists) || errors.Is(err, adrepo.ErrAlreadyReported) ||
+		errors.Is(err, adrepo.ErrEmailExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, adrepo.ErrCategoryNotEmpty) || errors.Is(err, app.ErrCategoryCycle):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, app.ErrUserHasActiveAds):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, adrepo.ErrUnknownAuthor) || errors.Is(err, adrepo.ErrUnknownCategory) || errors.Is(err, app.ErrOwnAd):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, adrepo.ErrNotCreated):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, adrepo.ErrWasDeleted) || errors.Is(err, adrepo.ErrNotDeleted):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// validationStatus reports the violations as BadRequest details.
+func validationStatus(err *app.ValidationError) error {
+	br := &errdetails.BadRequest{}
+	for _, v := range err.Violations {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.String(),
+		})
+	}
+	st, detErr := status.New(codes.InvalidArgument, err.Error()).WithDetails(br)
+	if detErr != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return st.Err()
+}
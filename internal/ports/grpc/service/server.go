@@ -1,7 +1,10 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"homework9/internal/ads"
 	"homework9/internal/app"
@@ -19,66 +22,577 @@ func NewMyServer(ap app.App) *MyServer {
 
 func (s *MyServer) CreateAd(c context.Context, adReq *grpc.CreateAdRequest) (*grpc.AdResponse, error) {
 	//log.Println("you are here")
-	adResp, err := s.a.CreateAd(c, adReq.Title, adReq.Text, adReq.UserId)
+	in := ads.AdInput{
+		Title:      adReq.Title,
+		Text:       adReq.Text,
+		CategoryID: adReq.CategoryId,
+		Tags:       adReq.Tags,
+		Price:      adReq.Price,
+		Currency:   adReq.Currency,
+	}
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, err := s.a.CreateAd(c, in, userID)
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
 	}
 	return ToAdResponse(adResp), nil
 }
 
 func (s *MyServer) ChangeAdStatus(c context.Context, adReq *grpc.ChangeAdStatusRequest) (*grpc.AdResponse, error) {
-	adResp, err := s.a.ChangeAdStatus(c, adReq.AdId, adReq.UserId, adReq.Published)
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, err := s.a.ChangeAdStatus(c, adReq.AdId, userID, adReq.Published, adReq.Version)
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
 	}
 	return ToAdResponse(adResp), nil
 }
 
 func (s *MyServer) UpdateAd(c context.Context, adReq *grpc.UpdateAdRequest) (*grpc.AdResponse, error) {
-	adResp, err := s.a.UpdateAd(c, adReq.AdId, adReq.UserId, adReq.Title, adReq.Text)
+	in := ads.AdInput{
+		Title:      adReq.Title,
+		Text:       adReq.Text,
+		CategoryID: adReq.CategoryId,
+		Tags:       adReq.Tags,
+		Price:      adReq.Price,
+		Currency:   adReq.Currency,
+	}
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, err := s.a.UpdateAd(c, adReq.AdId, userID, in, adReq.Version)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToAdResponse(adResp), nil
+}
+
+func (s *MyServer) ScheduleAd(c context.Context, in *grpc.ScheduleAdRequest) (*grpc.AdResponse, error) {
+	publishAt, err := parseSchedule("publish_at", in.PublishAt)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	expiresAt, err := parseSchedule("expires_at", in.ExpiresAt)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, err := s.a.ScheduleAd(c, in.AdId, userID, publishAt, expiresAt, in.Version)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToAdResponse(adResp), nil
+}
+
+func (s *MyServer) SubmitAd(c context.Context, in *grpc.SubmitAdRequest) (*grpc.AdResponse, error) {
+	userID, err := app.CurrentUser(c)
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
+	}
+	adResp, err := s.a.SubmitAd(c, in.AdId, userID, in.Version)
+	if err != nil {
+		return nil, toStatusError(err)
 	}
 	return ToAdResponse(adResp), nil
 }
 
-func (s *MyServer) ListAds(c context.Context, _ *emptypb.Empty) (*grpc.ListAdResponse, error) {
-	filter := ads.AdFilter{Pub: true, Auth: -1, Title: ""}
-	adResp, err := s.a.GetList(c, filter)
+func (s *MyServer) ApproveAd(c context.Context, in *grpc.ApproveAdRequest) (*grpc.AdResponse, error) {
+	moderatorID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, err := s.a.ApproveAd(c, in.AdId, moderatorID, in.Version)
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
 	}
-	return ToListAdResponse(adResp), nil
+	return ToAdResponse(adResp), nil
+}
+
+func (s *MyServer) RejectAd(c context.Context, in *grpc.RejectAdRequest) (*grpc.AdResponse, error) {
+	moderatorID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, err := s.a.RejectAd(c, in.AdId, moderatorID, in.Reason, in.Version)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToAdResponse(adResp), nil
+}
+
+func (s *MyServer) ListModerationQueue(c context.Context, in *grpc.ListModerationQueueRequest) (*grpc.ListAdResponse, error) {
+	moderatorID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, total, err := s.a.ModerationQueue(c, moderatorID, int(in.Limit), int(in.Offset))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListAdResponse(adResp, total), nil
+}
+
+func (s *MyServer) ListAds(c context.Context, in *grpc.ListAdsRequest) (*grpc.ListAdResponse, error) {
+	adResp, total, err := s.a.GetList(c, ToAdFilter(in))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListAdResponse(adResp, total), nil
+}
+
+func (s *MyServer) Register(c context.Context, in *grpc.RegisterRequest) (*grpc.UserResponse, error) {
+	resp, err := s.a.Register(c, in.Name, in.Email, in.Password)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToUserResponse(resp), nil
+}
+
+func (s *MyServer) Login(c context.Context, in *grpc.LoginRequest) (*grpc.TokensResponse, error) {
+	resp, err := s.a.Login(c, in.Email, in.Password)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToTokensResponse(resp), nil
+}
+
+func (s *MyServer) RefreshToken(c context.Context, in *grpc.RefreshTokenRequest) (*grpc.TokensResponse, error) {
+	resp, err := s.a.RefreshTokens(c, in.RefreshToken)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToTokensResponse(resp), nil
+}
+
+func (s *MyServer) Logout(c context.Context, in *grpc.RefreshTokenRequest) (*emptypb.Empty, error) {
+	if err := s.a.Logout(c, in.RefreshToken); err != nil {
+		return nil, toStatusError(err)
+	}
+	return &emptypb.Empty{}, nil
 }
 
 func (s *MyServer) CreateUser(c context.Context, in *grpc.CreateUserRequest) (*grpc.UserResponse, error) {
-	resp, err := s.a.CreateUser(c, in.Name)
+	adminID, err := app.CurrentUser(c)
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
+	}
+	resp, err := s.a.CreateUser(c, adminID, in.Name)
+	if err != nil {
+		return nil, toStatusError(err)
 	}
 	return ToUserResponse(resp), nil
 }
 
+func (s *MyServer) CreateAPIKey(c context.Context, in *grpc.CreateAPIKeyRequest) (*grpc.APIKeyResponse, error) {
+	if err := app.ActingAs(c, in.UserId); err != nil {
+		return nil, toStatusError(err)
+	}
+	key, secret, err := s.a.CreateAPIKey(c, in.UserId, in.Name, ads.APIKeyScope(in.Scope))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	resp := ToAPIKeyResponse(key)
+	resp.Key = secret
+	return resp, nil
+}
+
+func (s *MyServer) ListAPIKeys(c context.Context, in *grpc.ListAPIKeysRequest) (*grpc.ListAPIKeysResponse, error) {
+	if err := app.ActingAs(c, in.UserId); err != nil {
+		return nil, toStatusError(err)
+	}
+	keys, err := s.a.ListAPIKeys(c, in.UserId)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListAPIKeysResponse(keys), nil
+}
+
+func (s *MyServer) RevokeAPIKey(c context.Context, in *grpc.RevokeAPIKeyRequest) (*emptypb.Empty, error) {
+	if err := app.ActingAs(c, in.UserId); err != nil {
+		return nil, toStatusError(err)
+	}
+	if err := s.a.RevokeAPIKey(c, in.UserId, in.KeyId); err != nil {
+		return nil, toStatusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
 func (s *MyServer) GetUser(c context.Context, in *grpc.GetUserRequest) (*grpc.UserResponse, error) {
-	resp, err := s.a.GetUser(c, in.Id)
+	// Anonymous calls get the public profile.
+	viewerID := int64(-1)
+	if id, ok := app.UserFromContext(c); ok {
+		viewerID = id
+	}
+	resp, err := s.a.GetUser(c, in.Id, viewerID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToUserResponse(resp), nil
+}
+
+func (s *MyServer) ListUsers(c context.Context, in *grpc.ListUsersRequest) (*grpc.ListUsersResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	users, total, err := s.a.ListUsers(c, userID, ads.UserFilter{
+		Query:   in.Q,
+		Role:    ads.Role(in.Role),
+		Deleted: in.Deleted,
+		Sort:    ads.UserSort(in.Sort),
+		Limit:   int(in.Limit),
+		Offset:  int(in.Offset),
+	})
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListUsersResponse(users, total), nil
+}
+
+func (s *MyServer) UpdateUser(c context.Context, in *grpc.UpdateUserRequest) (*grpc.UserResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	resp, err := s.a.UpdateUser(c, in.Id, userID, ads.UserUpdate{
+		Name:        in.Name,
+		Email:       in.Email,
+		Phone:       in.Phone,
+		DisplayName: in.DisplayName,
+		AvatarURL:   in.AvatarUrl,
+		About:       in.About,
+	})
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
 	}
 	return ToUserResponse(resp), nil
 }
 
 func (s *MyServer) DeleteUser(c context.Context, in *grpc.DeleteUserRequest) (*emptypb.Empty, error) {
-	err := s.a.DeleteUser(c, in.Id)
+	userID, err := app.CurrentUser(c)
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
+	}
+	err = s.a.DeleteUser(c, in.Id, userID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *MyServer) AddFavorite(c context.Context, in *grpc.FavoriteRequest) (*grpc.AdResponse, error) {
+	if err := app.ActingAs(c, in.UserId); err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, err := s.a.AddFavorite(c, in.UserId, in.AdId)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToAdResponse(adResp), nil
+}
+
+func (s *MyServer) RemoveFavorite(c context.Context, in *grpc.FavoriteRequest) (*emptypb.Empty, error) {
+	if err := app.ActingAs(c, in.UserId); err != nil {
+		return nil, toStatusError(err)
+	}
+	if err := s.a.RemoveFavorite(c, in.UserId, in.AdId); err != nil {
+		return nil, toStatusError(err)
 	}
 	return &emptypb.Empty{}, nil
 }
 
+func (s *MyServer) ListFavorites(c context.Context, in *grpc.ListFavoritesRequest) (*grpc.ListAdResponse, error) {
+	if err := app.ActingAs(c, in.UserId); err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, total, err := s.a.ListFavorites(c, in.UserId, int(in.Limit), int(in.Offset))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListAdResponse(adResp, total), nil
+}
+
+func (s *MyServer) SendAdMessage(c context.Context, in *grpc.SendAdMessageRequest) (*grpc.MessageResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	msg, err := s.a.SendAdMessage(c, in.AdId, userID, in.Text)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToMessageResponse(msg), nil
+}
+
+func (s *MyServer) SendMessage(c context.Context, in *grpc.SendMessageRequest) (*grpc.MessageResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	msg, err := s.a.SendMessage(c, in.ThreadId, userID, in.Text)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToMessageResponse(msg), nil
+}
+
+func (s *MyServer) ListThreads(c context.Context, in *grpc.ListThreadsRequest) (*grpc.ListThreadsResponse, error) {
+	if err := app.ActingAs(c, in.UserId); err != nil {
+		return nil, toStatusError(err)
+	}
+	threads, total, err := s.a.ListThreads(c, in.UserId, int(in.Limit), int(in.Offset))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListThreadsResponse(threads, total), nil
+}
+
+func (s *MyServer) ListMessages(c context.Context, in *grpc.ListMessagesRequest) (*grpc.ListMessagesResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	msgs, total, err := s.a.ListMessages(c, in.ThreadId, userID, int(in.Limit), int(in.Offset))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListMessagesResponse(msgs, total), nil
+}
+
+func (s *MyServer) MarkThreadRead(c context.Context, in *grpc.MarkThreadReadRequest) (*grpc.ThreadResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	thread, err := s.a.MarkThreadRead(c, in.ThreadId, userID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToThreadResponse(thread), nil
+}
+
+func (s *MyServer) GetUnreadCount(c context.Context, in *grpc.GetUnreadCountRequest) (*grpc.UnreadCountResponse, error) {
+	if err := app.ActingAs(c, in.UserId); err != nil {
+		return nil, toStatusError(err)
+	}
+	n, err := s.a.UnreadCount(c, in.UserId)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &grpc.UnreadCountResponse{Unread: n}, nil
+}
+
+func (s *MyServer) ReportAd(c context.Context, in *grpc.ReportAdRequest) (*grpc.ReportResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	rep, err := s.a.ReportAd(c, in.AdId, userID, ads.ReportReason(in.Reason), in.Comment)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToReportResponse(rep), nil
+}
+
+func (s *MyServer) ListReports(c context.Context, in *grpc.ListReportsRequest) (*grpc.ListReportGroupsResponse, error) {
+	moderatorID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	groups, total, err := s.a.ListReports(c, moderatorID, int(in.Limit), int(in.Offset))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListReportGroupsResponse(groups, total), nil
+}
+
+func (s *MyServer) ResolveReports(c context.Context, in *grpc.ResolveReportsRequest) (*grpc.ListReportsResponse, error) {
+	moderatorID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	reports, err := s.a.ResolveReports(c, in.AdId, moderatorID, ads.ReportResolution(in.Resolution))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListReportsResponse(reports), nil
+}
+
+func (s *MyServer) ListNotifications(c context.Context, in *grpc.ListNotificationsRequest) (*grpc.ListNotificationsResponse, error) {
+	if err := app.ActingAs(c, in.UserId); err != nil {
+		return nil, toStatusError(err)
+	}
+	notices, total, err := s.a.ListNotifications(c, in.UserId, int(in.Limit), int(in.Offset))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListNotificationsResponse(notices, total), nil
+}
+
 func (s *MyServer) DeleteAd(c context.Context, in *grpc.DeleteAdRequest) (*emptypb.Empty, error) {
-	err := s.a.DeleteAd(c, in.AdId, in.AuthorId)
+	authorID, err := app.CurrentUser(c)
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
+	}
+	err = s.a.DeleteAd(c, in.AdId, authorID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *MyServer) RestoreAd(c context.Context, in *grpc.RestoreAdRequest) (*grpc.AdResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, err := s.a.RestoreAd(c, in.AdId, userID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToAdResponse(adResp), nil
+}
+
+func (s *MyServer) RestoreUser(c context.Context, in *grpc.RestoreUserRequest) (*grpc.UserResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	resp, err := s.a.RestoreUser(c, in.Id, userID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToUserResponse(resp), nil
+}
+
+func (s *MyServer) SetUserRole(c context.Context, in *grpc.SetUserRoleRequest) (*grpc.UserResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	resp, err := s.a.SetUserRole(c, in.Id, userID, ads.Role(in.Role))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToUserResponse(resp), nil
+}
+
+func (s *MyServer) ListAdRevisions(c context.Context, in *grpc.ListAdRevisionsRequest) (*grpc.ListAdRevisionsResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	resp, err := s.a.ListRevisions(c, in.AdId, userID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListAdRevisionsResponse(resp), nil
+}
+
+func (s *MyServer) RollbackAd(c context.Context, in *grpc.RollbackAdRequest) (*grpc.AdResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	adResp, err := s.a.RollbackAd(c, in.AdId, in.RevisionId, userID, in.Version)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToAdResponse(adResp), nil
+}
+
+func (s *MyServer) AddAdImage(c context.Context, in *grpc.AddAdImageRequest) (*grpc.ImageResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	resp, err := s.a.AddImage(c, in.AdId, userID, bytes.NewReader(in.Data))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToImageResponse(resp), nil
+}
+
+func (s *MyServer) DeleteAdImage(c context.Context, in *grpc.DeleteAdImageRequest) (*emptypb.Empty, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	err = s.a.DeleteImage(c, in.AdId, in.ImageId, userID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *MyServer) ReorderAdImages(c context.Context, in *grpc.ReorderAdImagesRequest) (*grpc.ListImagesResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	resp, err := s.a.ReorderImages(c, in.AdId, userID, in.ImageIds)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListImagesResponse(resp), nil
+}
+
+func (s *MyServer) CreateCategory(c context.Context, in *grpc.CreateCategoryRequest) (*grpc.CategoryResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	resp, err := s.a.CreateCategory(c, in.Name, in.ParentId, userID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToCategoryResponse(resp), nil
+}
+
+func (s *MyServer) GetCategory(c context.Context, in *grpc.GetCategoryRequest) (*grpc.CategoryResponse, error) {
+	resp, err := s.a.GetCategory(c, in.Id)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToCategoryResponse(resp), nil
+}
+
+func (s *MyServer) ListCategories(c context.Context, _ *emptypb.Empty) (*grpc.ListCategoriesResponse, error) {
+	resp, err := s.a.ListCategories(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToListCategoriesResponse(resp), nil
+}
+
+func (s *MyServer) UpdateCategory(c context.Context, in *grpc.UpdateCategoryRequest) (*grpc.CategoryResponse, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	resp, err := s.a.UpdateCategory(c, in.Id, userID, in.Name, in.ParentId)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return ToCategoryResponse(resp), nil
+}
+
+func (s *MyServer) DeleteCategory(c context.Context, in *grpc.DeleteCategoryRequest) (*emptypb.Empty, error) {
+	userID, err := app.CurrentUser(c)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	if err := s.a.DeleteCategory(c, in.Id, userID); err != nil {
+		return nil, toStatusError(err)
 	}
 	return &emptypb.Empty{}, nil
 }
@@ -1,27 +1,93 @@
 package httpgin
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"homework9/internal/adapters/adrepo"
 	"homework9/internal/ads"
 	"homework9/internal/app"
+	"io"
+	"io/fs"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// StatusClientClosedRequest is the nginx status for a request the client
+// gave up on before the response was ready.
+const StatusClientClosedRequest = 499
+
 func HandleError(c *gin.Context, err error) {
+	var verr *app.ValidationError
 	switch {
-	case errors.Is(err, adrepo.ErrNotAuthor):
+	case errors.As(err, &verr):
+		c.JSON(http.StatusBadRequest, ValidationErrorResponse(verr))
+	case errors.Is(err, context.Canceled):
+		c.JSON(StatusClientClosedRequest, ErrorResponse(err))
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, ErrorResponse(err))
+	case errors.Is(err, app.ErrUnauthenticated) || errors.Is(err, app.ErrInvalidToken) || errors.Is(err, app.ErrInvalidCredentials) ||
+		errors.Is(err, app.ErrInvalidAPIKey):
+		c.JSON(http.StatusUnauthorized, ErrorResponse(err))
+	case errors.Is(err, adrepo.ErrNotAuthor) || errors.Is(err, app.ErrNotParticipant) || errors.Is(err, app.ErrForbidden) ||
+		errors.Is(err, app.ErrScope) || errors.Is(err, app.ErrNoPermission):
 		c.JSON(http.StatusForbidden, ErrorResponse(err))
-	case errors.Is(err, adrepo.ErrValidate) || errors.Is(err, adrepo.ErrNotCreated) || errors.Is(err, adrepo.ErrWasDeleted):
+	case errors.Is(err, fs.ErrNotExist):
+		c.JSON(http.StatusNotFound, ErrorResponse(err))
+	case errors.Is(err, app.ErrImageTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse(err))
+	case errors.Is(err, app.ErrImageType):
+		c.JSON(http.StatusUnsupportedMediaType, ErrorResponse(err))
+	case errors.Is(err, adrepo.ErrConflict) || errors.Is(err, app.ErrUserHasActiveAds) ||
+		errors.Is(err, adrepo.ErrCategoryExists) || errors.Is(err, adrepo.ErrCategoryNotEmpty) ||
+		errors.Is(err, app.ErrTooManyImages) || errors.Is(err, app.ErrStatusTransition) ||
+		errors.Is(err, app.ErrAdNotPublished) || errors.Is(err, adrepo.ErrAlreadyReported) || errors.Is(err, app.ErrNoOpenReports) ||
+		errors.Is(err, adrepo.ErrEmailExists) || errors.Is(err, adrepo.ErrNotDeleted):
+		c.JSON(http.StatusConflict, ErrorResponse(err))
+	case errors.Is(err, adrepo.ErrNotCreated) || errors.Is(err, adrepo.ErrWasDeleted) || errors.Is(err, adrepo.ErrUnknownAuthor) ||
+		errors.Is(err, adrepo.ErrUnknownCategory) || errors.Is(err, app.ErrCategoryCycle) || errors.Is(err, app.ErrImageOrder) ||
+		errors.Is(err, app.ErrOwnAd):
 		c.JSON(http.StatusBadRequest, ErrorResponse(err))
 	default:
 		c.JSON(http.StatusInternalServerError, ErrorResponse(err))
 	}
 }
 
+// ifMatchVersion reads the expected ad version from the If-Match header.
+// A missing header or "*" means that any version is accepted.
+func ifMatchVersion(c *gin.Context) (int64, error) {
+	etag := strings.TrimSpace(c.GetHeader("If-Match"))
+	if etag == "" || etag == "*" {
+		return 0, nil
+	}
+	etag = strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+	version, err := strconv.ParseInt(etag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("If-Match should be an ad version")
+	}
+	return version, nil
+}
+
+// optionalInt parses an optional numeric query parameter.
+func optionalInt(c *gin.Context, name string) (*int64, error) {
+	s := c.Query(name)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s should be a number", name)
+	}
+	return &v, nil
+}
+
+func setETag(c *gin.Context, ad *ads.Ad) {
+	c.Header("ETag", strconv.Quote(strconv.FormatInt(ad.Version, 10)))
+}
+
 func CreateAd(c *gin.Context, a app.App) {
 	var adReq createAdRequest
 	if err := c.ShouldBind(&adReq); err != nil {
@@ -29,11 +95,25 @@ func CreateAd(c *gin.Context, a app.App) {
 		return
 	}
 
-	adResp, err := a.CreateAd(c, adReq.Title, adReq.Text, adReq.UserID)
+	in := ads.AdInput{
+		Title:      adReq.Title,
+		Text:       adReq.Text,
+		CategoryID: adReq.CategoryID,
+		Tags:       adReq.Tags,
+		Price:      adReq.Price,
+		Currency:   adReq.Currency,
+	}
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	adResp, err := a.CreateAd(c, in, userId)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
+	setETag(c, adResp)
 	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
 }
 
@@ -52,11 +132,56 @@ func ChangeAdStatus(c *gin.Context, a app.App) {
 		return
 	}
 
-	adResp, err := a.ChangeAdStatus(c, adId, adReq.UserID, adReq.Published)
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	adResp, err := a.ChangeAdStatus(c, adId, userId, adReq.Published, version)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	setETag(c, adResp)
+	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
+}
+
+func ScheduleAd(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var adReq scheduleAdRequest
+	if err := c.ShouldBind(&adReq); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	userId, err := app.CurrentUser(c)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
+	adResp, err := a.ScheduleAd(c, adId, userId, adReq.PublishAt, adReq.ExpiresAt, version)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	setETag(c, adResp)
 	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
 }
 
@@ -75,11 +200,31 @@ func UpdateAd(c *gin.Context, a app.App) {
 		return
 	}
 
-	adResp, err := a.UpdateAd(c, adId, adReq.UserID, adReq.Title, adReq.Text)
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	in := ads.AdInput{
+		Title:      adReq.Title,
+		Text:       adReq.Text,
+		CategoryID: adReq.CategoryID,
+		Tags:       adReq.Tags,
+		Price:      adReq.Price,
+		Currency:   adReq.Currency,
+	}
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	adResp, err := a.UpdateAd(c, adId, userId, in, version)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
+	setETag(c, adResp)
 	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
 }
 
@@ -93,13 +238,40 @@ func ListAds(c *gin.Context, a app.App) {
 		filter.Auth = -1
 	}
 	filter.Title = c.Query("title")
+	filter.Query = c.Query("q")
+	if filter.Category, err = optionalInt(c, "category"); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+	if filter.MinPrice, err = optionalInt(c, "min_price"); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+	if filter.MaxPrice, err = optionalInt(c, "max_price"); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+	filter.Status = ads.AdStatus(c.Query("status"))
+	filter.Currency = c.Query("currency")
+	filter.Sort = ads.AdSort(c.Query("sort"))
+	if tags := c.Query("tags"); tags != "" {
+		filter.Tags = strings.Split(tags, ",")
+	}
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("limit should be a number")))
+		return
+	}
+	if filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("offset should be a number")))
+		return
+	}
 
-	adResp, err := a.GetList(c, filter)
+	adResp, total, err := a.GetList(c, filter)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, AdListSuccessResponse(adResp))
+	c.JSON(http.StatusOK, AdListSuccessResponse(adResp, total))
 }
 
 func GetAd(c *gin.Context, a app.App) {
@@ -115,6 +287,7 @@ func GetAd(c *gin.Context, a app.App) {
 		HandleError(c, err)
 		return
 	}
+	setETag(c, adResp)
 	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
 }
 
@@ -126,59 +299,1028 @@ func DeleteAd(c *gin.Context, a app.App) {
 		return
 	}
 
-	var adReq DeleteAdRequest
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	err = a.DeleteAd(c, adId, userId)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func RestoreAd(c *gin.Context, a app.App) {
+	strId := c.Param("id")
+	adId, err := strconv.ParseInt(strId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	adResp, err := a.RestoreAd(c, adId, userId)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	setETag(c, adResp)
+	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
+}
+
+func SubmitAd(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	adResp, err := a.SubmitAd(c, adId, userId, version)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	setETag(c, adResp)
+	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
+}
+
+func ApproveAd(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var adReq moderateAdRequest
 	if err := c.ShouldBind(&adReq); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
 	}
 
-	err = a.DeleteAd(c, adId, adReq.AuthorId)
+	moderatorId, err := app.CurrentUser(c)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{})
+	adResp, err := a.ApproveAd(c, adId, moderatorId, version)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	setETag(c, adResp)
+	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
 }
 
-func CreateUser(c *gin.Context, a app.App) {
-	var req CreateUserRequest
-	if err := c.ShouldBind(&req); err != nil {
+func RejectAd(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var adReq moderateAdRequest
+	if err := c.ShouldBind(&adReq); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse(err))
 		return
 	}
 
-	resp, err := a.CreateUser(c, req.Name)
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	moderatorId, err := app.CurrentUser(c)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, UserSuccessResponse(resp))
+	adResp, err := a.RejectAd(c, adId, moderatorId, adReq.Reason, version)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	setETag(c, adResp)
+	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
 }
 
-func GetUser(c *gin.Context, a app.App) {
+func ListModerationQueue(c *gin.Context, a app.App) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("limit should be a number")))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("offset should be a number")))
+		return
+	}
+	moderatorId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	adResp, total, err := a.ModerationQueue(c, moderatorId, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, AdListSuccessResponse(adResp, total))
+}
+
+func ListAdRevisions(c *gin.Context, a app.App) {
 	strId := c.Param("id")
-	id, err := strconv.ParseInt(strId, 10, 64)
+	adId, err := strconv.ParseInt(strId, 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
 		return
 	}
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
 
-	resp, err := a.GetUser(c, id)
+	resp, err := a.ListRevisions(c, adId, userId)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, UserSuccessResponse(resp))
+	c.JSON(http.StatusOK, RevisionListSuccessResponse(resp))
 }
 
-func DeleteUser(c *gin.Context, a app.App) {
-	strId := c.Param("id")
-	id, err := strconv.ParseInt(strId, 10, 64)
+func RollbackAd(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	revId, err := strconv.ParseInt(c.Param("rev_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("rev_id should be a number")))
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	adResp, err := a.RollbackAd(c, adId, revId, userId, version)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	setETag(c, adResp)
+	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
+}
+
+// AddAdImage takes a multipart form with the file in the "image" field.
+func AddAdImage(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	header, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("image file is required")))
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+	defer file.Close()
+
+	img, err := a.AddImage(c, adId, userId, file)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ImageSuccessResponse(img))
+}
+
+func DeleteAdImage(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	imageId, err := strconv.ParseInt(c.Param("image_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("image_id should be a number")))
+		return
+	}
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	if err := a.DeleteImage(c, adId, imageId, userId); err != nil {
+		HandleError(c, err)
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{})
+}
 
-	err = a.DeleteUser(c, id)
+func ReorderAdImages(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var req reorderImagesRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	images, err := a.ReorderImages(c, adId, userId, req.ImageIDs)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ImageListSuccessResponse(images))
+}
+
+// GetImage serves the content of an image. Image keys are never reused,
+// so clients may cache the response forever.
+func GetImage(c *gin.Context, a app.App) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	rc, err := a.OpenImage(c, key)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	defer rc.Close()
+
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, key, time.Time{}, rs)
+		return
+	}
+	c.DataFromReader(http.StatusOK, -1, "", rc, nil)
+}
+
+func CreateCategory(c *gin.Context, a app.App) {
+	var req categoryRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	resp, err := a.CreateCategory(c, req.Name, req.ParentID, userId)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, CategorySuccessResponse(resp))
+}
+
+func GetCategory(c *gin.Context, a app.App) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	resp, err := a.GetCategory(c, id)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, CategorySuccessResponse(resp))
+}
+
+func ListCategories(c *gin.Context, a app.App) {
+	resp, err := a.ListCategories(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, CategoryListSuccessResponse(resp))
+}
+
+func UpdateCategory(c *gin.Context, a app.App) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var req categoryRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	resp, err := a.UpdateCategory(c, id, userId, req.Name, req.ParentID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, CategorySuccessResponse(resp))
+}
+
+func DeleteCategory(c *gin.Context, a app.App) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	if err := a.DeleteCategory(c, id, userId); err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func CreateUser(c *gin.Context, a app.App) {
+	var req CreateUserRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	adminId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	resp, err := a.CreateUser(c, adminId, req.Name)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, UserSuccessResponse(resp))
+}
+
+func ListUsers(c *gin.Context, a app.App) {
+	var filter ads.UserFilter
+	var err error
+	filter.Query = c.Query("q")
+	filter.Role = ads.Role(c.Query("role"))
+	filter.Sort = ads.UserSort(c.Query("sort"))
+	if s := c.Query("deleted"); s != "" {
+		deleted, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("deleted should be true or false")))
+			return
+		}
+		filter.Deleted = &deleted
+	}
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("limit should be a number")))
+		return
+	}
+	if filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("offset should be a number")))
+		return
+	}
+	adminId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	users, total, err := a.ListUsers(c, adminId, filter)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, UserListSuccessResponse(users, total))
+}
+
+func GetUser(c *gin.Context, a app.App) {
+	strId := c.Param("id")
+	id, err := strconv.ParseInt(strId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	// Anonymous requests get the public profile.
+	viewerId := int64(-1)
+	if id, ok := app.UserFromContext(c); ok {
+		viewerId = id
+	}
+
+	resp, err := a.GetUser(c, id, viewerId)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, UserSuccessResponse(resp))
+}
+
+// UpdateUser replaces the profile on PUT, clearing the fields that are not
+// sent, and changes only the sent fields on PATCH.
+func UpdateUser(c *gin.Context, a app.App) {
+	strId := c.Param("id")
+	id, err := strconv.ParseInt(strId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var req updateUserRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+	actorId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	resp, err := a.UpdateUser(c, id, actorId, req.update(c.Request.Method == http.MethodPut))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, UserSuccessResponse(resp))
+}
+
+func DeleteUser(c *gin.Context, a app.App) {
+	strId := c.Param("id")
+	id, err := strconv.ParseInt(strId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	actorId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	err = a.DeleteUser(c, id, actorId)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func RestoreUser(c *gin.Context, a app.App) {
+	strId := c.Param("id")
+	id, err := strconv.ParseInt(strId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	actorId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	resp, err := a.RestoreUser(c, id, actorId)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, UserSuccessResponse(resp))
+}
+
+func SetUserRole(c *gin.Context, a app.App) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var req setUserRoleRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+	actorId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	resp, err := a.SetUserRole(c, id, actorId, ads.Role(req.Role))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, UserSuccessResponse(resp))
+}
+
+func CreateAPIKey(c *gin.Context, a app.App) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	if err := app.ActingAs(c, userId); err != nil {
+		HandleError(c, err)
+		return
+	}
+	var req createAPIKeyRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	key, secret, err := a.CreateAPIKey(c, userId, req.Name, ads.APIKeyScope(req.Scope))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, NewAPIKeySuccessResponse(key, secret))
+}
+
+func ListAPIKeys(c *gin.Context, a app.App) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	if err := app.ActingAs(c, userId); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	keys, err := a.ListAPIKeys(c, userId)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, APIKeyListSuccessResponse(keys))
+}
+
+func RevokeAPIKey(c *gin.Context, a app.App) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	if err := app.ActingAs(c, userId); err != nil {
+		HandleError(c, err)
+		return
+	}
+	keyId, err := strconv.ParseInt(c.Param("key_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("key_id should be a number")))
+		return
+	}
+
+	if err := a.RevokeAPIKey(c, userId, keyId); err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func AddFavorite(c *gin.Context, a app.App) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	if err := app.ActingAs(c, userId); err != nil {
+		HandleError(c, err)
+		return
+	}
+	adId, err := strconv.ParseInt(c.Param("ad_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("ad_id should be a number")))
+		return
+	}
+
+	adResp, err := a.AddFavorite(c, userId, adId)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, AdSuccessResponse(adResp))
+}
+
+func RemoveFavorite(c *gin.Context, a app.App) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	if err := app.ActingAs(c, userId); err != nil {
+		HandleError(c, err)
+		return
+	}
+	adId, err := strconv.ParseInt(c.Param("ad_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("ad_id should be a number")))
+		return
+	}
+
+	if err := a.RemoveFavorite(c, userId, adId); err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func ListFavorites(c *gin.Context, a app.App) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	if err := app.ActingAs(c, userId); err != nil {
+		HandleError(c, err)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("limit should be a number")))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("offset should be a number")))
+		return
+	}
+
+	adResp, total, err := a.ListFavorites(c, userId, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, AdListSuccessResponse(adResp, total))
+}
+
+func SendAdMessage(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var msgReq sendMessageRequest
+	if err := c.ShouldBind(&msgReq); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	msg, err := a.SendAdMessage(c, adId, userId, msgReq.Text)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageSuccessResponse(msg))
+}
+
+func SendMessage(c *gin.Context, a app.App) {
+	threadId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var msgReq sendMessageRequest
+	if err := c.ShouldBind(&msgReq); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	msg, err := a.SendMessage(c, threadId, userId, msgReq.Text)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageSuccessResponse(msg))
+}
+
+func ListThreads(c *gin.Context, a app.App) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	if err := app.ActingAs(c, userId); err != nil {
+		HandleError(c, err)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("limit should be a number")))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("offset should be a number")))
+		return
+	}
+
+	threads, total, err := a.ListThreads(c, userId, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ThreadListSuccessResponse(threads, total))
+}
+
+func ListMessages(c *gin.Context, a app.App) {
+	threadId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("limit should be a number")))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("offset should be a number")))
+		return
+	}
+
+	msgs, total, err := a.ListMessages(c, threadId, userId, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MessageListSuccessResponse(msgs, total))
+}
+
+func MarkThreadRead(c *gin.Context, a app.App) {
+	threadId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	thread, err := a.MarkThreadRead(c, threadId, userId)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ThreadSuccessResponse(thread))
+}
+
+func GetUnreadCount(c *gin.Context, a app.App) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	if err := app.ActingAs(c, userId); err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	n, err := a.UnreadCount(c, userId)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": unreadResponse{Unread: n}, "error": nil})
+}
+
+func ReportAd(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var repReq reportAdRequest
+	if err := c.ShouldBind(&repReq); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	userId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	rep, err := a.ReportAd(c, adId, userId, ads.ReportReason(repReq.Reason), repReq.Comment)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ReportSuccessResponse(rep))
+}
+
+func ListReports(c *gin.Context, a app.App) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("limit should be a number")))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("offset should be a number")))
+		return
+	}
+	moderatorId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	groups, total, err := a.ListReports(c, moderatorId, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ReportGroupListSuccessResponse(groups, total))
+}
+
+func ResolveReports(c *gin.Context, a app.App) {
+	adId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+
+	var resReq resolveReportsRequest
+	if err := c.ShouldBind(&resReq); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	moderatorId, err := app.CurrentUser(c)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	reports, err := a.ResolveReports(c, adId, moderatorId, ads.ReportResolution(resReq.Resolution))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ReportListSuccessResponse(reports))
+}
+
+func ListNotifications(c *gin.Context, a app.App) {
+	userId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("id should be a number")))
+		return
+	}
+	if err := app.ActingAs(c, userId); err != nil {
+		HandleError(c, err)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("limit should be a number")))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(fmt.Errorf("offset should be a number")))
+		return
+	}
+
+	notices, total, err := a.ListNotifications(c, userId, limit, offset)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, NotificationListSuccessResponse(notices, total))
+}
+
+func Register(c *gin.Context, a app.App) {
+	var req registerRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	resp, err := a.Register(c, req.Name, req.Email, req.Password)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, UserSuccessResponse(resp))
+}
+
+func Login(c *gin.Context, a app.App) {
+	var req loginRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	resp, err := a.Login(c, req.Email, req.Password)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, TokensSuccessResponse(resp))
+}
+
+func RefreshToken(c *gin.Context, a app.App) {
+	var req refreshTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	resp, err := a.RefreshTokens(c, req.RefreshToken)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, TokensSuccessResponse(resp))
+}
+
+func Logout(c *gin.Context, a app.App) {
+	var req refreshTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(err))
+		return
+	}
+
+	if err := a.Logout(c, req.RefreshToken); err != nil {
 		HandleError(c, err)
 		return
 	}
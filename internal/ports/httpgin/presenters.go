@@ -3,84 +3,602 @@ package httpgin
 import (
 	"github.com/gin-gonic/gin"
 	"homework9/internal/ads"
+	"homework9/internal/app"
+	"time"
 )
 
 type createAdRequest struct {
-	Title  string `json:"title"`
-	Text   string `json:"text"`
-	UserID int64  `json:"user_id"`
+	Title      string   `json:"title"`
+	Text       string   `json:"text"`
+	CategoryID *int64   `json:"category_id"`
+	Tags       []string `json:"tags"`
+	Price      *int64   `json:"price"`
+	Currency   string   `json:"currency"`
 }
 
 type adResponse struct {
+	ID              int64           `json:"id"`
+	Title           string          `json:"title"`
+	Text            string          `json:"text"`
+	AuthorID        int64           `json:"author_id"`
+	CategoryID      *int64          `json:"category_id"`
+	Tags            []string        `json:"tags"`
+	Price           *int64          `json:"price"`
+	Currency        string          `json:"currency,omitempty"`
+	Images          []imageResponse `json:"images"`
+	Status          string          `json:"status"`
+	Published       bool            `json:"published"`
+	RejectionReason string          `json:"rejection_reason,omitempty"`
+	PublishAt       *string         `json:"publish_at"`
+	ExpiresAt       *string         `json:"expires_at"`
+	Favorites       int64           `json:"favorites"`
+	Version         int64           `json:"version"`
+	DateCreated     string          `json:"date_created"`
+	DateUpdated     string          `json:"date_updated"`
+	Snippet         string          `json:"snippet,omitempty"`
+}
+
+type changeAdStatusRequest struct {
+	Published bool `json:"published"`
+}
+
+// moderateAdRequest approves or rejects an ad; Reason is required to reject.
+type moderateAdRequest struct {
+	Reason string `json:"reason"`
+}
+
+// scheduleAdRequest takes the times in RFC 3339; null clears a time.
+type scheduleAdRequest struct {
+	PublishAt *time.Time `json:"publish_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type updateAdRequest struct {
+	Title      string   `json:"title"`
+	Text       string   `json:"text"`
+	CategoryID *int64   `json:"category_id"`
+	Tags       []string `json:"tags"`
+	Price      *int64   `json:"price"`
+	Currency   string   `json:"currency"`
+}
+
+type reorderImagesRequest struct {
+	ImageIDs []int64 `json:"image_ids"`
+}
+
+type imageResponse struct {
 	ID          int64  `json:"id"`
-	Title       string `json:"title"`
-	Text        string `json:"text"`
-	AuthorID    int64  `json:"author_id"`
-	Published   bool   `json:"published"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Position    int    `json:"position"`
+}
+
+type revisionResponse struct {
+	ID           int64  `json:"id"`
+	AdID         int64  `json:"ad_id"`
+	ActorID      int64  `json:"actor_id"`
+	OldTitle     string `json:"old_title"`
+	NewTitle     string `json:"new_title"`
+	OldText      string `json:"old_text"`
+	NewText      string `json:"new_text"`
+	OldPublished bool   `json:"old_published"`
+	NewPublished bool   `json:"new_published"`
+	OldStatus    string `json:"old_status"`
+	NewStatus    string `json:"new_status"`
+	DateCreated  string `json:"date_created"`
+}
+
+type sendMessageRequest struct {
+	Text string `json:"text"`
+}
+
+type threadResponse struct {
+	ID          int64  `json:"id"`
+	AdID        int64  `json:"ad_id"`
+	BuyerID     int64  `json:"buyer_id"`
+	SellerID    int64  `json:"seller_id"`
+	Unread      int64  `json:"unread"`
 	DateCreated string `json:"date_created"`
 	DateUpdated string `json:"date_updated"`
 }
 
-type changeAdStatusRequest struct {
-	Published bool  `json:"published"`
-	UserID    int64 `json:"user_id"`
+type messageResponse struct {
+	ID          int64   `json:"id"`
+	ThreadID    int64   `json:"thread_id"`
+	SenderID    int64   `json:"sender_id"`
+	Text        string  `json:"text"`
+	ReadAt      *string `json:"read_at"`
+	DateCreated string  `json:"date_created"`
 }
 
-type updateAdRequest struct {
-	Title  string `json:"title"`
-	Text   string `json:"text"`
-	UserID int64  `json:"user_id"`
+type unreadResponse struct {
+	Unread int64 `json:"unread"`
 }
 
-type DeleteAdRequest struct {
-	AuthorId int64 `json:"author_id"`
+type reportAdRequest struct {
+	Reason  string `json:"reason"`
+	Comment string `json:"comment"`
+}
+
+type resolveReportsRequest struct {
+	Resolution string `json:"resolution"`
+}
+
+type reportResponse struct {
+	ID          int64   `json:"id"`
+	AdID        int64   `json:"ad_id"`
+	ReporterID  int64   `json:"reporter_id"`
+	Reason      string  `json:"reason"`
+	Comment     string  `json:"comment"`
+	Status      string  `json:"status"`
+	Resolution  string  `json:"resolution,omitempty"`
+	ResolvedBy  *int64  `json:"resolved_by"`
+	ResolvedAt  *string `json:"resolved_at"`
+	DateCreated string  `json:"date_created"`
+}
+
+type reportGroupResponse struct {
+	AdID    int64            `json:"ad_id"`
+	Reports []reportResponse `json:"reports"`
+}
+
+type notificationResponse struct {
+	ID          int64  `json:"id"`
+	Text        string `json:"text"`
+	DateCreated string `json:"date_created"`
+}
+
+type categoryRequest struct {
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+type categoryResponse struct {
+	ID          int64  `json:"id"`
+	ParentID    *int64 `json:"parent_id"`
+	Name        string `json:"name"`
+	DateCreated string `json:"date_created"`
 }
 
 type CreateUserRequest struct {
 	Name string `json:"name"`
 }
 
+// userResponse leaves out the contacts of the public profile.
 type userResponse struct {
-	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Email       string `json:"email,omitempty"`
+	Phone       string `json:"phone,omitempty"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	About       string `json:"about"`
+	Role        string `json:"role"`
+	DateCreated string `json:"date_created"`
+}
+
+type listedUserResponse struct {
+	userResponse
+	Deleted   bool  `json:"deleted"`
+	ActiveAds int64 `json:"active_ads"`
+}
+
+type updateUserRequest struct {
+	Name        *string `json:"name"`
+	Email       *string `json:"email"`
+	Phone       *string `json:"phone"`
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	About       *string `json:"about"`
+}
+
+// update returns the change the request makes. A full replacement
+// clears the fields the request does not set.
+func (r updateUserRequest) update(replace bool) ads.UserUpdate {
+	field := func(value *string) *string {
+		if value == nil && replace {
+			return new(string)
+		}
+		return value
+	}
+	return ads.UserUpdate{
+		Name:        field(r.Name),
+		Email:       field(r.Email),
+		Phone:       field(r.Phone),
+		DisplayName: field(r.DisplayName),
+		AvatarURL:   field(r.AvatarURL),
+		About:       field(r.About),
+	}
+}
+
+type setUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type registerRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type tokensResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresAt    string `json:"expires_at"` // RFC 3339
+}
+
+type createAPIKeyRequest struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+}
+
+type apiKeyResponse struct {
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	Prefix      string  `json:"prefix"`
+	Scope       string  `json:"scope"`
+	Key         string  `json:"key,omitempty"` // only when the key is created
+	LastUsedAt  *string `json:"last_used_at"`
+	RevokedAt   *string `json:"revoked_at"`
+	DateCreated string  `json:"date_created"`
+}
+
+func toAdResponse(ad *ads.Ad) adResponse {
+	tags := ad.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	images := make([]imageResponse, len(ad.Images))
+	for i := range ad.Images {
+		images[i] = toImageResponse(&ad.Images[i])
+	}
+	return adResponse{
+		ID:              ad.ID,
+		Title:           ad.Title,
+		Text:            ad.Text,
+		AuthorID:        ad.AuthorID,
+		CategoryID:      ad.CategoryID,
+		Tags:            tags,
+		Price:           ad.Price,
+		Currency:        ad.Currency,
+		Images:          images,
+		Status:          string(ad.Status),
+		Published:       ad.Published,
+		RejectionReason: ad.RejectionReason,
+		PublishAt:       formatSchedule(ad.PublishAt),
+		ExpiresAt:       formatSchedule(ad.ExpiresAt),
+		Favorites:       ad.Favorites,
+		Version:         ad.Version,
+		DateCreated:     ad.DateCreated.Format("2006-01-02 15:04:05"),
+		DateUpdated:     ad.DateUpdated.Format("2006-01-02 15:04:05"),
+		Snippet:         ad.Snippet,
+	}
+}
+
+// formatSchedule renders a scheduled time in RFC 3339, the format it is set in.
+func formatSchedule(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339)
+	return &s
 }
 
 func AdSuccessResponse(ad *ads.Ad) gin.H {
 	return gin.H{
-		"data": adResponse{
-			ID:          ad.ID,
-			Title:       ad.Title,
-			Text:        ad.Text,
-			AuthorID:    ad.AuthorID,
-			Published:   ad.Published,
-			DateCreated: ad.DateCreated.Format("2006-01-02 15:04:05"),
-			DateUpdated: ad.DateUpdated.Format("2006-01-02 15:04:05"),
-		},
+		"data":  toAdResponse(ad),
 		"error": nil,
 	}
 }
 
+func toUserResponse(user *ads.User) userResponse {
+	return userResponse{
+		ID:          user.ID,
+		Name:        user.Name,
+		Email:       user.Email,
+		Phone:       user.Phone,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		About:       user.About,
+		Role:        string(user.Role),
+		DateCreated: user.DateCreated.Format("2006-01-02 15:04:05"),
+	}
+}
+
 func UserSuccessResponse(user *ads.User) gin.H {
 	return gin.H{
-		"data": userResponse{
-			ID:   user.ID,
-			Name: user.Name,
+		"data":  toUserResponse(user),
+		"error": nil,
+	}
+}
+
+func UserListSuccessResponse(users []*ads.User, total int64) gin.H {
+	resp := make([]listedUserResponse, len(users))
+	for i, user := range users {
+		resp[i] = listedUserResponse{userResponse: toUserResponse(user), Deleted: user.Deleted, ActiveAds: user.ActiveAds}
+	}
+	return gin.H{
+		"data":  resp,
+		"total": total,
+		"error": nil,
+	}
+}
+
+func TokensSuccessResponse(tokens *app.Tokens) gin.H {
+	return gin.H{
+		"data": tokensResponse{
+			AccessToken:  tokens.AccessToken,
+			RefreshToken: tokens.RefreshToken,
+			TokenType:    "Bearer",
+			ExpiresAt:    tokens.ExpiresAt.UTC().Format(time.RFC3339),
 		},
 		"error": nil,
 	}
 }
 
-func AdListSuccessResponse(ad []*ads.Ad) gin.H {
+func AdListSuccessResponse(ad []*ads.Ad, total int64) gin.H {
 	resp := make([]adResponse, len(ad))
 	for i := range ad {
-		resp[i] = adResponse{
-			ID:          ad[i].ID,
-			Title:       ad[i].Title,
-			Text:        ad[i].Text,
-			AuthorID:    ad[i].AuthorID,
-			Published:   ad[i].Published,
-			DateCreated: ad[i].DateCreated.Format("2006-01-02 15:04:05"),
-			DateUpdated: ad[i].DateUpdated.Format("2006-01-02 15:04:05"),
+		resp[i] = toAdResponse(ad[i])
+	}
+	return gin.H{
+		"data":  resp,
+		"total": total,
+		"error": nil,
+	}
+}
+
+func toImageResponse(img *ads.Image) imageResponse {
+	return imageResponse{
+		ID:          img.ID,
+		URL:         img.URL,
+		ContentType: img.ContentType,
+		Size:        img.Size,
+		Position:    img.Position,
+	}
+}
+
+func ImageSuccessResponse(img *ads.Image) gin.H {
+	return gin.H{
+		"data":  toImageResponse(img),
+		"error": nil,
+	}
+}
+
+func ImageListSuccessResponse(images []*ads.Image) gin.H {
+	resp := make([]imageResponse, len(images))
+	for i, img := range images {
+		resp[i] = toImageResponse(img)
+	}
+	return gin.H{
+		"data":  resp,
+		"error": nil,
+	}
+}
+
+func toThreadResponse(t *ads.Thread) threadResponse {
+	return threadResponse{
+		ID:          t.ID,
+		AdID:        t.AdID,
+		BuyerID:     t.BuyerID,
+		SellerID:    t.SellerID,
+		Unread:      t.Unread,
+		DateCreated: t.DateCreated.Format("2006-01-02 15:04:05"),
+		DateUpdated: t.DateUpdated.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func ThreadSuccessResponse(t *ads.Thread) gin.H {
+	return gin.H{
+		"data":  toThreadResponse(t),
+		"error": nil,
+	}
+}
+
+func ThreadListSuccessResponse(threads []*ads.Thread, total int64) gin.H {
+	resp := make([]threadResponse, len(threads))
+	for i, t := range threads {
+		resp[i] = toThreadResponse(t)
+	}
+	return gin.H{
+		"data":  resp,
+		"total": total,
+		"error": nil,
+	}
+}
+
+func toMessageResponse(msg *ads.Message) messageResponse {
+	resp := messageResponse{
+		ID:          msg.ID,
+		ThreadID:    msg.ThreadID,
+		SenderID:    msg.SenderID,
+		Text:        msg.Text,
+		DateCreated: msg.DateCreated.Format("2006-01-02 15:04:05"),
+	}
+	if msg.ReadAt != nil {
+		readAt := msg.ReadAt.Format("2006-01-02 15:04:05")
+		resp.ReadAt = &readAt
+	}
+	return resp
+}
+
+func MessageSuccessResponse(msg *ads.Message) gin.H {
+	return gin.H{
+		"data":  toMessageResponse(msg),
+		"error": nil,
+	}
+}
+
+func MessageListSuccessResponse(msgs []*ads.Message, total int64) gin.H {
+	resp := make([]messageResponse, len(msgs))
+	for i, msg := range msgs {
+		resp[i] = toMessageResponse(msg)
+	}
+	return gin.H{
+		"data":  resp,
+		"total": total,
+		"error": nil,
+	}
+}
+
+func toReportResponse(rep *ads.Report) reportResponse {
+	resp := reportResponse{
+		ID:          rep.ID,
+		AdID:        rep.AdID,
+		ReporterID:  rep.ReporterID,
+		Reason:      string(rep.Reason),
+		Comment:     rep.Comment,
+		Status:      string(rep.Status),
+		Resolution:  string(rep.Resolution),
+		ResolvedBy:  rep.ResolvedBy,
+		DateCreated: rep.DateCreated.Format("2006-01-02 15:04:05"),
+	}
+	if rep.ResolvedAt != nil {
+		resolvedAt := rep.ResolvedAt.Format("2006-01-02 15:04:05")
+		resp.ResolvedAt = &resolvedAt
+	}
+	return resp
+}
+
+func toAPIKeyResponse(key *ads.APIKey) apiKeyResponse {
+	resp := apiKeyResponse{
+		ID:          key.ID,
+		Name:        key.Name,
+		Prefix:      key.Prefix,
+		Scope:       string(key.Scope),
+		DateCreated: key.DateCreated.Format("2006-01-02 15:04:05"),
+	}
+	if key.LastUsedAt != nil {
+		lastUsedAt := key.LastUsedAt.Format("2006-01-02 15:04:05")
+		resp.LastUsedAt = &lastUsedAt
+	}
+	if key.RevokedAt != nil {
+		revokedAt := key.RevokedAt.Format("2006-01-02 15:04:05")
+		resp.RevokedAt = &revokedAt
+	}
+	return resp
+}
+
+func NewAPIKeySuccessResponse(key *ads.APIKey, secret string) gin.H {
+	resp := toAPIKeyResponse(key)
+	resp.Key = secret
+	return gin.H{
+		"data":  resp,
+		"error": nil,
+	}
+}
+
+func APIKeyListSuccessResponse(keys []*ads.APIKey) gin.H {
+	resp := make([]apiKeyResponse, len(keys))
+	for i, key := range keys {
+		resp[i] = toAPIKeyResponse(key)
+	}
+	return gin.H{
+		"data":  resp,
+		"error": nil,
+	}
+}
+
+func ReportSuccessResponse(rep *ads.Report) gin.H {
+	return gin.H{
+		"data":  toReportResponse(rep),
+		"error": nil,
+	}
+}
+
+func ReportListSuccessResponse(reports []*ads.Report) gin.H {
+	resp := make([]reportResponse, len(reports))
+	for i, rep := range reports {
+		resp[i] = toReportResponse(rep)
+	}
+	return gin.H{
+		"data":  resp,
+		"error": nil,
+	}
+}
+
+func ReportGroupListSuccessResponse(groups []*ads.ReportGroup, total int64) gin.H {
+	resp := make([]reportGroupResponse, len(groups))
+	for i, group := range groups {
+		reports := make([]reportResponse, len(group.Reports))
+		for j := range group.Reports {
+			reports[j] = toReportResponse(&group.Reports[j])
+		}
+		resp[i] = reportGroupResponse{AdID: group.AdID, Reports: reports}
+	}
+	return gin.H{
+		"data":  resp,
+		"total": total,
+		"error": nil,
+	}
+}
+
+func NotificationListSuccessResponse(notices []*ads.Notification, total int64) gin.H {
+	resp := make([]notificationResponse, len(notices))
+	for i, n := range notices {
+		resp[i] = notificationResponse{ID: n.ID, Text: n.Text, DateCreated: n.DateCreated.Format("2006-01-02 15:04:05")}
+	}
+	return gin.H{
+		"data":  resp,
+		"total": total,
+		"error": nil,
+	}
+}
+
+func toCategoryResponse(cat *ads.Category) categoryResponse {
+	return categoryResponse{
+		ID:          cat.ID,
+		ParentID:    cat.ParentID,
+		Name:        cat.Name,
+		DateCreated: cat.DateCreated.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func CategorySuccessResponse(cat *ads.Category) gin.H {
+	return gin.H{
+		"data":  toCategoryResponse(cat),
+		"error": nil,
+	}
+}
+
+func CategoryListSuccessResponse(cats []*ads.Category) gin.H {
+	resp := make([]categoryResponse, len(cats))
+	for i, cat := range cats {
+		resp[i] = toCategoryResponse(cat)
+	}
+	return gin.H{
+		"data":  resp,
+		"error": nil,
+	}
+}
+
+func RevisionListSuccessResponse(revs []*ads.Revision) gin.H {
+	resp := make([]revisionResponse, len(revs))
+	for i, rev := range revs {
+		resp[i] = revisionResponse{
+			ID:           rev.ID,
+			AdID:         rev.AdID,
+			ActorID:      rev.ActorID,
+			OldTitle:     rev.OldTitle,
+			NewTitle:     rev.NewTitle,
+			OldText:      rev.OldText,
+			NewText:      rev.NewText,
+			OldPublished: rev.OldPublished,
+			NewPublished: rev.NewPublished,
+			OldStatus:    string(rev.OldStatus),
+			NewStatus:    string(rev.NewStatus),
+			DateCreated:  rev.DateCreated.Format("2006-01-02 15:04:05"),
 		}
 	}
 	return gin.H{
@@ -95,3 +613,12 @@ func ErrorResponse(err error) gin.H {
 		"error": err.Error(),
 	}
 }
+
+// ValidationErrorResponse adds the violated rules of every field to the error.
+func ValidationErrorResponse(err *app.ValidationError) gin.H {
+	return gin.H{
+		"data":    nil,
+		"error":   err.Error(),
+		"details": err.Violations,
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"go.uber.org/zap"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"homework9/internal/ads"
 	"homework9/internal/app"
 )
 
@@ -21,12 +23,100 @@ func ServiceRecovery(logger *zap.Logger) gin.HandlerFunc {
 	}
 }
 
+// Authenticate marks the request as made by the user of the bearer token or
+// the API key in the Authorization header. Requests without the header pass as anonymous.
+func Authenticate(a app.App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+		ctx, err := authenticate(c, a, header)
+		if err != nil {
+			HandleError(c, err)
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func authenticate(c *gin.Context, a app.App, header string) (context.Context, error) {
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		id, err := a.Authenticate(c, token)
+		if err != nil {
+			return nil, err
+		}
+		return app.ContextWithUser(c.Request.Context(), id), nil
+	}
+	if secret, ok := strings.CutPrefix(header, "ApiKey "); ok {
+		key, err := a.AuthenticateAPIKey(c, secret)
+		if err != nil {
+			return nil, err
+		}
+		ctx := app.ContextWithAPIKey(c.Request.Context(), key)
+		if err := app.CheckScope(ctx, routeScope(c)); err != nil {
+			return nil, err
+		}
+		return ctx, nil
+	}
+	return nil, app.ErrInvalidToken
+}
+
+// adWriteRoutes are the changes of ads allowed to API keys with the ads:write scope.
+// Other requests that change anything cannot be made with an API key.
+var adWriteRoutes = map[string]bool{
+	"POST /api/v1/ads":                                true,
+	"PUT /api/v1/ads/:id":                             true,
+	"PUT /api/v1/ads/:id/status":                      true,
+	"PUT /api/v1/ads/:id/schedule":                    true,
+	"POST /api/v1/ads/:id/submit":                     true,
+	"DELETE /api/v1/ads/:id/del":                      true,
+	"PUT /api/v1/ads/:id/restore":                     true,
+	"POST /api/v1/ads/:id/revisions/:rev_id/rollback": true,
+	"POST /api/v1/ads/:id/images":                     true,
+	"PUT /api/v1/ads/:id/images/order":                true,
+	"DELETE /api/v1/ads/:id/images/:image_id":         true,
+}
+
+// routeScope returns the scope an API key needs for the request, or an empty one if no key may make it.
+func routeScope(c *gin.Context) ads.APIKeyScope {
+	if c.Request.Method == http.MethodGet {
+		return ads.ScopeRead
+	}
+	if adWriteRoutes[c.Request.Method+" "+c.FullPath()] {
+		return ads.ScopeAdsWrite
+	}
+	return ""
+}
+
 func NewHTTPServer(ctx context.Context, port string, a app.App) *http.Server {
 	gin.SetMode(gin.ReleaseMode)
 	handler := gin.New()
+	// Handlers pass *gin.Context to the app, so it has to be canceled
+	// together with the request when the client goes away.
+	handler.ContextWithFallback = true
 	s := &http.Server{Addr: port, Handler: handler}
 
-	handler.Use(ServiceRecovery(ctx.Value("logger").(*zap.Logger)))
+	handler.Use(ServiceRecovery(ctx.Value("logger").(*zap.Logger)), Authenticate(a))
+	handler.POST("/api/v1/auth/register", func(c *gin.Context) {
+		Register(c, a)
+	})
+
+	handler.POST("/api/v1/auth/login", func(c *gin.Context) {
+		Login(c, a)
+	})
+
+	handler.POST("/api/v1/auth/refresh", func(c *gin.Context) {
+		RefreshToken(c, a)
+	})
+
+	handler.POST("/api/v1/auth/logout", func(c *gin.Context) {
+		Logout(c, a)
+	})
+
 	handler.POST("/api/v1/ads", func(c *gin.Context) {
 		CreateAd(c, a)
 	})
@@ -35,6 +125,38 @@ func NewHTTPServer(ctx context.Context, port string, a app.App) *http.Server {
 		ChangeAdStatus(c, a)
 	})
 
+	handler.POST("/api/v1/ads/:id/submit", func(c *gin.Context) {
+		SubmitAd(c, a)
+	})
+
+	handler.POST("/api/v1/ads/:id/approve", func(c *gin.Context) {
+		ApproveAd(c, a)
+	})
+
+	handler.POST("/api/v1/ads/:id/reject", func(c *gin.Context) {
+		RejectAd(c, a)
+	})
+
+	handler.GET("/api/v1/moderation/queue", func(c *gin.Context) {
+		ListModerationQueue(c, a)
+	})
+
+	handler.POST("/api/v1/ads/:id/reports", func(c *gin.Context) {
+		ReportAd(c, a)
+	})
+
+	handler.POST("/api/v1/ads/:id/reports/resolve", func(c *gin.Context) {
+		ResolveReports(c, a)
+	})
+
+	handler.GET("/api/v1/reports", func(c *gin.Context) {
+		ListReports(c, a)
+	})
+
+	handler.PUT("/api/v1/ads/:id/schedule", func(c *gin.Context) {
+		ScheduleAd(c, a)
+	})
+
 	handler.PUT("/api/v1/ads/:id", func(c *gin.Context) {
 		UpdateAd(c, a)
 	})
@@ -51,16 +173,136 @@ func NewHTTPServer(ctx context.Context, port string, a app.App) *http.Server {
 		DeleteAd(c, a)
 	})
 
+	handler.PUT("/api/v1/ads/:id/restore", func(c *gin.Context) {
+		RestoreAd(c, a)
+	})
+
+	handler.GET("/api/v1/ads/:id/revisions", func(c *gin.Context) {
+		ListAdRevisions(c, a)
+	})
+
+	handler.POST("/api/v1/ads/:id/revisions/:rev_id/rollback", func(c *gin.Context) {
+		RollbackAd(c, a)
+	})
+
+	handler.POST("/api/v1/ads/:id/images", func(c *gin.Context) {
+		AddAdImage(c, a)
+	})
+
+	handler.PUT("/api/v1/ads/:id/images/order", func(c *gin.Context) {
+		ReorderAdImages(c, a)
+	})
+
+	handler.DELETE("/api/v1/ads/:id/images/:image_id", func(c *gin.Context) {
+		DeleteAdImage(c, a)
+	})
+
+	handler.GET("/api/v1/images/*key", func(c *gin.Context) {
+		GetImage(c, a)
+	})
+
+	handler.POST("/api/v1/ads/:id/messages", func(c *gin.Context) {
+		SendAdMessage(c, a)
+	})
+
+	handler.POST("/api/v1/threads/:id/messages", func(c *gin.Context) {
+		SendMessage(c, a)
+	})
+
+	handler.GET("/api/v1/threads/:id/messages", func(c *gin.Context) {
+		ListMessages(c, a)
+	})
+
+	handler.POST("/api/v1/threads/:id/read", func(c *gin.Context) {
+		MarkThreadRead(c, a)
+	})
+
+	handler.GET("/api/v1/categories", func(c *gin.Context) {
+		ListCategories(c, a)
+	})
+
+	handler.GET("/api/v1/categories/:id", func(c *gin.Context) {
+		GetCategory(c, a)
+	})
+
+	handler.POST("/api/v1/categories", func(c *gin.Context) {
+		CreateCategory(c, a)
+	})
+
+	handler.PUT("/api/v1/categories/:id", func(c *gin.Context) {
+		UpdateCategory(c, a)
+	})
+
+	handler.DELETE("/api/v1/categories/:id", func(c *gin.Context) {
+		DeleteCategory(c, a)
+	})
+
 	handler.POST("/api/v1/users", func(c *gin.Context) {
 		CreateUser(c, a)
 	})
 
+	handler.GET("/api/v1/users", func(c *gin.Context) {
+		ListUsers(c, a)
+	})
+
 	handler.GET("/api/v1/users/:id", func(c *gin.Context) {
 		GetUser(c, a)
 	})
 
+	handler.PUT("/api/v1/users/:id", func(c *gin.Context) {
+		UpdateUser(c, a)
+	})
+
+	handler.PATCH("/api/v1/users/:id", func(c *gin.Context) {
+		UpdateUser(c, a)
+	})
+
+	handler.GET("/api/v1/users/:id/threads", func(c *gin.Context) {
+		ListThreads(c, a)
+	})
+
+	handler.GET("/api/v1/users/:id/unread", func(c *gin.Context) {
+		GetUnreadCount(c, a)
+	})
+
+	handler.GET("/api/v1/users/:id/notifications", func(c *gin.Context) {
+		ListNotifications(c, a)
+	})
+
+	handler.GET("/api/v1/users/:id/favorites", func(c *gin.Context) {
+		ListFavorites(c, a)
+	})
+
+	handler.POST("/api/v1/users/:id/favorites/:ad_id", func(c *gin.Context) {
+		AddFavorite(c, a)
+	})
+
+	handler.DELETE("/api/v1/users/:id/favorites/:ad_id", func(c *gin.Context) {
+		RemoveFavorite(c, a)
+	})
+
+	handler.POST("/api/v1/users/:id/api-keys", func(c *gin.Context) {
+		CreateAPIKey(c, a)
+	})
+
+	handler.GET("/api/v1/users/:id/api-keys", func(c *gin.Context) {
+		ListAPIKeys(c, a)
+	})
+
+	handler.DELETE("/api/v1/users/:id/api-keys/:key_id", func(c *gin.Context) {
+		RevokeAPIKey(c, a)
+	})
+
 	handler.DELETE("/api/v1/users/:id/del", func(c *gin.Context) {
 		DeleteUser(c, a)
 	})
+
+	handler.PUT("/api/v1/users/:id/restore", func(c *gin.Context) {
+		RestoreUser(c, a)
+	})
+
+	handler.PUT("/api/v1/users/:id/role", func(c *gin.Context) {
+		SetUserRole(c, a)
+	})
 	return s
 }
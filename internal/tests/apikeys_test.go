@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestAPIKeys(t *testing.T) {
+	client := getTestClient()
+	oleg, asOleg := client.signUp(t, "oleg@example.com")
+
+	created, err := asOleg.createAPIKey(oleg, " ci ", "ads:write")
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", created.Data.Name)
+	assert.Equal(t, "ads:write", created.Data.Scope)
+	assert.True(t, strings.HasPrefix(created.Data.Key, created.Data.Prefix))
+	assert.Nil(t, created.Data.LastUsedAt)
+
+	asCI := client.withAPIKey(created.Data.Key)
+	ad, err := asCI.createAd(0, "bike", "red")
+	assert.NoError(t, err)
+	assert.Equal(t, oleg, ad.Data.AuthorID)
+	_, err = asCI.updateAd(0, ad.Data.ID, "bike", "blue")
+	assert.NoError(t, err)
+
+	keys, err := asOleg.listAPIKeys(oleg)
+	assert.NoError(t, err)
+	assert.Len(t, keys.Data, 1)
+	assert.Empty(t, keys.Data[0].Key)
+	assert.NotNil(t, keys.Data[0].LastUsedAt)
+	assert.Nil(t, keys.Data[0].RevokedAt)
+
+	// The ads:write scope covers ads only, and keys cannot manage keys.
+	_, err = asCI.addFavorite(oleg, ad.Data.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = asCI.createAPIKey(oleg, "another", "read")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	assert.NoError(t, asOleg.revokeAPIKey(oleg, created.Data.ID))
+	_, err = asCI.getAd(ad.Data.ID)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	keys, err = asOleg.listAPIKeys(oleg)
+	assert.NoError(t, err)
+	assert.NotNil(t, keys.Data[0].RevokedAt)
+}
+
+func TestAPIKeys_ReadOnly(t *testing.T) {
+	client := getTestClient()
+	oleg, asOleg := client.signUp(t, "oleg@example.com")
+	ad, err := asOleg.createAd(0, "bike", "red")
+	assert.NoError(t, err)
+
+	created, err := asOleg.createAPIKey(oleg, "reports", "read")
+	assert.NoError(t, err)
+	asReader := client.withAPIKey(created.Data.Key)
+
+	_, err = asReader.getAd(ad.Data.ID)
+	assert.NoError(t, err)
+	_, err = asReader.listFavorites(oleg)
+	assert.NoError(t, err)
+
+	_, err = asReader.createAd(0, "car", "blue")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = asReader.changeAdStatus(0, ad.Data.ID, true)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestAPIKeys_Errors(t *testing.T) {
+	client := getTestClient()
+	oleg, asOleg := client.signUp(t, "oleg@example.com")
+	anna, asAnna := client.signUp(t, "anna@example.com")
+
+	_, err := asOleg.createAPIKey(oleg, "ci", "admin")
+	assert.ErrorIs(t, err, ErrBadRequest)
+	_, err = asOleg.createAPIKey(oleg, "", "read")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	created, err := asOleg.createAPIKey(oleg, "ci", "read")
+	assert.NoError(t, err)
+
+	_, err = asAnna.listAPIKeys(oleg)
+	assert.ErrorIs(t, err, ErrForbidden)
+	err = asAnna.revokeAPIKey(anna, created.Data.ID)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.withAPIKey("ak_unknown").listAds()
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	// Deleting the user revokes its keys.
+	assert.NoError(t, asOleg.deleteUser(oleg))
+	_, err = client.withAPIKey(created.Data.Key).listAds()
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestGRPCAPIKeys(t *testing.T) {
+	client, ctx := getTestGRPCClient(t)
+	user, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+
+	writer, err := client.CreateAPIKey(userCtx, &grpcPort.CreateAPIKeyRequest{UserId: user.Id, Name: "ci", Scope: "ads:write"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, writer.Key)
+	reader, err := client.CreateAPIKey(userCtx, &grpcPort.CreateAPIKeyRequest{UserId: user.Id, Name: "stats", Scope: "read"})
+	assert.NoError(t, err)
+
+	writerCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "ApiKey "+writer.Key)
+	ad, err := client.CreateAd(writerCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.NoError(t, err)
+	assert.Equal(t, user.Id, ad.AuthorId)
+
+	_, err = client.CreateAPIKey(writerCtx, &grpcPort.CreateAPIKeyRequest{UserId: user.Id, Name: "more", Scope: "read"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	readerCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "ApiKey "+reader.Key)
+	_, err = client.ListAds(readerCtx, &grpcPort.ListAdsRequest{})
+	assert.NoError(t, err)
+	_, err = client.CreateAd(readerCtx, &grpcPort.CreateAdRequest{Title: "car", Text: "blue"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	keys, err := client.ListAPIKeys(userCtx, &grpcPort.ListAPIKeysRequest{UserId: user.Id})
+	assert.NoError(t, err)
+	assert.Len(t, keys.List, 2)
+	assert.NotEmpty(t, keys.List[0].LastUsedAt)
+
+	_, err = client.RevokeAPIKey(userCtx, &grpcPort.RevokeAPIKeyRequest{UserId: user.Id, KeyId: writer.Id})
+	assert.NoError(t, err)
+	_, err = client.ListAds(writerCtx, &grpcPort.ListAdsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
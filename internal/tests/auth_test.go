@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestAuth_Register(t *testing.T) {
+	client := getTestClient()
+
+	user, err := client.register(" Oleg ", "Oleg@Example.com", "password1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Oleg", user.Data.Name)
+	assert.Equal(t, "oleg@example.com", user.Data.Email)
+
+	_, err = client.register("Oleg", "OLEG@example.com", "password2")
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = client.register("Anna", "anna", "password1")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.register("Anna", "anna@example.com", "short")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.register("", "anna@example.com", "password1")
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestAuth_Login(t *testing.T) {
+	client := getTestClient()
+	_, err := client.register("Oleg", "oleg@example.com", "password1")
+	assert.NoError(t, err)
+
+	tokens, err := client.login("OLEG@example.com", "password1")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.Data.AccessToken)
+	assert.NotEmpty(t, tokens.Data.RefreshToken)
+	assert.Equal(t, "Bearer", tokens.Data.TokenType)
+
+	_, err = client.login("oleg@example.com", "password2")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	_, err = client.login("anna@example.com", "password1")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestAuth_ActorFromToken(t *testing.T) {
+	client := getTestClient()
+	oleg, asOleg := client.signUp(t, "oleg@example.com")
+	anna := client.newUser(t)
+
+	// The user id in the body is ignored: the ad belongs to the token owner.
+	var ad adResponse
+	err := asOleg.postJSON("/api/v1/ads", map[string]any{"user_id": anna, "title": "bike", "text": "red"}, &ad)
+	assert.NoError(t, err)
+	assert.Equal(t, oleg, ad.Data.AuthorID)
+
+	_, err = asOleg.listFavorites(anna)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	err = asOleg.deleteUser(anna)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = client.withToken("not a token").createAd(oleg, "car", "blue")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestAuth_Required(t *testing.T) {
+	client := getTestClient()
+	oleg := client.newUser(t)
+
+	var ad adResponse
+	err := client.postJSON("/api/v1/ads", map[string]any{"user_id": oleg, "title": "bike", "text": "red"}, &ad)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	_, err = client.createAd(anonymous, "bike", "red")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	ad, err = client.createAd(oleg, "bike", "red")
+	assert.NoError(t, err)
+	assert.Equal(t, oleg, ad.Data.AuthorID)
+
+	// Reading public data needs no token.
+	_, err = client.as(anonymous).getAd(ad.Data.ID)
+	assert.NoError(t, err)
+}
+
+func TestAuth_Refresh(t *testing.T) {
+	client := getTestClient()
+	_, err := client.register("Oleg", "oleg@example.com", "password1")
+	assert.NoError(t, err)
+	tokens, err := client.login("oleg@example.com", "password1")
+	assert.NoError(t, err)
+
+	_, err = client.refreshTokens(tokens.Data.AccessToken)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	renewed, err := client.refreshTokens(tokens.Data.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, tokens.Data.RefreshToken, renewed.Data.RefreshToken)
+
+	// A refresh token is used once.
+	_, err = client.refreshTokens(tokens.Data.RefreshToken)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	assert.NoError(t, client.logout(renewed.Data.RefreshToken))
+	_, err = client.refreshTokens(renewed.Data.RefreshToken)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestAuth_DeletedUser(t *testing.T) {
+	client := getTestClient()
+	user, err := client.register("Oleg", "oleg@example.com", "password1")
+	assert.NoError(t, err)
+	tokens, err := client.login("oleg@example.com", "password1")
+	assert.NoError(t, err)
+
+	err = client.withToken(tokens.Data.AccessToken).deleteUser(user.Data.ID)
+	assert.NoError(t, err)
+
+	_, err = client.refreshTokens(tokens.Data.RefreshToken)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	// The access token stops working before it expires.
+	_, err = client.withToken(tokens.Data.AccessToken).createAd(user.Data.ID, "bike", "red")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	_, err = client.withToken(tokens.Data.AccessToken).restoreUserAs(user.Data.ID, user.Data.ID)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestGRPCAuth(t *testing.T) {
+	client, ctx := newTestGRPCClient(t, app.NewApp(adrepo.New()))
+	user, err := client.Register(ctx, &grpcPort.RegisterRequest{Name: "Oleg", Email: "oleg@example.com", Password: "password1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "oleg@example.com", user.Email)
+
+	_, err = client.Login(ctx, &grpcPort.LoginRequest{Email: "oleg@example.com", Password: "wrong password"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	tokens, err := client.Login(ctx, &grpcPort.LoginRequest{Email: "oleg@example.com", Password: "password1"})
+	assert.NoError(t, err)
+
+	_, err = client.CreateAd(ctx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+tokens.AccessToken)
+	ad, err := client.CreateAd(authCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.NoError(t, err)
+	assert.Equal(t, user.Id, ad.AuthorId)
+
+	_, err = client.ListFavorites(authCtx, &grpcPort.ListFavoritesRequest{UserId: user.Id + 1})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	badCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+tokens.RefreshToken)
+	_, err = client.CreateAd(badCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	renewed, err := client.RefreshToken(ctx, &grpcPort.RefreshTokenRequest{RefreshToken: tokens.RefreshToken})
+	assert.NoError(t, err)
+	_, err = client.Logout(ctx, &grpcPort.RefreshTokenRequest{RefreshToken: renewed.RefreshToken})
+	assert.NoError(t, err)
+	_, err = client.RefreshToken(ctx, &grpcPort.RefreshTokenRequest{RefreshToken: renewed.RefreshToken})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
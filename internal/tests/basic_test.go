@@ -8,42 +8,45 @@ import (
 
 func TestCreateAd(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
-	response, err := client.createAd(123, "hello", "world")
+	response, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 	assert.Zero(t, response.Data.ID)
 	assert.Equal(t, response.Data.Title, "hello")
 	assert.Equal(t, response.Data.Text, "world")
-	assert.Equal(t, response.Data.AuthorID, int64(123))
+	assert.Equal(t, response.Data.AuthorID, author)
 	assert.False(t, response.Data.Published)
 }
 
 func TestChangeAdStatus(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
-	response, err := client.createAd(123, "hello", "world")
+	response, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 
-	response, err = client.changeAdStatus(123, response.Data.ID, true)
+	response, err = client.changeAdStatus(author, response.Data.ID, true)
 	assert.NoError(t, err)
 	assert.True(t, response.Data.Published)
 
-	response, err = client.changeAdStatus(123, response.Data.ID, false)
+	response, err = client.changeAdStatus(author, response.Data.ID, false)
 	assert.NoError(t, err)
 	assert.False(t, response.Data.Published)
 
-	response, err = client.changeAdStatus(123, response.Data.ID, false)
+	response, err = client.changeAdStatus(author, response.Data.ID, false)
 	assert.NoError(t, err)
 	assert.False(t, response.Data.Published)
 }
 
 func TestUpdateAd(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
-	response, err := client.createAd(123, "hello", "world")
+	response, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 
-	response, err = client.updateAd(123, response.Data.ID, "привет", "мир")
+	response, err = client.updateAd(author, response.Data.ID, "привет", "мир")
 	assert.NoError(t, err)
 	assert.Equal(t, response.Data.Title, "привет")
 	assert.Equal(t, response.Data.Text, "мир")
@@ -51,14 +54,15 @@ func TestUpdateAd(t *testing.T) {
 
 func TestListAds(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
-	response, err := client.createAd(123, "hello", "world")
+	response, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 
-	publishedAd, err := client.changeAdStatus(123, response.Data.ID, true)
+	publishedAd, err := client.changeAdStatus(author, response.Data.ID, true)
 	assert.NoError(t, err)
 
-	_, err = client.createAd(123, "best cat", "not for sale")
+	_, err = client.createAd(author, "best cat", "not for sale")
 	assert.NoError(t, err)
 
 	ads, err := client.listAds()
@@ -70,3 +74,25 @@ func TestListAds(t *testing.T) {
 	assert.Equal(t, ads.Data[0].AuthorID, publishedAd.Data.AuthorID)
 	assert.True(t, ads.Data[0].Published)
 }
+
+func TestListAds_Pagination(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	for i := 0; i < 5; i++ {
+		response, err := client.createAd(author, "hello", "world")
+		assert.NoError(t, err)
+		_, err = client.changeAdStatus(author, response.Data.ID, true)
+		assert.NoError(t, err)
+	}
+
+	err := client.deleteAd(author, 1)
+	assert.NoError(t, err)
+
+	ads, err := client.listAdsQuery("limit=2&offset=1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), ads.Total)
+	assert.Len(t, ads.Data, 2)
+	assert.Equal(t, int64(2), ads.Data[0].ID)
+	assert.Equal(t, int64(3), ads.Data[1].ID)
+}
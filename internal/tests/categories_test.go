@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestCategories_CRUD(t *testing.T) {
+	client := getTestClient()
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	root, err := client.createCategory(admin, "Транспорт", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, root.Data.ParentID)
+
+	child, err := client.createCategory(admin, "Велосипеды", &root.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, root.Data.ID, *child.Data.ParentID)
+
+	renamed, err := client.updateCategory(admin, child.Data.ID, "Самокаты", &root.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Самокаты", renamed.Data.Name)
+
+	list, err := client.listCategories()
+	assert.NoError(t, err)
+	assert.Len(t, list.Data, 2)
+
+	// A category with subcategories cannot be deleted.
+	assert.ErrorIs(t, client.deleteCategory(admin, root.Data.ID), ErrConflict)
+	assert.NoError(t, client.deleteCategory(admin, child.Data.ID))
+	assert.NoError(t, client.deleteCategory(admin, root.Data.ID))
+
+	list, err = client.listCategories()
+	assert.NoError(t, err)
+	assert.Len(t, list.Data, 0)
+}
+
+func TestCategories_Errors(t *testing.T) {
+	client := getTestClient()
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	root, err := client.createCategory(admin, "Транспорт", nil)
+	assert.NoError(t, err)
+	child, err := client.createCategory(admin, "Велосипеды", &root.Data.ID)
+	assert.NoError(t, err)
+
+	_, err = client.createCategory(admin, "", nil)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.createCategory(admin, "транспорт", nil)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	unknown := int64(100)
+	_, err = client.createCategory(admin, "Мотоциклы", &unknown)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	// Moving a category under its own subcategory would make a cycle.
+	_, err = client.updateCategory(admin, root.Data.ID, "Транспорт", &child.Data.ID)
+	assert.ErrorIs(t, err, ErrBadRequest)
+	_, err = client.updateCategory(admin, root.Data.ID, "Транспорт", &root.Data.ID)
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestCreateAd_CategoryAndTags(t *testing.T) {
+	client := getTestClient()
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+	author := client.newUser(t)
+
+	cat, err := client.createCategory(admin, "Велосипеды", nil)
+	assert.NoError(t, err)
+
+	resp, err := client.createAdWith(author, "hello", "world", map[string]any{
+		"category_id": cat.Data.ID,
+		"tags":        []string{" Red", "bmx", "red", ""},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, cat.Data.ID, *resp.Data.CategoryID)
+	assert.Equal(t, []string{"bmx", "red"}, resp.Data.Tags)
+
+	unknown := cat.Data.ID + 1
+	_, err = client.createAdWith(author, "hello", "world", map[string]any{"category_id": unknown})
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	// A category in use cannot be deleted.
+	assert.ErrorIs(t, client.deleteCategory(admin, cat.Data.ID), ErrConflict)
+
+	// Update replaces the category and the tags.
+	updated, err := client.updateAd(author, resp.Data.ID, "hello", "world")
+	assert.NoError(t, err)
+	assert.Nil(t, updated.Data.CategoryID)
+	assert.Equal(t, []string{}, updated.Data.Tags)
+}
+
+func TestCreateAd_TooManyTags(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	tags := make([]string, 11)
+	for i := range tags {
+		tags[i] = fmt.Sprint("tag", i)
+	}
+	_, err := client.createAdWith(author, "hello", "world", map[string]any{"tags": tags})
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestListAds_CategoryAndTags(t *testing.T) {
+	client := getTestClient()
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+	author := client.newUser(t)
+
+	transport, err := client.createCategory(admin, "Транспорт", nil)
+	assert.NoError(t, err)
+	bikes, err := client.createCategory(admin, "Велосипеды", &transport.Data.ID)
+	assert.NoError(t, err)
+	bmx, err := client.createCategory(admin, "BMX", &bikes.Data.ID)
+	assert.NoError(t, err)
+	other, err := client.createCategory(admin, "Одежда", nil)
+	assert.NoError(t, err)
+
+	_, err = client.createAdWith(author, "bike", "red", map[string]any{"category_id": bikes.Data.ID, "tags": []string{"red"}})
+	assert.NoError(t, err)
+	_, err = client.createAdWith(author, "bmx", "red", map[string]any{"category_id": bmx.Data.ID, "tags": []string{"red", "new"}})
+	assert.NoError(t, err)
+	_, err = client.createAdWith(author, "jacket", "red", map[string]any{"category_id": other.Data.ID, "tags": []string{"red"}})
+	assert.NoError(t, err)
+
+	list, err := client.listAdsQuery(fmt.Sprintf("pub=false&category=%d", transport.Data.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), list.Total)
+
+	list, err = client.listAdsQuery(fmt.Sprintf("pub=false&category=%d", bmx.Data.ID))
+	assert.NoError(t, err)
+	assert.Len(t, list.Data, 1)
+	assert.Equal(t, "bmx", list.Data[0].Title)
+
+	list, err = client.listAdsQuery("pub=false&tags=red")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), list.Total)
+
+	list, err = client.listAdsQuery("pub=false&tags=Red,new")
+	assert.NoError(t, err)
+	assert.Len(t, list.Data, 1)
+	assert.Equal(t, "bmx", list.Data[0].Title)
+}
+
+func TestGRPCListAds_Category(t *testing.T) {
+	repo := adrepo.New()
+	client, ctx := newTestGRPCClient(t, app.NewApp(repo))
+
+	_, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	admin, adminCtx := signUpGRPC(t, ctx, client, "anna@example.com")
+	_, err := repo.SetUserRole(ctx, admin.Id, ads.RoleAdmin)
+	assert.NoError(t, err)
+
+	_, err = client.CreateCategory(userCtx, &grpcPort.CreateCategoryRequest{Name: "Транспорт"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	root, err := client.CreateCategory(adminCtx, &grpcPort.CreateCategoryRequest{Name: "Транспорт"})
+	assert.NoError(t, err)
+	child, err := client.CreateCategory(adminCtx, &grpcPort.CreateCategoryRequest{Name: "Велосипеды", ParentId: &root.Id})
+	assert.NoError(t, err)
+
+	ad, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red", CategoryId: &child.Id, Tags: []string{"Red"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"red"}, ad.Tags)
+
+	pub := false
+	list, err := client.ListAds(ctx, &grpcPort.ListAdsRequest{Published: &pub, CategoryId: &root.Id, Tags: []string{"red"}})
+	assert.NoError(t, err)
+	assert.Len(t, list.List, 1)
+
+	_, err = client.DeleteCategory(adminCtx, &grpcPort.DeleteCategoryRequest{Id: child.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+)
+
+func TestDeleteAd_Soft(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, resp.Data.ID, true)
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.deleteAd(author, resp.Data.ID))
+
+	_, err = client.getAd(resp.Data.ID)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.updateAd(author, resp.Data.ID, "title", "text")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	ads, err := client.listAds()
+	assert.NoError(t, err)
+	assert.Len(t, ads.Data, 0)
+}
+
+func TestRestoreAd(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	other := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	assert.NoError(t, client.deleteAd(author, resp.Data.ID))
+
+	_, err = client.restoreAd(other, resp.Data.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	restored, err := client.restoreAd(author, resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.Data.ID, restored.Data.ID)
+
+	got, err := client.getAd(resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", got.Data.Title)
+}
+
+func TestRestoreAd_Admin(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	assert.NoError(t, client.deleteAd(admin, resp.Data.ID))
+
+	_, err = client.restoreAd(moderator, resp.Data.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.restoreAd(anonymous, resp.Data.ID)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	restored, err := client.restoreAd(admin, resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, author, restored.Data.AuthorID)
+}
+
+func TestRestore_NotDeleted(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.restoreAd(author, resp.Data.ID)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = client.restoreUserAs(admin, author)
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = client.restoreUserAs(admin, author+100)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	// The restore of a deleted user is not repeated.
+	assert.NoError(t, client.deleteUser(author))
+	_, err = client.restoreUserAs(admin, author)
+	assert.NoError(t, err)
+	_, err = client.restoreUserAs(admin, author)
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestDeleteUser_DeletesAds(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	other := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	otherAd, err := client.createAd(other, "hello", "world")
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.deleteUser(author))
+
+	_, err = client.getAd(resp.Data.ID)
+	assert.ErrorIs(t, err, ErrBadRequest)
+	_, err = client.getAd(otherAd.Data.ID)
+	assert.NoError(t, err)
+}
+
+func TestDeleteUser_Restrict(t *testing.T) {
+	client := getTestClient(app.WithUserDeletePolicy(app.DeleteUserRestrict))
+	author := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, resp.Data.ID, true)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, client.deleteUser(author), ErrConflict)
+
+	_, err = client.changeAdStatus(author, resp.Data.ID, false)
+	assert.NoError(t, err)
+	assert.NoError(t, client.deleteUser(author))
+}
+
+func TestDeleteUser_Unpublish(t *testing.T) {
+	client := getTestClient(app.WithUserDeletePolicy(app.DeleteUserUnpublish))
+	author := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, resp.Data.ID, true)
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.deleteUser(author))
+
+	got, err := client.getAd(resp.Data.ID)
+	assert.NoError(t, err)
+	assert.False(t, got.Data.Published)
+}
+
+func TestCreateAd_UnknownAuthor(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	_, err := client.createAd(anonymous, "hello", "world")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	// The token of a deleted user is rejected.
+	assert.NoError(t, client.deleteUser(author))
+	_, err = client.createAd(author, "hello", "world")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
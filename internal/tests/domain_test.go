@@ -8,36 +8,41 @@ import (
 
 func TestChangeStatusAdOfAnotherUser(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
+	other := client.newUser(t)
 
-	resp, err := client.createAd(123, "hello", "world")
+	resp, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 
-	_, err = client.changeAdStatus(100, resp.Data.ID, true)
+	_, err = client.changeAdStatus(other, resp.Data.ID, true)
 	assert.ErrorIs(t, err, ErrForbidden)
 }
 
 func TestUpdateAdOfAnotherUser(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
+	other := client.newUser(t)
 
-	resp, err := client.createAd(123, "hello", "world")
+	resp, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 
-	_, err = client.updateAd(100, resp.Data.ID, "title", "text")
+	_, err = client.updateAd(other, resp.Data.ID, "title", "text")
 	assert.ErrorIs(t, err, ErrForbidden)
 }
 
 func TestCreateAd_ID(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
-	resp, err := client.createAd(123, "hello", "world")
+	resp, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 	assert.Equal(t, resp.Data.ID, int64(0))
 
-	resp, err = client.createAd(123, "hello", "world")
+	resp, err = client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 	assert.Equal(t, resp.Data.ID, int64(1))
 
-	resp, err = client.createAd(123, "hello", "world")
+	resp, err = client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 	assert.Equal(t, resp.Data.ID, int64(2))
 }
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestFavorites(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	buyer := client.newUser(t)
+	bike, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	bike, err = client.changeAdStatus(author, bike.Data.ID, true)
+	assert.NoError(t, err)
+	car, err := client.createAd(author, "car", "blue")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, car.Data.ID, true)
+	assert.NoError(t, err)
+
+	resp, err := client.addFavorite(buyer, bike.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), resp.Data.Favorites)
+
+	// Adding the same ad again changes nothing.
+	resp, err = client.addFavorite(buyer, bike.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), resp.Data.Favorites)
+
+	resp, err = client.addFavorite(author, bike.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), resp.Data.Favorites)
+	assert.Equal(t, bike.Data.Version, resp.Data.Version)
+
+	_, err = client.addFavorite(buyer, car.Data.ID)
+	assert.NoError(t, err)
+
+	list, err := client.listFavorites(buyer)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), list.Total)
+	assert.Equal(t, bike.Data.ID, list.Data[0].ID)
+	assert.Equal(t, car.Data.ID, list.Data[1].ID)
+
+	assert.NoError(t, client.removeFavorite(buyer, bike.Data.ID))
+	assert.NoError(t, client.removeFavorite(buyer, bike.Data.ID))
+
+	got, err := client.getAd(bike.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), got.Data.Favorites)
+
+	list, err = client.listFavorites(buyer)
+	assert.NoError(t, err)
+	assert.Len(t, list.Data, 1)
+	assert.Equal(t, car.Data.ID, list.Data[0].ID)
+}
+
+func TestFavorites_Errors(t *testing.T) {
+	client := getTestClient()
+	user := client.newUser(t)
+	ad, err := client.createAd(user, "bike", "red")
+	assert.NoError(t, err)
+
+	_, err = client.addFavorite(user, ad.Data.ID+100)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.as(user).addFavorite(user+100, ad.Data.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = client.listFavorites(anonymous)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestFavorites_Unpublished(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	buyer := client.newUser(t)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+
+	// Drafts of other authors, and own drafts too, are not added.
+	_, err = client.addFavorite(buyer, ad.Data.ID)
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = client.addFavorite(author, ad.Data.ID)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.NoError(t, err)
+	_, err = client.addFavorite(buyer, ad.Data.ID)
+	assert.NoError(t, err)
+
+	// An ad unpublished later is hidden from the favorites until it is published again.
+	_, err = client.changeAdStatus(author, ad.Data.ID, false)
+	assert.NoError(t, err)
+	list, err := client.listFavorites(buyer)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), list.Total)
+	assert.Empty(t, list.Data)
+
+	_, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.NoError(t, err)
+	list, err = client.listFavorites(buyer)
+	assert.NoError(t, err)
+	assert.Len(t, list.Data, 1)
+}
+
+func TestFavorites_Deleted(t *testing.T) {
+	client := getTestClient(app.WithUserDeletePolicy(app.DeleteUserUnpublish))
+	author := client.newUser(t)
+	buyer := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.NoError(t, err)
+	_, err = client.addFavorite(buyer, ad.Data.ID)
+	assert.NoError(t, err)
+
+	// Favorites of a deleted user are not counted.
+	assert.NoError(t, client.deleteUser(buyer))
+	got, err := client.getAd(ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), got.Data.Favorites)
+
+	_, err = client.restoreUserAs(admin, buyer)
+	assert.NoError(t, err)
+	got, err = client.getAd(ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), got.Data.Favorites)
+
+	// A deleted ad disappears from the favorites.
+	assert.NoError(t, client.deleteAd(author, ad.Data.ID))
+	list, err := client.listFavorites(buyer)
+	assert.NoError(t, err)
+	assert.Empty(t, list.Data)
+}
+
+func TestGRPCFavorites(t *testing.T) {
+	client, ctx := getTestGRPCClient(t)
+	user, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	ad, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.NoError(t, err)
+	_, err = client.AddFavorite(userCtx, &grpcPort.FavoriteRequest{UserId: user.Id, AdId: ad.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.ChangeAdStatus(userCtx, &grpcPort.ChangeAdStatusRequest{AdId: ad.Id, Published: true})
+	assert.NoError(t, err)
+
+	res, err := client.AddFavorite(userCtx, &grpcPort.FavoriteRequest{UserId: user.Id, AdId: ad.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), res.Favorites)
+
+	list, err := client.ListFavorites(userCtx, &grpcPort.ListFavoritesRequest{UserId: user.Id})
+	assert.NoError(t, err)
+	assert.Len(t, list.List, 1)
+
+	_, err = client.ListFavorites(ctx, &grpcPort.ListFavoritesRequest{UserId: user.Id})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.RemoveFavorite(userCtx, &grpcPort.FavoriteRequest{UserId: user.Id, AdId: ad.Id})
+	assert.NoError(t, err)
+	list, err = client.ListFavorites(userCtx, &grpcPort.ListFavoritesRequest{UserId: user.Id})
+	assert.NoError(t, err)
+	assert.Empty(t, list.List)
+}
@@ -8,25 +8,33 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 	"homework9/internal/adapters/adrepo"
+	"homework9/internal/ads"
 	"homework9/internal/app"
 	grpcPort "homework9/internal/ports/grpc"
 	ser "homework9/internal/ports/grpc/service"
 )
 
-func TestGRRPCCreateUser(t *testing.T) {
+func getTestGRPCClient(t *testing.T) (grpcPort.AdServiceClient, context.Context) {
+	return newTestGRPCClient(t, app.NewApp(adrepo.New()))
+}
+
+func newTestGRPCClient(t *testing.T, a app.App) (grpcPort.AdServiceClient, context.Context) {
 	lis := bufconn.Listen(1024 * 1024)
 	t.Cleanup(func() {
 		lis.Close()
 	})
 
-	srv := grpc.NewServer()
+	srv := grpc.NewServer(grpc.UnaryInterceptor(ser.AuthInterceptor(a)))
 	t.Cleanup(func() {
 		srv.Stop()
 	})
 
-	svc := ser.NewMyServer(app.NewApp(adrepo.New()))
+	svc := ser.NewMyServer(a)
 	grpcPort.RegisterAdServiceServer(srv, svc)
 
 	go func() {
@@ -49,9 +57,76 @@ func TestGRRPCCreateUser(t *testing.T) {
 		conn.Close()
 	})
 
-	client := grpcPort.NewAdServiceClient(conn)
-	res, err := client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Oleg"})
-	assert.NoError(t, err, "client.GetUser")
+	return grpcPort.NewAdServiceClient(conn), ctx
+}
+
+// signUpGRPC registers a user and logs in, returning the user and a context
+// that authenticates calls as the user.
+func signUpGRPC(t *testing.T, ctx context.Context, client grpcPort.AdServiceClient, email string) (*grpcPort.UserResponse, context.Context) {
+	user, err := client.Register(ctx, &grpcPort.RegisterRequest{Name: "user", Email: email, Password: "password1"})
+	assert.NoError(t, err)
+	tokens, err := client.Login(ctx, &grpcPort.LoginRequest{Email: email, Password: "password1"})
+	assert.NoError(t, err)
+	return user, metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+tokens.AccessToken)
+}
+
+func TestGRRPCCreateUser(t *testing.T) {
+	repo := adrepo.New()
+	client, ctx := newTestGRPCClient(t, app.NewApp(repo))
+	user, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	admin, adminCtx := signUpGRPC(t, ctx, client, "anna@example.com")
+	_, err := repo.SetUserRole(ctx, admin.Id, ads.RoleAdmin)
+	assert.NoError(t, err)
+
+	_, err = client.CreateUser(ctx, &grpcPort.CreateUserRequest{Name: "Ivan"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.CreateUser(userCtx, &grpcPort.CreateUserRequest{Name: "Ivan"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.CreateUser(adminCtx, &grpcPort.CreateUserRequest{Name: " "})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	res, err := client.CreateUser(adminCtx, &grpcPort.CreateUserRequest{Name: "Ivan"})
+	assert.NoError(t, err, "client.CreateUser")
+	assert.Equal(t, "Ivan", res.Name)
+	assert.NotEqual(t, user.Id, res.Id)
+}
+
+func TestGRPCUpdateAd_VersionConflict(t *testing.T) {
+	client, ctx := getTestGRPCClient(t)
+	_, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+
+	ad, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: "hello", Text: "world"})
+	assert.NoError(t, err)
+
+	_, err = client.UpdateAd(userCtx, &grpcPort.UpdateAdRequest{AdId: ad.Id, Title: "a", Text: "b", Version: ad.Version})
+	assert.NoError(t, err)
+
+	_, err = client.UpdateAd(userCtx, &grpcPort.UpdateAdRequest{AdId: ad.Id, Title: "c", Text: "d", Version: ad.Version})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+}
+
+func TestGRPCRollbackAd(t *testing.T) {
+	client, ctx := getTestGRPCClient(t)
+	_, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	_, otherCtx := signUpGRPC(t, ctx, client, "anna@example.com")
+
+	ad, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: "hello", Text: "world"})
+	assert.NoError(t, err)
+	_, err = client.UpdateAd(userCtx, &grpcPort.UpdateAdRequest{AdId: ad.Id, Title: "a", Text: "b"})
+	assert.NoError(t, err)
+
+	revs, err := client.ListAdRevisions(userCtx, &grpcPort.ListAdRevisionsRequest{AdId: ad.Id})
+	assert.NoError(t, err)
+	assert.Len(t, revs.List, 1)
+
+	res, err := client.RollbackAd(userCtx, &grpcPort.RollbackAdRequest{AdId: ad.Id, RevisionId: revs.List[0].Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", res.Title)
+	assert.Equal(t, "world", res.Text)
+
+	_, err = client.ListAdRevisions(otherCtx, &grpcPort.ListAdRevisionsRequest{AdId: ad.Id})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
 
-	assert.Equal(t, "Oleg", res.Name)
+	_, err = client.ListAdRevisions(ctx, &grpcPort.ListAdRevisionsRequest{AdId: ad.Id})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
 }
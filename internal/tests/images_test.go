@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/adapters/blobstore"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func pngImage(t *testing.T) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))))
+	return buf.Bytes()
+}
+
+// getImageTestClient returns a client backed by a local blob store in dir.
+func getImageTestClient(t *testing.T, dir string, opts ...app.Option) *testClient {
+	store, err := blobstore.NewLocal(blobstore.Config{Dir: dir})
+	assert.NoError(t, err)
+	return getTestClient(append(opts, app.WithBlobStore(store))...)
+}
+
+// countFiles returns the number of blobs stored in dir.
+func countFiles(t *testing.T, dir string) int {
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	assert.NoError(t, err)
+	return n
+}
+
+func TestUploadImage(t *testing.T) {
+	client := getImageTestClient(t, t.TempDir())
+	author := client.newUser(t)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	assert.Empty(t, ad.Data.Images)
+
+	data := pngImage(t)
+	img, err := client.uploadImage(author, ad.Data.ID, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", img.Data.ContentType)
+	assert.Equal(t, int64(len(data)), img.Data.Size)
+	assert.True(t, strings.HasPrefix(img.Data.URL, "/api/v1/images/ads/"), img.Data.URL)
+	assert.True(t, strings.HasSuffix(img.Data.URL, ".png"), img.Data.URL)
+
+	got, err := client.getAd(ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, got.Data.Images, 1)
+	assert.Equal(t, img.Data, got.Data.Images[0])
+
+	content, contentType, err := client.download(img.Data.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, data, content)
+	assert.Equal(t, "image/png", contentType)
+}
+
+func TestUploadImage_Rejected(t *testing.T) {
+	dir := t.TempDir()
+	data := pngImage(t)
+	client := getImageTestClient(t, dir, app.WithLimits(app.Limits{MaxImages: 1, MaxImageSize: int64(len(data))}))
+	author := client.newUser(t)
+	other := client.newUser(t)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+
+	_, err = client.uploadImage(author, ad.Data.ID, []byte("<html>not an image</html>"))
+	assert.ErrorIs(t, err, ErrMediaType)
+
+	_, err = client.uploadImage(author, ad.Data.ID, append(data, 0))
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	_, err = client.uploadImage(other, ad.Data.ID, data)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = client.uploadImage(author, ad.Data.ID, data)
+	assert.NoError(t, err)
+
+	_, err = client.uploadImage(author, ad.Data.ID, data)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	// Only the accepted image is left in the store.
+	assert.Equal(t, 1, countFiles(t, dir))
+}
+
+func TestReorderImages(t *testing.T) {
+	client := getImageTestClient(t, t.TempDir())
+	author := client.newUser(t)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		img, err := client.uploadImage(author, ad.Data.ID, pngImage(t))
+		assert.NoError(t, err)
+		assert.Equal(t, i, img.Data.Position)
+		ids = append(ids, img.Data.ID)
+	}
+
+	order := []int64{ids[2], ids[0], ids[1]}
+	images, err := client.reorderImages(author, ad.Data.ID, order)
+	assert.NoError(t, err)
+	assert.Len(t, images.Data, 3)
+	for i, img := range images.Data {
+		assert.Equal(t, order[i], img.ID)
+		assert.Equal(t, i, img.Position)
+	}
+
+	got, err := client.getAd(ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, images.Data, got.Data.Images)
+
+	_, err = client.reorderImages(author, ad.Data.ID, []int64{ids[0], ids[1]})
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.reorderImages(author, ad.Data.ID, []int64{ids[0], ids[0], ids[1]})
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestDeleteImage(t *testing.T) {
+	dir := t.TempDir()
+	client := getImageTestClient(t, dir)
+	author := client.newUser(t)
+	other := client.newUser(t)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	first, err := client.uploadImage(author, ad.Data.ID, pngImage(t))
+	assert.NoError(t, err)
+	second, err := client.uploadImage(author, ad.Data.ID, pngImage(t))
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, client.deleteImage(other, ad.Data.ID, first.Data.ID), ErrForbidden)
+	assert.ErrorIs(t, client.deleteImage(anonymous, ad.Data.ID, first.Data.ID), ErrUnauthorized)
+	assert.NoError(t, client.deleteImage(author, ad.Data.ID, first.Data.ID))
+	assert.ErrorIs(t, client.deleteImage(author, ad.Data.ID, first.Data.ID), ErrBadRequest)
+
+	got, err := client.getAd(ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, got.Data.Images, 1)
+	assert.Equal(t, second.Data.ID, got.Data.Images[0].ID)
+
+	_, _, err = client.download(first.Data.URL)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, 1, countFiles(t, dir))
+}
+
+func TestImages_Admin(t *testing.T) {
+	dir := t.TempDir()
+	client := getImageTestClient(t, dir)
+	author := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	first, err := client.uploadImage(author, ad.Data.ID, pngImage(t))
+	assert.NoError(t, err)
+
+	_, err = client.uploadImage(moderator, ad.Data.ID, pngImage(t))
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.reorderImages(moderator, ad.Data.ID, []int64{first.Data.ID})
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, client.deleteImage(moderator, ad.Data.ID, first.Data.ID), ErrForbidden)
+
+	second, err := client.uploadImage(admin, ad.Data.ID, pngImage(t))
+	assert.NoError(t, err)
+	images, err := client.reorderImages(admin, ad.Data.ID, []int64{second.Data.ID, first.Data.ID})
+	assert.NoError(t, err)
+	assert.Len(t, images.Data, 2)
+	assert.Equal(t, second.Data.ID, images.Data[0].ID)
+	assert.NoError(t, client.deleteImage(admin, ad.Data.ID, first.Data.ID))
+
+	got, err := client.getAd(ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, got.Data.Images, 1)
+	assert.Equal(t, second.Data.ID, got.Data.Images[0].ID)
+	assert.Equal(t, 1, countFiles(t, dir))
+}
+
+func TestDeleteAd_KeepsImages(t *testing.T) {
+	dir := t.TempDir()
+	client := getImageTestClient(t, dir)
+	author := client.newUser(t)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	kept, err := client.createAd(author, "car", "blue")
+	assert.NoError(t, err)
+	for _, id := range []int64{ad.Data.ID, ad.Data.ID, kept.Data.ID} {
+		_, err := client.uploadImage(author, id, pngImage(t))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, countFiles(t, dir))
+
+	assert.NoError(t, client.deleteAd(author, ad.Data.ID))
+	assert.Equal(t, 3, countFiles(t, dir))
+
+	restored, err := client.restoreAd(author, ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, restored.Data.Images, 2)
+	_, _, err = client.download(restored.Data.Images[0].URL)
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.deleteUser(author))
+	assert.Equal(t, 3, countFiles(t, dir))
+}
+
+func TestDownloadImage_InvalidKey(t *testing.T) {
+	client := getImageTestClient(t, t.TempDir())
+
+	_, _, err := client.download("/api/v1/images/ads/1/missing.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, _, err = client.download("/api/v1/images/..%2F..%2Fetc%2Fpasswd")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestGRPCAddAdImage(t *testing.T) {
+	store, err := blobstore.NewLocal(blobstore.Config{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	client, ctx := newTestGRPCClient(t, app.NewApp(adrepo.New(), app.WithBlobStore(store)))
+
+	_, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	ad, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.NoError(t, err)
+
+	first, err := client.AddAdImage(userCtx, &grpcPort.AddAdImageRequest{AdId: ad.Id, Data: pngImage(t)})
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", first.ContentType)
+	second, err := client.AddAdImage(userCtx, &grpcPort.AddAdImageRequest{AdId: ad.Id, Data: pngImage(t)})
+	assert.NoError(t, err)
+
+	_, err = client.AddAdImage(userCtx, &grpcPort.AddAdImageRequest{AdId: ad.Id, Data: []byte("text")})
+	assert.Error(t, err)
+
+	list, err := client.ReorderAdImages(userCtx, &grpcPort.ReorderAdImagesRequest{AdId: ad.Id,
+		ImageIds: []int64{second.Id, first.Id}})
+	assert.NoError(t, err)
+	assert.Equal(t, second.Id, list.List[0].Id)
+
+	_, err = client.DeleteAdImage(userCtx, &grpcPort.DeleteAdImageRequest{AdId: ad.Id, ImageId: second.Id})
+	assert.NoError(t, err)
+
+	res, err := client.ListAds(ctx, &grpcPort.ListAdsRequest{Published: new(bool)})
+	assert.NoError(t, err)
+	assert.Len(t, res.List, 1)
+	assert.Len(t, res.List[0].Images, 1)
+	assert.Equal(t, first.Id, res.List[0].Images[0].Id)
+	assert.Equal(t, first.Url, res.List[0].Images[0].Url)
+}
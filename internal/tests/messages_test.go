@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestMessages(t *testing.T) {
+	client := getTestClient()
+	seller := client.newUser(t)
+	buyer := client.newUser(t)
+	ad, err := client.createAd(seller, "bike", "red")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(seller, ad.Data.ID, true)
+	assert.NoError(t, err)
+
+	first, err := client.sendAdMessage(buyer, ad.Data.ID, "Is it still available?")
+	assert.NoError(t, err)
+	assert.Equal(t, buyer, first.Data.SenderID)
+	assert.Nil(t, first.Data.ReadAt)
+
+	// The second message goes to the same thread.
+	second, err := client.sendAdMessage(buyer, ad.Data.ID, "Can you deliver it?")
+	assert.NoError(t, err)
+	assert.Equal(t, first.Data.ThreadID, second.Data.ThreadID)
+	threadID := first.Data.ThreadID
+
+	threads, err := client.listThreads(seller)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), threads.Total)
+	assert.Equal(t, ad.Data.ID, threads.Data[0].AdID)
+	assert.Equal(t, buyer, threads.Data[0].BuyerID)
+	assert.Equal(t, seller, threads.Data[0].SellerID)
+	assert.Equal(t, int64(2), threads.Data[0].Unread)
+
+	unread, err := client.unreadCount(seller)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), unread)
+	unread, err = client.unreadCount(buyer)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), unread)
+
+	_, err = client.sendMessage(seller, threadID, "Yes, it is")
+	assert.NoError(t, err)
+
+	thread, err := client.markThreadRead(seller, threadID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), thread.Data.Unread)
+	unread, err = client.unreadCount(buyer)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), unread)
+
+	msgs, err := client.listMessages(buyer, threadID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), msgs.Total)
+	assert.Equal(t, "Is it still available?", msgs.Data[0].Text)
+	assert.NotNil(t, msgs.Data[0].ReadAt)
+	assert.Equal(t, "Yes, it is", msgs.Data[2].Text)
+	assert.Nil(t, msgs.Data[2].ReadAt)
+
+	// Messages outlive the publication of the ad.
+	_, err = client.changeAdStatus(seller, ad.Data.ID, false)
+	assert.NoError(t, err)
+	_, err = client.sendMessage(buyer, threadID, "Pity")
+	assert.NoError(t, err)
+	msgs, err = client.listMessages(seller, threadID)
+	assert.NoError(t, err)
+	assert.Len(t, msgs.Data, 4)
+}
+
+func TestMessages_Errors(t *testing.T) {
+	client := getTestClient()
+	seller := client.newUser(t)
+	buyer := client.newUser(t)
+	stranger := client.newUser(t)
+	ad, err := client.createAd(seller, "bike", "red")
+	assert.NoError(t, err)
+
+	_, err = client.sendAdMessage(buyer, ad.Data.ID, "hello")
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = client.changeAdStatus(seller, ad.Data.ID, true)
+	assert.NoError(t, err)
+
+	_, err = client.sendAdMessage(seller, ad.Data.ID, "hello")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.sendAdMessage(buyer, ad.Data.ID, "  ")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	msg, err := client.sendAdMessage(buyer, ad.Data.ID, "hello")
+	assert.NoError(t, err)
+
+	_, err = client.sendMessage(stranger, msg.Data.ThreadID, "hi")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.listMessages(stranger, msg.Data.ThreadID)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.markThreadRead(stranger, msg.Data.ThreadID)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestGRPCMessages(t *testing.T) {
+	client, ctx := getTestGRPCClient(t)
+	seller, sellerCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	buyer, buyerCtx := signUpGRPC(t, ctx, client, "anna@example.com")
+	ad, err := client.CreateAd(sellerCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.NoError(t, err)
+
+	_, err = client.SendAdMessage(buyerCtx, &grpcPort.SendAdMessageRequest{AdId: ad.Id, Text: "hello"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.ChangeAdStatus(sellerCtx, &grpcPort.ChangeAdStatusRequest{AdId: ad.Id, Published: true})
+	assert.NoError(t, err)
+	msg, err := client.SendAdMessage(buyerCtx, &grpcPort.SendAdMessageRequest{AdId: ad.Id, Text: "hello"})
+	assert.NoError(t, err)
+
+	unread, err := client.GetUnreadCount(sellerCtx, &grpcPort.GetUnreadCountRequest{UserId: seller.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), unread.Unread)
+
+	_, err = client.SendMessage(sellerCtx, &grpcPort.SendMessageRequest{ThreadId: msg.ThreadId, Text: "hi"})
+	assert.NoError(t, err)
+
+	thread, err := client.MarkThreadRead(sellerCtx, &grpcPort.MarkThreadReadRequest{ThreadId: msg.ThreadId})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), thread.Unread)
+
+	threads, err := client.ListThreads(buyerCtx, &grpcPort.ListThreadsRequest{UserId: buyer.Id})
+	assert.NoError(t, err)
+	assert.Len(t, threads.List, 1)
+	assert.Equal(t, int64(1), threads.List[0].Unread)
+
+	msgs, err := client.ListMessages(buyerCtx, &grpcPort.ListMessagesRequest{ThreadId: msg.ThreadId})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), msgs.Total)
+	assert.NotEmpty(t, msgs.List[0].ReadAt)
+
+	_, strangerCtx := signUpGRPC(t, ctx, client, "ivan@example.com")
+	_, err = client.ListMessages(strangerCtx, &grpcPort.ListMessagesRequest{ThreadId: msg.ThreadId})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
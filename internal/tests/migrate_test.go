@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"homework9/internal/adapters/adrepo/postgres"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	dbstub "github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source"
+	srcstub "github.com/golang-migrate/migrate/v4/source/stub"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStubMigrate(t *testing.T, versions ...uint) *migrate.Migrate {
+	src, err := srcstub.WithInstance(nil, &srcstub.Config{})
+	assert.NoError(t, err)
+	migrations := source.NewMigrations()
+	for _, v := range versions {
+		for _, dir := range []source.Direction{source.Up, source.Down} {
+			migrations.Append(&source.Migration{Version: v, Identifier: "stub", Direction: dir, Raw: string(dir)})
+		}
+	}
+	src.(*srcstub.Stub).Migrations = migrations
+	src.(*srcstub.Stub).Url = "stub://"
+
+	db, err := dbstub.WithInstance(nil, &dbstub.Config{})
+	assert.NoError(t, err)
+	m, err := migrate.NewWithInstance("stub", src, "stub", db)
+	assert.NoError(t, err)
+	return m
+}
+
+func TestMigrateTo(t *testing.T) {
+	m := newStubMigrate(t, 1, 2, 3)
+
+	assert.NoError(t, postgres.MigrateTo(m, 3))
+	version, _, err := m.Version()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), version)
+
+	assert.NoError(t, postgres.MigrateTo(m, 1))
+	version, _, err = m.Version()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), version)
+
+	assert.NoError(t, postgres.MigrateTo(m, 0))
+	_, _, err = m.Version()
+	assert.ErrorIs(t, err, migrate.ErrNilVersion)
+
+	assert.ErrorIs(t, postgres.MigrateTo(m, 0), migrate.ErrNoChange)
+}
@@ -0,0 +1,238 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestModeration(t *testing.T) {
+	client := getTestClient(app.WithModeration(true))
+	author := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	assert.Equal(t, "draft", ad.Data.Status)
+
+	// A draft cannot be published before it is approved.
+	_, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	ad, err = client.submitAd(author, ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "pending_review", ad.Data.Status)
+
+	queue, err := client.moderationQueue(moderator)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), queue.Total)
+	assert.Equal(t, ad.Data.ID, queue.Data[0].ID)
+
+	_, err = client.rejectAd(moderator, ad.Data.ID, "")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	ad, err = client.rejectAd(moderator, ad.Data.ID, "no photo")
+	assert.NoError(t, err)
+	assert.Equal(t, "rejected", ad.Data.Status)
+	assert.Equal(t, "no photo", ad.Data.Reason)
+
+	queue, err = client.moderationQueue(moderator)
+	assert.NoError(t, err)
+	assert.Empty(t, queue.Data)
+
+	_, err = client.submitAd(author, ad.Data.ID)
+	assert.NoError(t, err)
+	ad, err = client.approveAd(moderator, ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "approved", ad.Data.Status)
+	assert.Empty(t, ad.Data.Reason)
+	assert.False(t, ad.Data.Published)
+
+	ad, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "published", ad.Data.Status)
+	assert.True(t, ad.Data.Published)
+
+	ad, err = client.changeAdStatus(author, ad.Data.ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "archived", ad.Data.Status)
+	assert.False(t, ad.Data.Published)
+
+	ad, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "published", ad.Data.Status)
+
+	// Edited content has to be reviewed again.
+	ad, err = client.updateAd(author, ad.Data.ID, "bike", "blue")
+	assert.NoError(t, err)
+	assert.Equal(t, "draft", ad.Data.Status)
+	assert.False(t, ad.Data.Published)
+
+	revs, err := client.listRevisions(author, ad.Data.ID)
+	assert.NoError(t, err)
+	last := revs.Data[len(revs.Data)-1]
+	assert.Equal(t, "published", last.OldStatus)
+	assert.Equal(t, "draft", last.NewStatus)
+}
+
+func TestModeration_Transitions(t *testing.T) {
+	client := getTestClient(app.WithModeration(true))
+	author := client.newUser(t)
+	other := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+
+	_, err = client.approveAd(moderator, ad.Data.ID)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = client.submitAd(other, ad.Data.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = client.submitAd(author, ad.Data.ID)
+	assert.NoError(t, err)
+	_, err = client.submitAd(author, ad.Data.ID)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = client.approveAd(anonymous, ad.Data.ID)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	// Only moderators and admins review ads.
+	_, err = client.approveAd(other, ad.Data.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.moderationQueue(other)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestModeration_Disabled(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+
+	ad, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "published", ad.Data.Status)
+
+	ad, err = client.updateAd(author, ad.Data.ID, "bike", "blue")
+	assert.NoError(t, err)
+	assert.Equal(t, "published", ad.Data.Status)
+}
+
+func TestModeration_DisabledKeepsReject(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+
+	_, err = client.submitAd(author, ad.Data.ID)
+	assert.NoError(t, err)
+	// An ad under review is not published without a decision.
+	_, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = client.rejectAd(moderator, ad.Data.ID, "spam")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	got, err := client.getAd(ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "rejected", got.Data.Status)
+	assert.False(t, got.Data.Published)
+}
+
+func TestListAds_StatusFilter(t *testing.T) {
+	client := getTestClient(app.WithModeration(true))
+	author := client.newUser(t)
+	draft, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	pending, err := client.createAd(author, "car", "blue")
+	assert.NoError(t, err)
+	_, err = client.submitAd(author, pending.Data.ID)
+	assert.NoError(t, err)
+
+	list, err := client.listAdsQuery("pub=false&status=draft")
+	assert.NoError(t, err)
+	assert.Len(t, list.Data, 1)
+	assert.Equal(t, draft.Data.ID, list.Data[0].ID)
+
+	_, err = client.listAdsQuery("pub=false&status=hidden")
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestApplySchedule_Moderation(t *testing.T) {
+	ctx := context.Background()
+	repo := adrepo.New()
+	a := app.NewApp(repo, app.WithModeration(true))
+	user, err := repo.CreateUser(ctx, "Oleg")
+	assert.NoError(t, err)
+	moderator, err := repo.CreateUser(ctx, "Anna")
+	assert.NoError(t, err)
+	_, err = repo.SetUserRole(ctx, moderator.ID, ads.RoleModerator)
+	assert.NoError(t, err)
+	ad, err := a.CreateAd(ctx, ads.AdInput{Title: "bike", Text: "red"}, user.ID)
+	assert.NoError(t, err)
+
+	publishAt := time.Now().Add(time.Hour)
+	_, err = a.ScheduleAd(ctx, ad.ID, user.ID, &publishAt, nil, 0)
+	assert.NoError(t, err)
+
+	// The ad is not approved, so it waits for the review.
+	n, err := a.ApplySchedule(ctx, publishAt)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = a.SubmitAd(ctx, ad.ID, user.ID, 0)
+	assert.NoError(t, err)
+	_, err = a.ApproveAd(ctx, ad.ID, moderator.ID, 0)
+	assert.NoError(t, err)
+
+	n, err = a.ApplySchedule(ctx, publishAt)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, err := a.GetByID(ctx, ad.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ads.StatusPublished, got.Status)
+	assert.Nil(t, got.PublishAt)
+}
+
+func TestGRPCModeration(t *testing.T) {
+	repo := adrepo.New()
+	client, ctx := newTestGRPCClient(t, app.NewApp(repo, app.WithModeration(true)))
+	_, authorCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	moderator, moderatorCtx := signUpGRPC(t, ctx, client, "anna@example.com")
+	_, err := repo.SetUserRole(ctx, moderator.Id, ads.RoleModerator)
+	assert.NoError(t, err)
+	ad, err := client.CreateAd(authorCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.NoError(t, err)
+
+	_, err = client.ChangeAdStatus(authorCtx, &grpcPort.ChangeAdStatusRequest{AdId: ad.Id, Published: true})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	res, err := client.SubmitAd(authorCtx, &grpcPort.SubmitAdRequest{AdId: ad.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "pending_review", res.Status)
+
+	queue, err := client.ListModerationQueue(moderatorCtx, &grpcPort.ListModerationQueueRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, queue.List, 1)
+
+	res, err = client.RejectAd(moderatorCtx, &grpcPort.RejectAdRequest{AdId: ad.Id, Reason: "spam"})
+	assert.NoError(t, err)
+	assert.Equal(t, "rejected", res.Status)
+	assert.Equal(t, "spam", res.RejectionReason)
+
+	_, err = client.ApproveAd(moderatorCtx, &grpcPort.ApproveAdRequest{AdId: ad.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
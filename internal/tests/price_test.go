@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestCreateAd_Price(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	resp, err := client.createAdWith(author, "bike", "red", map[string]any{"price": 1500000, "currency": "rub"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500000), *resp.Data.Price)
+	assert.Equal(t, "RUB", resp.Data.Currency)
+
+	resp, err = client.createAdWith(author, "bike", "free", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, resp.Data.Price)
+}
+
+func TestCreateAd_InvalidPrice(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	_, err := client.createAdWith(author, "bike", "red", map[string]any{"price": -1, "currency": "RUB"})
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.createAdWith(author, "bike", "red", map[string]any{"price": 100})
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.createAdWith(author, "bike", "red", map[string]any{"currency": "RUB"})
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.createAdWith(author, "bike", "red", map[string]any{"price": 100, "currency": "ABC"})
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestListAds_PriceFilterAndSort(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	for _, ad := range []map[string]any{
+		{"price": 30000, "currency": "RUB"},
+		{"price": 10000, "currency": "RUB"},
+		{"price": 20000, "currency": "RUB"},
+		{"price": 15000, "currency": "USD"},
+		nil,
+	} {
+		_, err := client.createAdWith(author, "bike", "red", ad)
+		assert.NoError(t, err)
+	}
+
+	list, err := client.listAdsQuery("pub=false&currency=RUB&min_price=15000&max_price=30000&sort=price")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), list.Total)
+	assert.Equal(t, int64(20000), *list.Data[0].Price)
+	assert.Equal(t, int64(30000), *list.Data[1].Price)
+
+	// Ads without a price go last in both directions.
+	list, err = client.listAdsQuery("pub=false&sort=-price")
+	assert.NoError(t, err)
+	assert.Len(t, list.Data, 5)
+	assert.Equal(t, int64(30000), *list.Data[0].Price)
+	assert.Nil(t, list.Data[4].Price)
+
+	_, err = client.listAdsQuery("pub=false&min_price=100")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.listAdsQuery("pub=false&sort=title")
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestGRPCListAds_Price(t *testing.T) {
+	client, ctx := getTestGRPCClient(t)
+
+	_, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+
+	cheap, expensive := int64(100), int64(500)
+	_, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: "a", Text: "a", Price: &expensive, Currency: "EUR"})
+	assert.NoError(t, err)
+	ad, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: "b", Text: "b", Price: &cheap, Currency: "EUR"})
+	assert.NoError(t, err)
+	assert.Equal(t, cheap, ad.GetPrice())
+
+	pub := false
+	list, err := client.ListAds(ctx, &grpcPort.ListAdsRequest{Published: &pub, Currency: "EUR", MaxPrice: &expensive, Sort: "price"})
+	assert.NoError(t, err)
+	assert.Len(t, list.List, 2)
+	assert.Equal(t, cheap, list.List[0].GetPrice())
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"homework9/internal/ads"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestUpdateUser(t *testing.T) {
+	client := getTestClient()
+	user := client.newUser(t)
+
+	updated, err := client.updateUser(http.MethodPut, user, user, map[string]any{
+		"name":         " oleg ",
+		"email":        "Oleg@Example.com",
+		"phone":        "+7 (999) 123-45-67",
+		"display_name": "Олег",
+		"avatar_url":   "https://example.com/oleg.png",
+		"about":        "Продаю велосипеды",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "oleg", updated.Data.Name)
+	assert.Equal(t, "oleg@example.com", updated.Data.Email)
+	assert.Equal(t, "+79991234567", updated.Data.Phone)
+	assert.Equal(t, "Олег", updated.Data.DisplayName)
+
+	// PATCH keeps the fields that are not sent, PUT clears them.
+	patched, err := client.updateUser(http.MethodPatch, user, user, map[string]any{"about": "Продаю самокаты"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Продаю самокаты", patched.Data.About)
+	assert.Equal(t, "+79991234567", patched.Data.Phone)
+
+	replaced, err := client.updateUser(http.MethodPut, user, user, map[string]any{"name": "oleg", "email": "oleg@example.com"})
+	assert.NoError(t, err)
+	assert.Empty(t, replaced.Data.Phone)
+	assert.Empty(t, replaced.Data.About)
+
+	// Once set, the email can be changed but not removed.
+	_, err = client.updateUser(http.MethodPatch, user, user, map[string]any{"email": ""})
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestUpdateUser_Errors(t *testing.T) {
+	client := getTestClient()
+	oleg, _ := client.signUp(t, "oleg@example.com")
+	anna := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	for _, body := range []map[string]any{
+		{"name": ""},
+		{"email": "oleg"},
+		{"phone": "89991234567"},
+		{"avatar_url": "javascript:alert(1)"},
+		{"display_name": strings.Repeat("a", 101)},
+	} {
+		_, err := client.updateUser(http.MethodPatch, anna, anna, body)
+		assert.ErrorIs(t, err, ErrBadRequest, body)
+	}
+
+	_, err := client.updateUser(http.MethodPatch, anna, anna, map[string]any{"email": "OLEG@example.com"})
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = client.updateUser(http.MethodPatch, anna, oleg, map[string]any{"about": "spam"})
+	assert.ErrorIs(t, err, ErrForbidden)
+	updated, err := client.updateUser(http.MethodPatch, admin, oleg, map[string]any{"about": "checked"})
+	assert.NoError(t, err)
+	assert.Equal(t, "checked", updated.Data.About)
+}
+
+// The id in the path is the account, not the actor: changes need a token.
+func TestUserChanges_Anonymous(t *testing.T) {
+	client := getTestClient()
+	user := client.newUser(t)
+
+	_, err := client.updateUser(http.MethodPatch, anonymous, user, map[string]any{"about": "spam"})
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.ErrorIs(t, client.deleteUserAs(anonymous, user), ErrUnauthorized)
+
+	assert.NoError(t, client.deleteUser(user))
+	_, err = client.restoreUserAs(anonymous, user)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestGetUser_Projections(t *testing.T) {
+	client := getTestClient()
+	oleg, asOleg := client.signUp(t, "oleg@example.com")
+	anna := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+	_, err := client.updateUser(http.MethodPatch, oleg, oleg, map[string]any{"phone": "+79991234567", "about": "bikes"})
+	assert.NoError(t, err)
+
+	public, err := client.getUser(oleg)
+	assert.NoError(t, err)
+	assert.Equal(t, "bikes", public.Data.About)
+	assert.Empty(t, public.Data.Email)
+	assert.Empty(t, public.Data.Phone)
+
+	public, err = client.getUserAs(anna, oleg)
+	assert.NoError(t, err)
+	assert.Empty(t, public.Data.Phone)
+
+	for _, private := range []func() (userResponse, error){
+		func() (userResponse, error) { return asOleg.getUser(oleg) },
+		func() (userResponse, error) { return client.getUserAs(admin, oleg) },
+	} {
+		got, err := private()
+		assert.NoError(t, err)
+		assert.Equal(t, "oleg@example.com", got.Data.Email)
+		assert.Equal(t, "+79991234567", got.Data.Phone)
+	}
+}
+
+func TestGRPCUpdateUser(t *testing.T) {
+	client, ctx := getTestGRPCClient(t)
+	user, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	_, otherCtx := signUpGRPC(t, ctx, client, "anna@example.com")
+
+	phone := "+79991234567"
+	about := "bikes"
+	updated, err := client.UpdateUser(userCtx, &grpcPort.UpdateUserRequest{Id: user.Id, Phone: &phone, About: &about})
+	assert.NoError(t, err)
+	assert.Equal(t, "user", updated.Name)
+	assert.Equal(t, phone, updated.Phone)
+
+	bad := "12345"
+	_, err = client.UpdateUser(userCtx, &grpcPort.UpdateUserRequest{Id: user.Id, Phone: &bad})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.UpdateUser(otherCtx, &grpcPort.UpdateUserRequest{Id: user.Id, About: &about})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.UpdateUser(ctx, &grpcPort.UpdateUserRequest{Id: user.Id, About: &about})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	public, err := client.GetUser(ctx, &grpcPort.GetUserRequest{Id: user.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "bikes", public.About)
+	assert.Empty(t, public.Phone)
+
+	private, err := client.GetUser(userCtx, &grpcPort.GetUserRequest{Id: user.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, phone, private.Phone)
+}
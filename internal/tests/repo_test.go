@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+)
+
+func TestMemRepo_ConcurrentCreate(t *testing.T) {
+	ctx := context.Background()
+	repo := adrepo.New()
+	user, err := repo.CreateUser(ctx, "user")
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.Create(ctx, ads.AdInput{Title: "hello", Text: "world"}, user.ID)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	list, total, err := repo.GetList(ctx, ads.AdFilter{Auth: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50), total)
+	assert.Len(t, list, 50)
+	for i := range list {
+		assert.Equal(t, int64(i), list[i].ID)
+	}
+}
+
+func TestMemRepo_DeleteAd(t *testing.T) {
+	ctx := context.Background()
+	repo := adrepo.New()
+	user, err := repo.CreateUser(ctx, "user")
+	assert.NoError(t, err)
+
+	ad, err := repo.Create(ctx, ads.AdInput{Title: "hello", Text: "world"}, user.ID)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, repo.DeleteAd(ctx, ad.ID, user.ID+1), adrepo.ErrNotAuthor)
+	assert.NoError(t, repo.DeleteAd(ctx, ad.ID, user.ID))
+
+	_, err = repo.GetByID(ctx, ad.ID)
+	assert.ErrorIs(t, err, adrepo.ErrWasDeleted)
+}
+
+func TestMemRepo_RunInTx_Rollback(t *testing.T) {
+	ctx := context.Background()
+	repo := adrepo.New()
+	user, err := repo.CreateUser(ctx, "user")
+	assert.NoError(t, err)
+
+	ad, err := repo.Create(ctx, ads.AdInput{Title: "hello", Text: "world"}, user.ID)
+	assert.NoError(t, err)
+
+	errAbort := errors.New("abort")
+	err = repo.RunInTx(ctx, func(tx app.Repository) error {
+		if _, err := tx.UpdateContent(ctx, ad.ID, user.ID, ads.AdInput{Title: "changed", Text: "changed"}, 0); err != nil {
+			return err
+		}
+		if _, err := tx.Create(ctx, ads.AdInput{Title: "second", Text: "ad"}, user.ID); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	got, err := repo.GetByID(ctx, ad.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", got.Title)
+
+	_, total, err := repo.GetList(ctx, ads.AdFilter{Auth: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+}
+
+func TestMemRepo_RunInTx_Commit(t *testing.T) {
+	ctx := context.Background()
+	repo := adrepo.New()
+
+	err := repo.RunInTx(ctx, func(tx app.Repository) error {
+		user, err := tx.CreateUser(ctx, "user")
+		if err != nil {
+			return err
+		}
+		ad, err := tx.Create(ctx, ads.AdInput{Title: "hello", Text: "world"}, user.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.UpdateStatus(ctx, ad.ID, ads.StatusDraft, ads.StatusPublished, "", 0)
+		return err
+	})
+	assert.NoError(t, err)
+
+	list, _, err := repo.GetList(ctx, ads.AdFilter{Pub: true, Auth: -1})
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+}
+
+func TestMemRepo_CreateUnknownAuthor(t *testing.T) {
+	ctx := context.Background()
+	repo := adrepo.New()
+	user, err := repo.CreateUser(ctx, "user")
+	assert.NoError(t, err)
+
+	_, err = repo.Create(ctx, ads.AdInput{Title: "hello", Text: "world"}, user.ID+1)
+	assert.ErrorIs(t, err, adrepo.ErrUnknownAuthor)
+
+	assert.NoError(t, repo.DeleteUser(ctx, user.ID, user.ID))
+	_, err = repo.Create(ctx, ads.AdInput{Title: "hello", Text: "world"}, user.ID)
+	assert.ErrorIs(t, err, adrepo.ErrUnknownAuthor)
+}
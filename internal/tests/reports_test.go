@@ -0,0 +1,243 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestReports(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	first := client.newUser(t)
+	second := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+	bike, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, bike.Data.ID, true)
+	assert.NoError(t, err)
+	car, err := client.createAd(author, "car", "blue")
+	assert.NoError(t, err)
+
+	rep, err := client.reportAd(first, car.Data.ID, "spam", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "open", rep.Data.Status)
+	assert.Empty(t, rep.Data.Resolution)
+
+	rep, err = client.reportAd(first, bike.Data.ID, "scam", " asks for a prepayment ")
+	assert.NoError(t, err)
+	assert.Equal(t, "scam", rep.Data.Reason)
+	assert.Equal(t, "asks for a prepayment", rep.Data.Comment)
+	_, err = client.reportAd(second, bike.Data.ID, "illegal", "")
+	assert.NoError(t, err)
+
+	// The most reported ad comes first.
+	queue, err := client.listReports(moderator)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), queue.Total)
+	assert.Equal(t, bike.Data.ID, queue.Data[0].AdID)
+	assert.Len(t, queue.Data[0].Reports, 2)
+	assert.Equal(t, first, queue.Data[0].Reports[0].ReporterID)
+	assert.Equal(t, car.Data.ID, queue.Data[1].AdID)
+
+	resolved, err := client.resolveReports(moderator, bike.Data.ID, "unpublished")
+	assert.NoError(t, err)
+	assert.Len(t, resolved.Data, 2)
+	for _, r := range resolved.Data {
+		assert.Equal(t, "resolved", r.Status)
+		assert.Equal(t, "unpublished", r.Resolution)
+		assert.Equal(t, &moderator, r.ResolvedBy)
+		assert.NotNil(t, r.ResolvedAt)
+	}
+
+	// The ad is rejected, so the author has to submit it for review to publish it again.
+	got, err := client.getAd(bike.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "rejected", got.Data.Status)
+	assert.False(t, got.Data.Published)
+	assert.NotEmpty(t, got.Data.Reason)
+	_, err = client.changeAdStatus(author, bike.Data.ID, true)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	for _, user := range []int64{first, second} {
+		notices, err := client.listNotifications(user)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), notices.Total)
+		assert.Contains(t, notices.Data[0].Text, "unpublished")
+	}
+
+	queue, err = client.listReports(moderator)
+	assert.NoError(t, err)
+	assert.Len(t, queue.Data, 1)
+	assert.Equal(t, car.Data.ID, queue.Data[0].AdID)
+
+	_, err = client.resolveReports(moderator, bike.Data.ID, "dismissed")
+	assert.ErrorIs(t, err, ErrConflict)
+
+	// A resolved report does not stop the user from reporting the ad again.
+	_, err = client.reportAd(first, bike.Data.ID, "scam", "")
+	assert.NoError(t, err)
+
+	// The car has not been published, so the reporter is not told it was unpublished.
+	_, err = client.resolveReports(moderator, car.Data.ID, "unpublished")
+	assert.NoError(t, err)
+	got, err = client.getAd(car.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "rejected", got.Data.Status)
+	notices, err := client.listNotifications(first)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), notices.Total)
+	assert.NotContains(t, notices.Data[0].Text, "unpublished")
+}
+
+func TestReports_UnpublishedWithModeration(t *testing.T) {
+	client := getTestClient(app.WithModeration(true))
+	author := client.newUser(t)
+	reporter := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	_, err = client.submitAd(author, ad.Data.ID)
+	assert.NoError(t, err)
+	_, err = client.approveAd(moderator, ad.Data.ID)
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.NoError(t, err)
+	_, err = client.reportAd(reporter, ad.Data.ID, "scam", "")
+	assert.NoError(t, err)
+
+	_, err = client.resolveReports(moderator, ad.Data.ID, "unpublished")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	got, err := client.submitAd(author, ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "pending_review", got.Data.Status)
+}
+
+func TestReports_Delete(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	reporter := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	_, err = client.reportAd(reporter, ad.Data.ID, "illegal", "")
+	assert.NoError(t, err)
+
+	_, err = client.resolveReports(moderator, ad.Data.ID, "deleted")
+	assert.NoError(t, err)
+
+	_, err = client.getAd(ad.Data.ID)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	notices, err := client.listNotifications(reporter)
+	assert.NoError(t, err)
+	assert.Len(t, notices.Data, 1)
+	assert.Contains(t, notices.Data[0].Text, "deleted")
+
+	queue, err := client.listReports(moderator)
+	assert.NoError(t, err)
+	assert.Empty(t, queue.Data)
+}
+
+func TestReports_DeletedNotRestoredByAuthor(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	reporter := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.NoError(t, err)
+	_, err = client.reportAd(reporter, ad.Data.ID, "scam", "")
+	assert.NoError(t, err)
+	_, err = client.resolveReports(moderator, ad.Data.ID, "deleted")
+	assert.NoError(t, err)
+
+	// Only an admin brings back an ad deleted after reports.
+	_, err = client.restoreAd(author, ad.Data.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.getAd(ad.Data.ID)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	restored, err := client.restoreAd(admin, ad.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ad.Data.ID, restored.Data.ID)
+}
+
+func TestReports_Errors(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	reporter := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+
+	_, err = client.reportAd(reporter, ad.Data.ID, "boring", "")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.reportAd(author, ad.Data.ID, "spam", "")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.reportAd(reporter, ad.Data.ID+100, "spam", "")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.reportAd(reporter, ad.Data.ID, "spam", "")
+	assert.NoError(t, err)
+	_, err = client.reportAd(reporter, ad.Data.ID, "scam", "")
+	assert.ErrorIs(t, err, ErrConflict)
+
+	_, err = client.resolveReports(moderator, ad.Data.ID, "ignored")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.resolveReports(anonymous, ad.Data.ID, "dismissed")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestGRPCReports(t *testing.T) {
+	repo := adrepo.New()
+	client, ctx := newTestGRPCClient(t, app.NewApp(repo))
+	_, authorCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	reporter, reporterCtx := signUpGRPC(t, ctx, client, "anna@example.com")
+	moderator, moderatorCtx := signUpGRPC(t, ctx, client, "ivan@example.com")
+	_, err := repo.SetUserRole(ctx, moderator.Id, ads.RoleModerator)
+	assert.NoError(t, err)
+	ad, err := client.CreateAd(authorCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.NoError(t, err)
+
+	rep, err := client.ReportAd(reporterCtx, &grpcPort.ReportAdRequest{AdId: ad.Id, Reason: "spam"})
+	assert.NoError(t, err)
+	assert.Equal(t, "open", rep.Status)
+
+	_, err = client.ReportAd(reporterCtx, &grpcPort.ReportAdRequest{AdId: ad.Id, Reason: "spam"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = client.ListReports(authorCtx, &grpcPort.ListReportsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	queue, err := client.ListReports(moderatorCtx, &grpcPort.ListReportsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, queue.List, 1)
+	assert.Len(t, queue.List[0].Reports, 1)
+
+	res, err := client.ResolveReports(moderatorCtx, &grpcPort.ResolveReportsRequest{AdId: ad.Id, Resolution: "dismissed"})
+	assert.NoError(t, err)
+	assert.Equal(t, "dismissed", res.List[0].Resolution)
+
+	_, err = client.ResolveReports(moderatorCtx, &grpcPort.ResolveReportsRequest{AdId: ad.Id, Resolution: "dismissed"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	notices, err := client.ListNotifications(reporterCtx, &grpcPort.ListNotificationsRequest{UserId: reporter.Id})
+	assert.NoError(t, err)
+	assert.Len(t, notices.List, 1)
+}
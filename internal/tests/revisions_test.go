@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"homework9/internal/ads"
+)
+
+func TestListRevisions(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.updateAd(author, resp.Data.ID, "привет", "мир")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, resp.Data.ID, true)
+	assert.NoError(t, err)
+
+	revs, err := client.listRevisions(author, resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revs.Data, 2)
+
+	assert.Equal(t, author, revs.Data[0].ActorID)
+	assert.Equal(t, "hello", revs.Data[0].OldTitle)
+	assert.Equal(t, "привет", revs.Data[0].NewTitle)
+	assert.Equal(t, "world", revs.Data[0].OldText)
+	assert.Equal(t, "мир", revs.Data[0].NewText)
+
+	assert.False(t, revs.Data[1].OldPublished)
+	assert.True(t, revs.Data[1].NewPublished)
+	assert.Equal(t, "привет", revs.Data[1].OldTitle)
+	assert.Equal(t, "привет", revs.Data[1].NewTitle)
+}
+
+func TestListRevisions_NotAuthor(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	other := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+
+	_, err = client.listRevisions(other, resp.Data.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestFailedUpdate_NoRevision(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	other := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.updateAd(other, resp.Data.ID, "title", "text")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	revs, err := client.listRevisions(author, resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revs.Data, 0)
+}
+
+func TestRollbackAd(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.updateAd(author, resp.Data.ID, "first", "edit")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, resp.Data.ID, true)
+	assert.NoError(t, err)
+	_, err = client.updateAd(author, resp.Data.ID, "second", "edit")
+	assert.NoError(t, err)
+
+	revs, err := client.listRevisions(author, resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revs.Data, 3)
+
+	// Rolling back the first update returns the ad to the state before it.
+	ad, err := client.rollbackAd(author, resp.Data.ID, revs.Data[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", ad.Data.Title)
+	assert.Equal(t, "world", ad.Data.Text)
+	assert.False(t, ad.Data.Published)
+
+	revs, err = client.listRevisions(author, resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revs.Data, 4)
+	assert.Equal(t, "second", revs.Data[3].OldTitle)
+	assert.Equal(t, "hello", revs.Data[3].NewTitle)
+	assert.True(t, revs.Data[3].OldPublished)
+	assert.False(t, revs.Data[3].NewPublished)
+}
+
+func TestRollbackAd_Errors(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	other := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.updateAd(author, resp.Data.ID, "first", "edit")
+	assert.NoError(t, err)
+	revs, err := client.listRevisions(author, resp.Data.ID)
+	assert.NoError(t, err)
+
+	_, err = client.rollbackAd(other, resp.Data.ID, revs.Data[0].ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = client.rollbackAd(author, resp.Data.ID, revs.Data[0].ID+100)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	got, err := client.getAd(resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", got.Data.Title)
+}
+
+func TestRevisions_Admin(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, resp.Data.ID, true)
+	assert.NoError(t, err)
+	_, err = client.updateAd(author, resp.Data.ID, "first", "edit")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, resp.Data.ID, false)
+	assert.NoError(t, err)
+
+	_, err = client.listRevisions(moderator, resp.Data.ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+	revs, err := client.listRevisions(admin, resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revs.Data, 3)
+
+	_, err = client.rollbackAd(moderator, resp.Data.ID, revs.Data[1].ID)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// The ad was published before the update, but only the author publishes it.
+	ad, err := client.rollbackAd(admin, resp.Data.ID, revs.Data[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", ad.Data.Title)
+	assert.False(t, ad.Data.Published)
+
+	revs, err = client.listRevisions(author, resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revs.Data, 4)
+	assert.Equal(t, admin, revs.Data[3].ActorID)
+}
+
+func TestRevisions_AdminKeepsPublished(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, resp.Data.ID, true)
+	assert.NoError(t, err)
+	_, err = client.updateAd(author, resp.Data.ID, "first", "edit")
+	assert.NoError(t, err)
+	revs, err := client.listRevisions(admin, resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revs.Data, 2)
+
+	// The ad was published before the edit too, so it stays published.
+	ad, err := client.rollbackAd(admin, resp.Data.ID, revs.Data[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", ad.Data.Title)
+	assert.True(t, ad.Data.Published)
+	assert.Equal(t, "published", ad.Data.Status)
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestRoles_AdminManagesAds(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	other := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+	ad, err = client.changeAdStatus(author, ad.Data.ID, true)
+	assert.NoError(t, err)
+
+	_, err = client.updateAd(other, ad.Data.ID, "bike", "spam")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.changeAdStatus(other, ad.Data.ID, false)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, client.deleteAd(other, ad.Data.ID), ErrForbidden)
+
+	updated, err := client.updateAd(admin, ad.Data.ID, "bike", "blue")
+	assert.NoError(t, err)
+	assert.Equal(t, author, updated.Data.AuthorID)
+	assert.Equal(t, "blue", updated.Data.Text)
+
+	unpublished, err := client.changeAdStatus(admin, ad.Data.ID, false)
+	assert.NoError(t, err)
+	assert.False(t, unpublished.Data.Published)
+
+	// Publishing stays with the author.
+	_, err = client.changeAdStatus(admin, ad.Data.ID, true)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	assert.NoError(t, client.deleteAd(admin, ad.Data.ID))
+	_, err = client.getAd(ad.Data.ID)
+	assert.Error(t, err)
+}
+
+func TestRoles_ModeratorLimits(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+
+	_, err = client.listReports(moderator)
+	assert.NoError(t, err)
+	_, err = client.listReports(author)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// Moderators review ads, but do not manage them.
+	_, err = client.updateAd(moderator, ad.Data.ID, "bike", "blue")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.createCategory(moderator, "Транспорт", nil)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.setUserRole(moderator, author, "moderator")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestRoles_AdminManagesUsers(t *testing.T) {
+	client := getTestClient()
+	user := client.newUser(t)
+	other := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	got, err := client.setUserRole(admin, user, "moderator")
+	assert.NoError(t, err)
+	assert.Equal(t, "moderator", got.Data.Role)
+
+	_, err = client.setUserRole(admin, user, "owner")
+	assert.ErrorIs(t, err, ErrBadRequest)
+	_, err = client.setUserRole(admin, admin, "user")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	assert.ErrorIs(t, client.deleteUserAs(other, user), ErrForbidden)
+	assert.NoError(t, client.deleteUserAs(admin, user))
+	_, err = client.restoreUserAs(other, user)
+	assert.ErrorIs(t, err, ErrForbidden)
+	restored, err := client.restoreUserAs(admin, user)
+	assert.NoError(t, err)
+	assert.Equal(t, "moderator", restored.Data.Role)
+}
+
+// The role is changed by the admin of the token; naming an admin in the body does not help.
+func TestRoles_SetRoleWithoutToken(t *testing.T) {
+	client := getTestClient()
+	user := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	for actor, want := range map[*testClient]error{client: ErrUnauthorized, client.as(user): ErrForbidden} {
+		data, err := json.Marshal(map[string]any{"user_id": admin, "role": "admin"})
+		assert.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf(client.baseURL+"/api/v1/users/%d/role", user), bytes.NewReader(data))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		var response userResponse
+		assert.ErrorIs(t, actor.getResponse(req, &response), want)
+	}
+	_, err := client.setUserRole(anonymous, user, "admin")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	got, err := client.getUser(user)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", got.Data.Role)
+}
+
+func TestGRPCRoles(t *testing.T) {
+	repo := adrepo.New()
+	client, ctx := newTestGRPCClient(t, app.NewApp(repo))
+	user, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	assert.Equal(t, "user", user.Role)
+	admin, adminCtx := signUpGRPC(t, ctx, client, "anna@example.com")
+	_, err := repo.SetUserRole(ctx, admin.Id, ads.RoleAdmin)
+	assert.NoError(t, err)
+
+	_, err = client.SetUserRole(userCtx, &grpcPort.SetUserRoleRequest{Id: admin.Id, Role: "user"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.SetUserRole(ctx, &grpcPort.SetUserRoleRequest{Id: user.Id, Role: "admin"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	moderator, err := client.SetUserRole(adminCtx, &grpcPort.SetUserRoleRequest{Id: user.Id, Role: "moderator"})
+	assert.NoError(t, err)
+	assert.Equal(t, "moderator", moderator.Role)
+
+	ad, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.NoError(t, err)
+	_, err = client.DeleteAd(adminCtx, &grpcPort.DeleteAdRequest{AdId: ad.Id})
+	assert.NoError(t, err)
+
+	_, err = client.DeleteUser(userCtx, &grpcPort.DeleteUserRequest{Id: admin.Id})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.DeleteUser(adminCtx, &grpcPort.DeleteUserRequest{Id: user.Id})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestScheduleAd(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+
+	publishAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	expiresAt := publishAt.Add(24 * time.Hour)
+	resp, err := client.scheduleAd(author, ad.Data.ID, &publishAt, &expiresAt)
+	assert.NoError(t, err)
+	assert.Equal(t, publishAt.UTC().Format(time.RFC3339), *resp.Data.PublishAt)
+	assert.Equal(t, expiresAt.UTC().Format(time.RFC3339), *resp.Data.ExpiresAt)
+	assert.False(t, resp.Data.Published)
+
+	resp, err = client.scheduleAd(author, ad.Data.ID, nil, &expiresAt)
+	assert.NoError(t, err)
+	assert.Nil(t, resp.Data.PublishAt)
+	assert.NotNil(t, resp.Data.ExpiresAt)
+}
+
+func TestScheduleAd_Invalid(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+	other := client.newUser(t)
+	ad, err := client.createAd(author, "bike", "red")
+	assert.NoError(t, err)
+
+	publishAt := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	_, err = client.scheduleAd(author, ad.Data.ID, &publishAt, &publishAt)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.scheduleAd(author, ad.Data.ID, nil, &past)
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = client.scheduleAd(other, ad.Data.ID, &publishAt, nil)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestApplySchedule(t *testing.T) {
+	ctx := context.Background()
+	repo := adrepo.New()
+	a := app.NewApp(repo)
+	user, err := repo.CreateUser(ctx, "Oleg")
+	assert.NoError(t, err)
+	ad, err := a.CreateAd(ctx, ads.AdInput{Title: "bike", Text: "red"}, user.ID)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	publishAt, expiresAt := now.Add(time.Hour), now.Add(2*time.Hour)
+	_, err = a.ScheduleAd(ctx, ad.ID, user.ID, &publishAt, &expiresAt, 0)
+	assert.NoError(t, err)
+
+	n, err := a.ApplySchedule(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = a.ApplySchedule(ctx, publishAt)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, err := a.GetByID(ctx, ad.ID)
+	assert.NoError(t, err)
+	assert.True(t, got.Published)
+	assert.Nil(t, got.PublishAt)
+	assert.NotNil(t, got.ExpiresAt)
+
+	// Publishing by the scheduler is recorded on behalf of the author.
+	revs, err := a.ListRevisions(ctx, ad.ID, user.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revs, 1)
+	assert.True(t, revs[0].NewPublished)
+
+	n, err = a.ApplySchedule(ctx, expiresAt.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, err = a.GetByID(ctx, ad.ID)
+	assert.NoError(t, err)
+	assert.False(t, got.Published)
+	assert.Nil(t, got.ExpiresAt)
+
+	n, err = a.ApplySchedule(ctx, expiresAt.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestApplySchedule_ExpiredBeforePublishing(t *testing.T) {
+	ctx := context.Background()
+	repo := adrepo.New()
+	a := app.NewApp(repo)
+	user, err := repo.CreateUser(ctx, "Oleg")
+	assert.NoError(t, err)
+	ad, err := a.CreateAd(ctx, ads.AdInput{Title: "bike", Text: "red"}, user.ID)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	publishAt, expiresAt := now.Add(time.Hour), now.Add(2*time.Hour)
+	_, err = a.ScheduleAd(ctx, ad.ID, user.ID, &publishAt, &expiresAt, 0)
+	assert.NoError(t, err)
+
+	// The service was down for the whole publication period.
+	_, err = a.ApplySchedule(ctx, now.Add(3*time.Hour))
+	assert.NoError(t, err)
+	got, err := a.GetByID(ctx, ad.ID)
+	assert.NoError(t, err)
+	assert.False(t, got.Published)
+	assert.Nil(t, got.PublishAt)
+	assert.Nil(t, got.ExpiresAt)
+}
+
+func TestApplySchedule_DeletedAuthor(t *testing.T) {
+	ctx := context.Background()
+	repo := adrepo.New()
+	a := app.NewApp(repo, app.WithUserDeletePolicy(app.DeleteUserUnpublish))
+	user, err := repo.CreateUser(ctx, "Oleg")
+	assert.NoError(t, err)
+	admin, err := repo.CreateUser(ctx, "Anna")
+	assert.NoError(t, err)
+	_, err = repo.SetUserRole(ctx, admin.ID, ads.RoleAdmin)
+	assert.NoError(t, err)
+	ad, err := a.CreateAd(ctx, ads.AdInput{Title: "bike", Text: "red"}, user.ID)
+	assert.NoError(t, err)
+
+	publishAt := time.Now().Add(time.Hour)
+	_, err = a.ScheduleAd(ctx, ad.ID, user.ID, &publishAt, nil, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, a.DeleteUser(ctx, user.ID, user.ID))
+
+	n, err := a.ApplySchedule(ctx, publishAt)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// Once the author is back, the ad is published as planned.
+	_, err = a.RestoreUser(ctx, user.ID, admin.ID)
+	assert.NoError(t, err)
+	n, err = a.ApplySchedule(ctx, publishAt)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, err := a.GetByID(ctx, ad.ID)
+	assert.NoError(t, err)
+	assert.True(t, got.Published)
+}
+
+func TestRunScheduler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := adrepo.New()
+	a := app.NewApp(repo)
+	user, err := repo.CreateUser(ctx, "Oleg")
+	assert.NoError(t, err)
+	ad, err := a.CreateAd(ctx, ads.AdInput{Title: "bike", Text: "red"}, user.ID)
+	assert.NoError(t, err)
+	publishAt := time.Now().Add(50 * time.Millisecond)
+	_, err = a.ScheduleAd(ctx, ad.ID, user.ID, &publishAt, nil, 0)
+	assert.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.RunScheduler(ctx, a, 10*time.Millisecond, func(err error) {
+			t.Errorf("scheduler failed: %v", err)
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		got, err := a.GetByID(ctx, ad.ID)
+		return err == nil && got.Published
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestGRPCScheduleAd(t *testing.T) {
+	client, ctx := getTestGRPCClient(t)
+	_, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	ad, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.NoError(t, err)
+
+	publishAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	res, err := client.ScheduleAd(userCtx, &grpcPort.ScheduleAdRequest{AdId: ad.Id, PublishAt: publishAt})
+	assert.NoError(t, err)
+	assert.Equal(t, publishAt, res.PublishAt)
+	assert.Empty(t, res.ExpiresAt)
+
+	_, err = client.ScheduleAd(userCtx, &grpcPort.ScheduleAdRequest{AdId: ad.Id, PublishAt: "tomorrow"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListAds_Search(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	texts := [][2]string{
+		{"Продам велосипед", "Горный велосипед, почти новый"},
+		{"Котята", "Отдам котят в добрые руки"},
+		{"Bicycle parts", "Велосипедные запчасти и bicycle chain"},
+	}
+	for _, tt := range texts {
+		resp, err := client.createAd(author, tt[0], tt[1])
+		assert.NoError(t, err)
+		_, err = client.changeAdStatus(author, resp.Data.ID, true)
+		assert.NoError(t, err)
+	}
+
+	ads, err := client.listAdsQuery("q=" + url.QueryEscape("велосипед"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), ads.Total)
+	assert.Equal(t, int64(0), ads.Data[0].ID)
+	assert.Contains(t, ads.Data[0].Snippet, "<b>велосипед</b>")
+
+	ads, err = client.listAdsQuery("q=" + url.QueryEscape("BICYCLE chain"))
+	assert.NoError(t, err)
+	assert.Len(t, ads.Data, 1)
+	assert.Equal(t, int64(2), ads.Data[0].ID)
+
+	ads, err = client.listAdsQuery("q=" + url.QueryEscape("собака"))
+	assert.NoError(t, err)
+	assert.Len(t, ads.Data, 0)
+}
+
+func TestListAds_SearchSnippetEscaped(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	resp, err := client.createAd(author, `<script>alert("x")</script> велосипед`, "Tom & Jerry's <b>bike</b>")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, resp.Data.ID, true)
+	assert.NoError(t, err)
+
+	ads, err := client.listAdsQuery("q=" + url.QueryEscape("велосипед"))
+	assert.NoError(t, err)
+	assert.Len(t, ads.Data, 1)
+	snippet := ads.Data[0].Snippet
+	assert.NotContains(t, snippet, "<script>")
+	assert.Contains(t, snippet, "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;")
+	assert.Contains(t, snippet, "<b>велосипед</b>")
+	assert.Contains(t, snippet, "Tom &amp; Jerry&#39;s &lt;b&gt;bike&lt;/b&gt;")
+}
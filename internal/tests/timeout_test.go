@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+// slowRepo is a repository whose lookups hang until the context is done,
+// like a query stuck on a lock in Postgres.
+type slowRepo struct {
+	app.Repository
+}
+
+func (r slowRepo) GetByID(ctx context.Context, ID int64) (*ads.Ad, error) {
+	<-ctx.Done()
+	return nil, fmt.Errorf("unable to get ad: %w", ctx.Err())
+}
+
+func (r slowRepo) GetUser(ctx context.Context, ID int64) (*ads.User, error) {
+	<-ctx.Done()
+	return nil, fmt.Errorf("unable to get user: %w", ctx.Err())
+}
+
+func TestGetAd_Timeout(t *testing.T) {
+	a := app.NewApp(slowRepo{adrepo.New()}, app.WithTimeouts(app.Timeouts{Read: 10 * time.Millisecond}))
+	client := newTestClient(a)
+
+	resp, err := client.client.Get(client.baseURL + "/api/v1/ads/0")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+}
+
+func TestGetAd_ClientCanceled(t *testing.T) {
+	handler := newTestHandler(app.NewApp(adrepo.New()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ads/0", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, 499, rec.Code)
+}
+
+func TestListAds_NoTimeoutByDefault(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	_, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+
+	ads, err := client.listAdsQuery("pub=false")
+	assert.NoError(t, err)
+	assert.Len(t, ads.Data, 1)
+}
+
+func TestGRPCGetUser_Timeout(t *testing.T) {
+	repo := adrepo.New()
+	a := app.NewApp(slowRepo{repo}, app.WithTimeouts(app.Timeouts{Read: 10 * time.Millisecond}))
+	client, ctx := newTestGRPCClient(t, a)
+
+	user, err := repo.CreateUser(ctx, "Oleg")
+	assert.NoError(t, err)
+
+	_, err = client.GetUser(ctx, &grpcPort.GetUserRequest{Id: user.ID})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"homework9/internal/adapters/adrepo"
+	"homework9/internal/ads"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
+)
+
+func TestCreateUser(t *testing.T) {
+	client := getTestClient()
+	user := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	_, err := client.createUser(anonymous, "Ivan")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	_, err = client.createUser(user, "Ivan")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.createUser(admin, "")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	created, err := client.createUser(admin, " Ivan ")
+	assert.NoError(t, err)
+	assert.Equal(t, "Ivan", created.Data.Name)
+}
+
+func TestListUsers(t *testing.T) {
+	client := getTestClient()
+	oleg, err := client.register("Oleg", "oleg@example.com", "password1")
+	assert.NoError(t, err)
+	anna, err := client.register("Anna", "anna@mail.org", "password1")
+	assert.NoError(t, err)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+	tokens, err := client.login("oleg@example.com", "password1")
+	assert.NoError(t, err)
+	asOleg := client.withToken(tokens.Data.AccessToken)
+
+	ad, err := asOleg.createAd(oleg.Data.ID, "bike", "red")
+	assert.NoError(t, err)
+	_, err = asOleg.changeAdStatus(oleg.Data.ID, ad.Data.ID, true)
+	assert.NoError(t, err)
+	_, err = asOleg.createAd(oleg.Data.ID, "draft", "not published")
+	assert.NoError(t, err)
+
+	users, err := client.listUsers(admin, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), users.Total)
+	assert.Len(t, users.Data, 3)
+	assert.Equal(t, oleg.Data.ID, users.Data[0].ID)
+	assert.Equal(t, int64(1), users.Data[0].ActiveAds)
+	assert.Equal(t, int64(0), users.Data[1].ActiveAds)
+	_, err = time.Parse("2006-01-02 15:04:05", users.Data[0].DateCreated)
+	assert.NoError(t, err)
+
+	users, err = client.listUsers(admin, "q=EXAMPLE")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), users.Total)
+	assert.Equal(t, oleg.Data.ID, users.Data[0].ID)
+
+	users, err = client.listUsers(admin, "q=ann")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), users.Total)
+	assert.Equal(t, anna.Data.ID, users.Data[0].ID)
+
+	users, err = client.listUsers(admin, "role=admin")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), users.Total)
+	assert.Equal(t, admin, users.Data[0].ID)
+	assert.Equal(t, "admin", users.Data[0].Role)
+
+	users, err = client.listUsers(admin, "limit=2&offset=2")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), users.Total)
+	assert.Len(t, users.Data, 1)
+}
+
+func TestListUsers_Deleted(t *testing.T) {
+	client := getTestClient()
+	oleg := client.newUser(t)
+	anna := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+	assert.NoError(t, client.deleteUser(anna))
+
+	users, err := client.listUsers(admin, "deleted=true")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), users.Total)
+	assert.Equal(t, anna, users.Data[0].ID)
+	assert.True(t, users.Data[0].Deleted)
+
+	users, err = client.listUsers(admin, "deleted=false")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), users.Total)
+	assert.Equal(t, oleg, users.Data[0].ID)
+
+	users, err = client.listUsers(admin, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), users.Total)
+}
+
+func TestListUsers_SortByDateCreated(t *testing.T) {
+	client := getTestClient()
+	first := client.newUser(t)
+	second := client.newUser(t)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	users, err := client.listUsers(admin, "sort=-date_created")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{admin, second, first}, []int64{users.Data[0].ID, users.Data[1].ID, users.Data[2].ID})
+
+	users, err = client.listUsers(admin, "sort=date_created")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{first, second, admin}, []int64{users.Data[0].ID, users.Data[1].ID, users.Data[2].ID})
+}
+
+func TestListUsers_Errors(t *testing.T) {
+	client := getTestClient()
+	user := client.newUser(t)
+	moderator := client.newUserWithRole(t, ads.RoleModerator)
+	admin := client.newUserWithRole(t, ads.RoleAdmin)
+
+	_, err := client.listUsers(user, "")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = client.listUsers(moderator, "")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = client.listUsers(admin, "sort=name")
+	assert.ErrorIs(t, err, ErrBadRequest)
+	_, err = client.listUsers(admin, "role=owner")
+	assert.ErrorIs(t, err, ErrBadRequest)
+	_, err = client.listUsers(admin, "deleted=maybe")
+	assert.ErrorIs(t, err, ErrBadRequest)
+	_, err = client.listUsers(admin, "limit=ten")
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestGRPCListUsers(t *testing.T) {
+	repo := adrepo.New()
+	client, ctx := newTestGRPCClient(t, app.NewApp(repo))
+	user, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+	admin, adminCtx := signUpGRPC(t, ctx, client, "anna@example.com")
+	_, err := repo.SetUserRole(ctx, admin.Id, ads.RoleAdmin)
+	assert.NoError(t, err)
+
+	ad, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: "bike", Text: "red"})
+	assert.NoError(t, err)
+	_, err = client.ChangeAdStatus(userCtx, &grpcPort.ChangeAdStatusRequest{AdId: ad.Id, Published: true})
+	assert.NoError(t, err)
+
+	_, err = client.ListUsers(userCtx, &grpcPort.ListUsersRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	deleted := false
+	users, err := client.ListUsers(adminCtx, &grpcPort.ListUsersRequest{Q: "ole", Deleted: &deleted})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), users.Total)
+	assert.Equal(t, user.Id, users.List[0].Id)
+	assert.Equal(t, int64(1), users.List[0].ActiveAds)
+	assert.NotEmpty(t, users.List[0].DateCreated)
+
+	users, err = client.ListUsers(adminCtx, &grpcPort.ListUsersRequest{Sort: "-date_created", Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), users.Total)
+	assert.Equal(t, admin.Id, users.List[0].Id)
+
+	_, err = client.ListUsers(adminCtx, &grpcPort.ListUsersRequest{Sort: "name"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
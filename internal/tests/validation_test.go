@@ -1,84 +1,173 @@
 package tests
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"homework9/internal/app"
+	grpcPort "homework9/internal/ports/grpc"
 )
 
 func TestCreateAd_EmptyTitle(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
-	_, err := client.createAd(123, "", "world")
+	_, err := client.createAd(author, "", "world")
 	assert.ErrorIs(t, err, ErrBadRequest)
 }
 
 func TestCreateAd_TooLongTitle(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
 	title := strings.Repeat("a", 101)
 
-	_, err := client.createAd(123, title, "world")
+	_, err := client.createAd(author, title, "world")
 	assert.ErrorIs(t, err, ErrBadRequest)
 }
 
 func TestCreateAd_EmptyText(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
-	_, err := client.createAd(123, "title", "")
+	_, err := client.createAd(author, "title", "")
 	assert.ErrorIs(t, err, ErrBadRequest)
 }
 
 func TestCreateAd_TooLongText(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
 	text := strings.Repeat("a", 501)
 
-	_, err := client.createAd(123, "title", text)
+	_, err := client.createAd(author, "title", text)
 	assert.ErrorIs(t, err, ErrBadRequest)
 }
 
 func TestUpdateAd_EmptyTitle(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
-	resp, err := client.createAd(123, "hello", "world")
+	resp, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 
-	_, err = client.updateAd(123, resp.Data.ID, "", "new_world")
+	_, err = client.updateAd(author, resp.Data.ID, "", "new_world")
 	assert.ErrorIs(t, err, ErrBadRequest)
 }
 
 func TestUpdateAd_TooLongTitle(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
-	resp, err := client.createAd(123, "hello", "world")
+	resp, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 
 	title := strings.Repeat("a", 101)
 
-	_, err = client.updateAd(123, resp.Data.ID, title, "world")
+	_, err = client.updateAd(author, resp.Data.ID, title, "world")
 	assert.ErrorIs(t, err, ErrBadRequest)
 }
 
 func TestUpdateAd_EmptyText(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
-	resp, err := client.createAd(123, "hello", "world")
+	resp, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 
-	_, err = client.updateAd(123, resp.Data.ID, "title", "")
+	_, err = client.updateAd(author, resp.Data.ID, "title", "")
 	assert.ErrorIs(t, err, ErrBadRequest)
 }
 
 func TestUpdateAd_TooLongText(t *testing.T) {
 	client := getTestClient()
+	author := client.newUser(t)
 
 	text := strings.Repeat("a", 501)
 
-	resp, err := client.createAd(123, "hello", "world")
+	resp, err := client.createAd(author, "hello", "world")
 	assert.NoError(t, err)
 
-	_, err = client.updateAd(123, resp.Data.ID, "title", text)
+	_, err = client.updateAd(author, resp.Data.ID, "title", text)
 	assert.ErrorIs(t, err, ErrBadRequest)
 }
+
+type violationData struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Limit int    `json:"limit"`
+}
+
+func TestCreateAd_ValidationDetails(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	data, err := json.Marshal(map[string]any{
+		"title": "",
+		"text":  strings.Repeat("a", 501),
+	})
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, client.baseURL+"/api/v1/ads", bytes.NewReader(data))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+client.tokens[author])
+	resp, err := client.client.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var body struct {
+		Error   string          `json:"error"`
+		Details []violationData `json:"details"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, []violationData{
+		{Field: "title", Rule: "required"},
+		{Field: "text", Rule: "max_length", Limit: 500},
+	}, body.Details)
+}
+
+func TestCreateAd_LengthInCharacters(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	// 100 Cyrillic letters take 200 bytes but fit into the limit.
+	_, err := client.createAd(author, strings.Repeat("я", 100), "world")
+	assert.NoError(t, err)
+}
+
+func TestCreateAd_ConfiguredLimits(t *testing.T) {
+	client := getTestClient(app.WithLimits(app.Limits{TitleMaxLength: 5}))
+	author := client.newUser(t)
+
+	_, err := client.createAd(author, "hello!", "world")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	// The text limit keeps its default.
+	_, err = client.createAd(author, "hello", strings.Repeat("a", 500))
+	assert.NoError(t, err)
+}
+
+func TestGRPCCreateAd_ValidationDetails(t *testing.T) {
+	client, ctx := getTestGRPCClient(t)
+
+	_, userCtx := signUpGRPC(t, ctx, client, "oleg@example.com")
+
+	_, err := client.CreateAd(userCtx, &grpcPort.CreateAdRequest{Title: strings.Repeat("a", 101), Text: "world"})
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		br, ok := st.Details()[0].(*errdetails.BadRequest)
+		assert.True(t, ok)
+		assert.Len(t, br.FieldViolations, 1)
+		assert.Equal(t, "title", br.FieldViolations[0].Field)
+	}
+}
@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateAd_Version(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), resp.Data.Version)
+
+	etag := fmt.Sprintf("%q", fmt.Sprint(resp.Data.Version))
+	updated, err := client.updateAdIfMatch(author, resp.Data.ID, "first", "edit", etag)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), updated.Data.Version)
+
+	_, err = client.updateAdIfMatch(author, resp.Data.ID, "second", "edit", etag)
+	assert.ErrorIs(t, err, ErrConflict)
+
+	got, err := client.getAd(resp.Data.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", got.Data.Title)
+}
+
+func TestGetAd_ETag(t *testing.T) {
+	client := getTestClient()
+	author := client.newUser(t)
+
+	resp, err := client.createAd(author, "hello", "world")
+	assert.NoError(t, err)
+	_, err = client.changeAdStatus(author, resp.Data.ID, true)
+	assert.NoError(t, err)
+
+	httpResp, err := client.client.Get(fmt.Sprintf(client.baseURL+"/api/v1/ads/%d", resp.Data.ID))
+	assert.NoError(t, err)
+	defer httpResp.Body.Close()
+	assert.Equal(t, http.StatusOK, httpResp.StatusCode)
+	assert.Equal(t, `"2"`, httpResp.Header.Get("ETag"))
+}